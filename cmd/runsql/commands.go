@@ -0,0 +1,432 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zulfikawr/runsql/internal/adapter/cli"
+	"github.com/zulfikawr/runsql/internal/adapter/web"
+	"github.com/zulfikawr/runsql/internal/core"
+	"github.com/zulfikawr/runsql/internal/parsers"
+	"github.com/zulfikawr/runsql/internal/ui"
+	"github.com/zulfikawr/runsql/internal/writers"
+)
+
+// command is a runsql subcommand with its own flags and help
+type command struct {
+	name     string
+	summary  string
+	usage    string
+	examples []string
+	failure  string // prefix of the error message when run fails
+	run      func(cmd *command, args []string) error
+}
+
+// commands lists the subcommands in the order they are shown in the help
+var commands = []*command{
+	{
+		name:    "query",
+		summary: "Run a SQL query against one or more files",
+		usage:   "runsql query (-f <files> | --db <file.sqlite>) ([-q] <sql> | -Q <script.sql>) [-o format]",
+		examples: []string{
+			`runsql query -f users.csv -q "SELECT * FROM users LIMIT 5"`,
+			"runsql query -f users.csv -Q cleanup.sql --results last",
+			`runsql query -f users.csv -q "SELECT * FROM users WHERE city = :city AND age >= :age" -p city=Berlin -p age:int=30`,
+			`runsql query --file users.csv,orders.json "SELECT * FROM users JOIN orders ON users.id = orders.user_id"`,
+			`runsql query --db shop.sqlite "SELECT count(*) FROM orders"`,
+			`runsql query -f 'logs/events-2025-*.csv' --union "SELECT _source_file, count(*) FROM events_2025 GROUP BY 1"`,
+		},
+		failure: "Execution failed",
+		run:     runQuery,
+	},
+	{
+		name:    "describe",
+		summary: "Show the tables, column types and statistics of files without running a query",
+		usage:   "runsql describe (-f <files> | --db <file.sqlite>) [-t table] [-o table|json]",
+		examples: []string{
+			"runsql describe -f users.csv,orders.json",
+		},
+		failure: "Describe failed",
+		run:     runDescribe,
+	},
+	{
+		name:    "convert",
+		summary: "Convert a file to another format without loading it into SQLite",
+		usage:   "runsql convert <input> <output> [--to format] [--select columns] [--where expr]",
+		examples: []string{
+			"runsql convert sales.xlsx sales.parquet",
+			"runsql convert users.csv - --to ndjson",
+			`runsql convert users.csv adults.json --select "id, name AS full_name" --where "age >= 18"`,
+		},
+		failure: "Conversion failed",
+		run:     runConvert,
+	},
+	{
+		name:    "profile",
+		summary: "Show per-column statistics of files",
+		usage:   "runsql profile (-f <files> | --db <file.sqlite>) [-t table] [-o table|json] [--top N]",
+		examples: []string{
+			"runsql profile -f users.csv -o json",
+		},
+		failure: "Profile failed",
+		run:     runProfile,
+	},
+	{
+		name:    "export-db",
+		summary: "Write loaded files and query results to a SQLite database file",
+		usage:   "runsql export-db (-f <files> | --db <file.sqlite>) [-q <sql> [--as table]] [-Q <script.sql>] <output.sqlite>",
+		examples: []string{
+			"runsql export-db -f users.csv,orders.json shop.sqlite",
+			`runsql export-db -f orders.csv -q "SELECT region, SUM(total) AS total FROM orders GROUP BY region" --as totals report.sqlite`,
+		},
+		failure: "Export failed",
+		run:     runExportDB,
+	},
+	{
+		name:    "cache",
+		summary: "List or clear the load cache of tables loaded with --cache",
+		usage:   "runsql cache (ls [-o table|json] | clear)",
+		examples: []string{
+			`runsql query --cache -f big.csv "SELECT COUNT(*) FROM big"`,
+			"runsql cache ls",
+			"runsql cache clear",
+		},
+		failure: "Cache command failed",
+		run:     runCache,
+	},
+	{
+		name:    "functions",
+		summary: "List the SQL functions runsql adds to SQLite",
+		usage:   "runsql functions [-o table|json]",
+		examples: []string{
+			`runsql query -f users.csv "SELECT name FROM users WHERE email REGEXP '@example\.com$'"`,
+		},
+		failure: "Listing functions failed",
+		run:     runFunctions,
+	},
+	{
+		name:    "serve",
+		summary: "Start the web interface",
+		usage:   "runsql serve [--addr host:port] [--max-upload size] [--max-rows n]",
+		examples: []string{
+			"runsql serve --addr :9090",
+		},
+		failure: "Web server failed",
+		run:     runServe,
+	},
+}
+
+// findCommand returns the subcommand with the given name, or nil
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// inputFlags are the flags of the commands that load files
+type inputFlags struct {
+	files   string
+	union   bool
+	format  string
+	options []string
+	cache   *cacheFlags
+}
+
+func addInputFlags(fs *flagSet) *inputFlags {
+	f := &inputFlags{}
+	fs.StringVar(&f.files, "file", "f", "", "Input files, glob patterns or directories (comma-separated for multiple)")
+	fs.BoolVar(&f.union, "union", "", false, "Load the files of each glob pattern or directory into one table, with a _source_file column")
+	fs.StringVar(&f.format, "format", "", "", "Input format of every file ("+inputFormats()+"), detected from its extension or content if not set")
+	fs.StringsVar(&f.options, "option", "", "Parser option as name=value ("+inputOptions()+")")
+	f.cache = addCacheFlags(fs)
+	return f
+}
+
+// cacheFlags are the --cache and --no-cache flags of the commands that load files
+type cacheFlags struct {
+	on, off bool
+}
+
+func addCacheFlags(fs *flagSet) *cacheFlags {
+	f := &cacheFlags{}
+	fs.BoolVar(&f.on, "cache", "", false, "Reuse tables loaded from unchanged files in earlier runs (on by default if RUNSQL_CACHE=1)")
+	fs.BoolVar(&f.off, "no-cache", "", false, "Don't use the load cache, even if RUNSQL_CACHE=1")
+	return f
+}
+
+// options combines the flags with the RUNSQL_CACHE, RUNSQL_CACHE_DIR and RUNSQL_CACHE_SIZE
+// environment variables
+func (f *cacheFlags) options() (cli.CacheOptions, error) {
+	options := cli.CacheOptions{Dir: os.Getenv("RUNSQL_CACHE_DIR")}
+
+	enabled, _ := strconv.ParseBool(os.Getenv("RUNSQL_CACHE"))
+	options.Enabled = (enabled || f.on) && !f.off
+
+	if size := os.Getenv("RUNSQL_CACHE_SIZE"); size != "" {
+		maxSize, err := parseSize(size)
+		if err != nil {
+			return options, fmt.Errorf("invalid RUNSQL_CACHE_SIZE: %w", err)
+		}
+		options.MaxSize = maxSize
+	}
+	return options, nil
+}
+
+// inputFormats lists the names of the input formats, for the help output
+func inputFormats() string {
+	var names []string
+	for _, f := range parsers.Formats() {
+		names = append(names, f.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// inputOptions lists the parser options of every input format, for the help output
+func inputOptions() string {
+	var names []string
+	for _, f := range parsers.Formats() {
+		for name := range f.Options {
+			names = append(names, f.Name+": "+name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func outputFormats() string {
+	return "table, " + strings.Join(writers.Names(), ", ")
+}
+
+// runQuery runs the query command
+func runQuery(cmd *command, args []string) error {
+	var dbPath, query, script, results, outputFmt string
+	var params []string
+
+	fs := newFlagSet(cmd)
+	inputs := addInputFlags(fs)
+	fs.StringVar(&dbPath, "db", "", "", "SQLite database file to load the files into and query; reopen it later without -f")
+	fs.StringVar(&query, "query", "q", "", "SQL query to execute; selects every row of the first file if empty")
+	fs.StringVar(&script, "script", "Q", "", "SQL script with one or more statements to execute in order (- for stdin)")
+	fs.StringVar(&results, "results", "", "all", "Script results to print: all, or only the last")
+	fs.StringsVar(&params, "param", "p", "Query parameter as name=value or name:type=value (type: text, int, float, bool, null), bound to :name or ?")
+	fs.StringVar(&outputFmt, "output", "o", "table", "Output format ("+outputFormats()+")")
+	positional := fs.parse(args)
+
+	switch {
+	case len(positional) == 1 && query == "" && script == "":
+		query = positional[0]
+	case len(positional) > 0:
+		fs.fail("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+	cacheOptions, err := inputs.cache.options()
+	if err != nil {
+		return err
+	}
+
+	return cli.Run(cli.CLIConfig{
+		FilePaths:  splitPaths(inputs.files),
+		Union:      inputs.union,
+		Format:     inputs.format,
+		Options:    inputs.options,
+		DBPath:     dbPath,
+		Query:      query,
+		ScriptPath: script,
+		Results:    results,
+		Params:     params,
+		OutputFmt:  outputFmt,
+		Cache:      cacheOptions,
+	})
+}
+
+// runDescribe runs the describe command
+func runDescribe(cmd *command, args []string) error {
+	var dbPath, table, outputFmt string
+
+	fs := newFlagSet(cmd)
+	inputs := addInputFlags(fs)
+	fs.StringVar(&dbPath, "db", "", "", "SQLite database file; describes all of its tables if no file is given")
+	fs.StringVar(&table, "table", "t", "", "Only describe this table (default: all loaded tables)")
+	fs.StringVar(&outputFmt, "output", "o", "table", "Output format (table, json)")
+	if positional := fs.parse(args); len(positional) > 0 {
+		fs.fail("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+	cacheOptions, err := inputs.cache.options()
+	if err != nil {
+		return err
+	}
+
+	return cli.Describe(cli.DescribeConfig{
+		FilePaths: splitPaths(inputs.files),
+		Union:     inputs.union,
+		Format:    inputs.format,
+		Options:   inputs.options,
+		DBPath:    dbPath,
+		Table:     table,
+		OutputFmt: outputFmt,
+		Cache:     cacheOptions,
+	})
+}
+
+// runConvert runs the convert command
+func runConvert(cmd *command, args []string) error {
+	var format, selectCols, where, from string
+	var options []string
+
+	fs := newFlagSet(cmd)
+	fs.StringVar(&format, "to", "", "", "Output format ("+strings.Join(writers.Names(), ", ")+"), detected from the output extension if not set")
+	fs.StringVar(&selectCols, "select", "s", "", "Columns to keep, in order; rename with AS, e.g. \"id, name AS full_name\"")
+	fs.StringVar(&where, "where", "w", "", "Only keep rows matching this SQL expression, e.g. \"age > 30\"")
+	fs.StringVar(&from, "from", "", "", "Input format ("+inputFormats()+"), detected from the input extension or content if not set")
+	fs.StringsVar(&options, "option", "", "Parser option as name=value ("+inputOptions()+")")
+	positional := fs.parse(args)
+	if len(positional) != 2 {
+		fs.fail("convert needs an input and an output path")
+	}
+
+	return cli.Convert(cli.ConvertConfig{
+		Input:   positional[0],
+		Output:  positional[1],
+		Format:  format,
+		Select:  selectCols,
+		Where:   where,
+		From:    from,
+		Options: options,
+	})
+}
+
+// runProfile runs the profile command
+func runProfile(cmd *command, args []string) error {
+	var dbPath, table, outputFmt string
+	var topN int
+
+	fs := newFlagSet(cmd)
+	inputs := addInputFlags(fs)
+	fs.StringVar(&dbPath, "db", "", "", "SQLite database file; profiles all of its tables if no file is given")
+	fs.StringVar(&table, "table", "t", "", "Only profile this table (default: all loaded tables)")
+	fs.StringVar(&outputFmt, "output", "o", "table", "Output format (table, json)")
+	fs.IntVar(&topN, "top", "", core.DefaultTopValues, "Number of most frequent values per column")
+	if positional := fs.parse(args); len(positional) > 0 {
+		fs.fail("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+	cacheOptions, err := inputs.cache.options()
+	if err != nil {
+		return err
+	}
+
+	return cli.Profile(cli.ProfileConfig{
+		FilePaths: splitPaths(inputs.files),
+		Union:     inputs.union,
+		Format:    inputs.format,
+		Options:   inputs.options,
+		DBPath:    dbPath,
+		Table:     table,
+		OutputFmt: outputFmt,
+		TopN:      topN,
+		Cache:     cacheOptions,
+	})
+}
+
+// runExportDB runs the export-db command
+func runExportDB(cmd *command, args []string) error {
+	var dbPath, query, table, script string
+	var params []string
+
+	fs := newFlagSet(cmd)
+	inputs := addInputFlags(fs)
+	fs.StringVar(&dbPath, "db", "", "", "SQLite database file whose tables are exported along with the files")
+	fs.StringVar(&query, "query", "q", "", "SQL query whose result is saved as a table")
+	fs.StringVar(&table, "as", "", "result", "Name of the table holding the query result")
+	fs.StringVar(&script, "script", "Q", "", "SQL script to run before exporting, e.g. to create tables (- for stdin)")
+	fs.StringsVar(&params, "param", "p", "Query parameter as name=value or name:type=value, bound to :name or ?")
+	positional := fs.parse(args)
+	if len(positional) != 1 {
+		fs.fail("export-db needs one output path")
+	}
+	cacheOptions, err := inputs.cache.options()
+	if err != nil {
+		return err
+	}
+
+	return cli.ExportDB(cli.ExportDBConfig{
+		FilePaths:  splitPaths(inputs.files),
+		Union:      inputs.union,
+		Format:     inputs.format,
+		Options:    inputs.options,
+		DBPath:     dbPath,
+		Query:      query,
+		Table:      table,
+		ScriptPath: script,
+		Params:     params,
+		Output:     positional[0],
+		Cache:      cacheOptions,
+	})
+}
+
+// runCache runs the cache command
+func runCache(cmd *command, args []string) error {
+	var outputFmt string
+
+	fs := newFlagSet(cmd)
+	fs.StringVar(&outputFmt, "output", "o", "table", "Output format of ls (table, json)")
+	positional := fs.parse(args)
+	if len(positional) != 1 {
+		fs.fail("cache needs an action: ls or clear")
+	}
+	cacheOptions, err := (&cacheFlags{}).options()
+	if err != nil {
+		return err
+	}
+
+	return cli.Cache(cli.CacheConfig{
+		Action:    positional[0],
+		OutputFmt: outputFmt,
+		Cache:     cacheOptions,
+	})
+}
+
+// runFunctions runs the functions command
+func runFunctions(cmd *command, args []string) error {
+	var outputFmt string
+
+	fs := newFlagSet(cmd)
+	fs.StringVar(&outputFmt, "output", "o", "table", "Output format (table, json)")
+	if positional := fs.parse(args); len(positional) > 0 {
+		fs.fail("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+
+	return cli.Functions(cli.FunctionsConfig{OutputFmt: outputFmt})
+}
+
+// runServe runs the serve command
+func runServe(cmd *command, args []string) error {
+	var addr, webDir, maxUpload string
+	var maxRows int
+
+	fs := newFlagSet(cmd)
+	fs.StringVar(&addr, "addr", "", ":8080", "Address for the web server")
+	fs.StringVar(&webDir, "web-dir", "", "", "Serve web assets from a directory instead of the embedded copy (for frontend development)")
+	fs.StringVar(&maxUpload, "max-upload", "", "512MB", "Maximum upload size (e.g. 100MB, 2GB, 0 for no limit)")
+	fs.IntVar(&maxRows, "max-rows", "", web.DefaultMaxRows, "Maximum number of rows of a query result kept by the server")
+	if positional := fs.parse(args); len(positional) > 0 {
+		fs.fail("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+
+	return serve(addr, webDir, maxUpload, maxRows)
+}
+
+func serve(addr, webDir, maxUpload string, maxRows int) error {
+	maxUploadBytes, err := parseSize(maxUpload)
+	if err != nil {
+		return fmt.Errorf("invalid --max-upload: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%sStarting web server on %s...%s\n", ui.Colors.Green, addr, ui.Colors.Reset)
+	server := web.NewServer(web.ServerConfig{Addr: addr, WebDir: webDir, MaxUpload: maxUploadBytes, MaxRows: maxRows})
+	return server.Start()
+}
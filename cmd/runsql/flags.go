@@ -0,0 +1,208 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/zulfikawr/runsql/internal/ui"
+)
+
+// flagSet wraps flag.FlagSet so every flag has a long name and an optional shorthand,
+// e.g. --file and -f. Like the standard flag package, either accepts one or two dashes.
+type flagSet struct {
+	*flag.FlagSet
+	cmd   *command
+	flags []flagInfo // in registration order, for the help output
+}
+
+type flagInfo struct {
+	long, short string
+	usage       string
+	defValue    string
+}
+
+func newFlagSet(cmd *command) *flagSet {
+	fs := &flagSet{FlagSet: flag.NewFlagSet(cmd.name, flag.ExitOnError), cmd: cmd}
+	fs.Usage = fs.printUsage
+	return fs
+}
+
+// StringVar defines a string flag with a long name and an optional shorthand
+func (fs *flagSet) StringVar(p *string, long, short, value, usage string) {
+	fs.FlagSet.StringVar(p, long, value, usage)
+	if short != "" {
+		fs.FlagSet.StringVar(p, short, value, usage)
+	}
+	fs.add(long, short, usage, strconv.Quote(value))
+}
+
+// IntVar defines an int flag with a long name and an optional shorthand
+func (fs *flagSet) IntVar(p *int, long, short string, value int, usage string) {
+	fs.FlagSet.IntVar(p, long, value, usage)
+	if short != "" {
+		fs.FlagSet.IntVar(p, short, value, usage)
+	}
+	fs.add(long, short, usage, strconv.Itoa(value))
+}
+
+// BoolVar defines a bool flag with a long name and an optional shorthand
+func (fs *flagSet) BoolVar(p *bool, long, short string, value bool, usage string) {
+	fs.FlagSet.BoolVar(p, long, value, usage)
+	if short != "" {
+		fs.FlagSet.BoolVar(p, short, value, usage)
+	}
+	fs.add(long, short, usage, strconv.FormatBool(value))
+}
+
+// StringsVar defines a repeatable string flag, collecting every value in order
+func (fs *flagSet) StringsVar(p *[]string, long, short, usage string) {
+	fs.FlagSet.Var((*stringsValue)(p), long, usage)
+	if short != "" {
+		fs.FlagSet.Var((*stringsValue)(p), short, usage)
+	}
+	fs.add(long, short, usage+" (repeatable)", "none")
+}
+
+// stringsValue is a flag.Value that appends every occurrence of the flag
+type stringsValue []string
+
+func (v *stringsValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(*v, ", ")
+}
+
+func (v *stringsValue) Set(value string) error {
+	*v = append(*v, value)
+	return nil
+}
+
+func (fs *flagSet) add(long, short, usage, defValue string) {
+	fs.flags = append(fs.flags, flagInfo{long: long, short: short, usage: usage, defValue: defValue})
+}
+
+// parse parses the flags and returns the positional arguments. Flags may appear
+// before, between or after positional arguments, e.g. "convert in.csv out.json --to json".
+// Everything after "--" is positional.
+func (fs *flagSet) parse(args []string) []string {
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, rest = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	var positional []string
+	for {
+		fs.Parse(args) // exits on error
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return append(positional, rest...)
+}
+
+// fail reports a usage error and exits
+func (fs *flagSet) fail(format string, args ...any) {
+	c := ui.Colors
+	fmt.Fprintf(os.Stderr, "%s%s%s\n", c.Red, fmt.Sprintf(format, args...), c.Reset)
+	fs.Usage()
+	os.Exit(2)
+}
+
+// printUsage prints the help of the command in the same style as the top-level help
+func (fs *flagSet) printUsage() {
+	c := ui.Colors
+	cmd := fs.cmd
+
+	fmt.Fprintf(os.Stderr, "\n  %s%s%s %s%s%s\n\n",
+		c.Cyan, c.Bold, "runsql "+cmd.name,
+		c.Reset, c.White, cmd.summary)
+
+	fmt.Fprintf(os.Stderr, "  %s%s:\n", c.Yellow, "Usage")
+	fmt.Fprintf(os.Stderr, "    %s%s%s\n\n", c.Reset, cmd.usage, c.Reset)
+
+	if len(fs.flags) > 0 {
+		fmt.Fprintf(os.Stderr, "  %s%s:\n", c.Yellow, "Flags")
+		for _, f := range fs.flags {
+			printFlag(f.long, f.short, f.usage, f.defValue)
+		}
+	}
+
+	if len(cmd.examples) > 0 {
+		fmt.Fprintf(os.Stderr, "\n  %s%s:%s\n", c.Yellow, "Examples", c.Reset)
+		for _, example := range cmd.examples {
+			fmt.Fprintf(os.Stderr, "    %s\n", example)
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprint(os.Stderr, c.Reset)
+}
+
+// printFlag prints one line of flag help, e.g. "--file, -f   Input file paths (default: "")"
+func printFlag(long, short, description, defValue string) {
+	c := ui.Colors
+
+	left := "    --" + long
+	if short != "" {
+		left += ", -" + short
+	}
+
+	fmt.Fprintf(os.Stderr, "%s%-25s%s %s %s(default: %s)%s\n",
+		c.Green, left, c.Reset,
+		description,
+		c.Dim, defValue, c.Reset)
+}
+
+// splitPaths splits a comma-separated list of file paths
+func splitPaths(value string) []string {
+	filePaths := []string{}
+	for p := range strings.SplitSeq(value, ",") {
+		trimmed := strings.TrimSpace(p)
+		if trimmed != "" {
+			filePaths = append(filePaths, trimmed)
+		}
+	}
+	return filePaths
+}
+
+// parseSize parses a byte size such as "512MB", "2GB", "64k" or "1048576"
+func parseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "B")
+
+	multiplier := int64(1)
+	if str != "" {
+		switch str[len(str)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			str = str[:len(str)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(str), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * multiplier, nil
+}
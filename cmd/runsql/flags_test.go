@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+		err   string // Start of the error, if any
+	}{
+		{"1048576", 1048576, ""},
+		{"0", 0, ""},
+		{"64k", 64 << 10, ""},
+		{"64KB", 64 << 10, ""},
+		{"512MB", 512 << 20, ""},
+		{"512m", 512 << 20, ""},
+		{" 2 GB ", 2 << 30, ""},
+		{"1T", 1 << 40, ""},
+		{"100B", 100, ""},
+		{"8388607T", 8388607 << 40, ""},
+		{"8388608T", 0, "size \"8388608T\" is too large"},
+		{"9223372036854775807", 9223372036854775807, ""},
+		{"9223372036854775808", 0, "invalid size"},
+		{"-1", 0, "invalid size"},
+		{"-1MB", 0, "invalid size"},
+		{"1.5GB", 0, "invalid size"},
+		{"MB", 0, "invalid size"},
+		{"", 0, "invalid size"},
+		{"12PB", 0, "invalid size"},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.input)
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("parseSize(%q) = %d, %v; want error %q", tt.input, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestFlagSetParse(t *testing.T) {
+	tests := []struct {
+		args       []string
+		name       string
+		limit      int
+		verbose    bool
+		tags       string
+		positional string
+	}{
+		{nil, "none", 10, false, "", ""},
+		{[]string{"--name", "a", "-n", "5", "in.csv"}, "a", 5, false, "", "in.csv"},
+		{[]string{"in.csv", "out.json", "-v", "--name=b"}, "b", 10, true, "", "in.csv out.json"},
+		{[]string{"-N", "c", "in.csv", "--tag", "x", "out.json", "-t", "y"}, "c", 10, false, "x y", "in.csv out.json"},
+		{[]string{"--name", "d", "--", "-v", "--tag", "x"}, "d", 10, false, "", "-v --tag x"},
+		{[]string{"-limit", "3", "-verbose=false"}, "none", 3, false, "", ""},
+	}
+	for _, tt := range tests {
+		var name string
+		var limit int
+		var verbose bool
+		var tags []string
+		fs := newFlagSet(&command{name: "test"})
+		fs.StringVar(&name, "name", "N", "none", "Name")
+		fs.IntVar(&limit, "limit", "n", 10, "Limit")
+		fs.BoolVar(&verbose, "verbose", "v", false, "Verbose")
+		fs.StringsVar(&tags, "tag", "t", "Tag")
+
+		positional := fs.parse(tt.args)
+		if name != tt.name || limit != tt.limit || verbose != tt.verbose || strings.Join(tags, " ") != tt.tags {
+			t.Errorf("%v: got name %q, limit %d, verbose %v, tags %v", tt.args, name, limit, verbose, tags)
+		}
+		if got := strings.Join(positional, " "); got != tt.positional {
+			t.Errorf("%v: got positional %q, want %q", tt.args, got, tt.positional)
+		}
+	}
+}
+
+func TestInputFlags(t *testing.T) {
+	// Every command that loads files takes the same input flags
+	for _, name := range []string{"query", "describe", "profile", "export-db"} {
+		if cmd := findCommand(name); cmd == nil || !strings.Contains(cmd.usage, "-f") {
+			t.Errorf("%s: expected a command taking -f", name)
+		}
+	}
+
+	fs := newFlagSet(findCommand("query"))
+	inputs := addInputFlags(fs)
+	fs.parse([]string{"-f", " a.csv, logs/*.csv ,,", "--union", "--format", "csv", "--option", "delimiter=;", "--option=header=false", "--cache"})
+	if got := strings.Join(splitPaths(inputs.files), "|"); got != "a.csv|logs/*.csv" {
+		t.Errorf("Unexpected files: %s", got)
+	}
+	if !inputs.union || inputs.format != "csv" || strings.Join(inputs.options, " ") != "delimiter=; header=false" {
+		t.Errorf("Unexpected input flags: %+v", inputs)
+	}
+
+	tests := []struct {
+		cache, size string // RUNSQL_CACHE and RUNSQL_CACHE_SIZE
+		on, off     bool
+		enabled     bool
+		maxSize     int64
+		err         string
+	}{
+		{"", "", false, false, false, 0, ""},
+		{"", "", true, false, true, 0, ""},
+		{"1", "", false, false, true, 0, ""},
+		{"1", "", true, true, false, 0, ""},
+		{"true", "2GB", false, false, true, 2 << 30, ""},
+		{"", "-1GB", false, false, false, 0, "invalid RUNSQL_CACHE_SIZE"},
+		{"", "99999999999T", false, false, false, 0, "invalid RUNSQL_CACHE_SIZE"},
+	}
+	for _, tt := range tests {
+		t.Setenv("RUNSQL_CACHE", tt.cache)
+		t.Setenv("RUNSQL_CACHE_SIZE", tt.size)
+		options, err := (&cacheFlags{on: tt.on, off: tt.off}).options()
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%+v: expected error %q, got %v", tt, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || options.Enabled != tt.enabled || options.MaxSize != tt.maxSize {
+			t.Errorf("%+v: got %+v, %v", tt, options, err)
+		}
+	}
+}
+
+func TestParseLegacy(t *testing.T) {
+	a := parseLegacy([]string{"-f", "users.csv,orders.json", "-q", "SELECT 1", "-o", "json", "-p", "a=1", "--param", "b:int=2", "--union"})
+	if a.inputs.files != "users.csv,orders.json" || a.query != "SELECT 1" || a.outputFmt != "json" || !a.inputs.union {
+		t.Errorf("Unexpected flags: %+v", a)
+	}
+	if strings.Join(a.params, " ") != "a=1 b:int=2" || a.webMode {
+		t.Errorf("Unexpected params %v or web mode", a.params)
+	}
+
+	// Long flags with one dash, and the flags of the web server
+	a = parseLegacy([]string{"-web", "-addr", ":9090", "-max-upload", "1GB", "-file=data.csv"})
+	if !a.webMode || a.addr != ":9090" || a.maxUpload != "1GB" || a.inputs.files != "data.csv" {
+		t.Errorf("Unexpected flags: %+v", a)
+	}
+
+	// Defaults
+	a = parseLegacy([]string{"-Q", "setup.sql"})
+	if a.script != "setup.sql" || a.results != "all" || a.outputFmt != "table" || a.addr != ":8080" || a.maxUpload != "512MB" {
+		t.Errorf("Unexpected defaults: %+v", a)
+	}
+}
@@ -1,96 +1,158 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"os"
-	"runsql/internal/adapter/cli"
-	"runsql/internal/adapter/web"
-	"runsql/internal/ui"
 	"strings"
+
+	"github.com/zulfikawr/runsql/internal/adapter/cli"
+	"github.com/zulfikawr/runsql/internal/ui"
 )
 
 func main() {
-	// Custom Usage/Help Message
-	flag.Usage = func() {
-		// Colors aliases for brevity
-		c := ui.Colors
-
-		// Header
-		fmt.Fprintf(os.Stderr, "\n  %s%s%s %s%s%s\n\n",
-			c.Cyan, c.Bold, "runsql",
-			c.Reset, c.White, "A hybrid CLI & Web tool to run SQL queries on CSV, XLSX, and JSON files, written in Go.")
-
-		fmt.Fprintf(os.Stderr, "  %s%s:\n", c.Yellow, "Usage")
-		fmt.Fprintf(os.Stderr, "    %srunsql [flags]%s\n\n", c.Reset, c.Reset)
-
-		fmt.Fprintf(os.Stderr, "  %s%s:\n", c.Yellow, "Flags")
-
-		printFlag := func(flagName, shorthand, description string, defaultVal any) {
-			// Format: --flag, -f
-			left := fmt.Sprintf("    --%s, -%s", flagName, shorthand)
-
-			// Format the full line
-			fmt.Fprintf(os.Stderr, "%s%-25s%s %s %s(default: %v)%s\n",
-				c.Green, left, c.Reset,
-				description,
-				c.Dim, defaultVal, c.Reset)
-		}
+	args := os.Args[1:]
+
+	if len(args) == 0 {
+		printUsage()
+		os.Exit(2)
+	}
 
-		printFlag("file", "f", " Input file paths (comma-separated for multiple files)", "\"\"")
-		printFlag("query", "q", " SQL query to execute", "\"\"")
-		printFlag("output", "o", " Output format (table, json, csv)", "table")
-		printFlag("web", "web", " Start the web interface", "false")
-		printFlag("addr", "addr", "Address for web server", ":8080")
+	// The original flat syntax, e.g. "runsql -f data.csv -q ..." or "runsql -web"
+	if strings.HasPrefix(args[0], "-") {
+		runLegacy(args)
+		return
+	}
+
+	if args[0] == "help" {
+		runHelp(args[1:])
+		return
+	}
 
-		fmt.Fprintf(os.Stderr, "\n  %s%s:\n", c.Yellow, "Examples")
-		fmt.Fprintf(os.Stderr, "    runsql -f users.csv -q \"SELECT * FROM users LIMIT 5\"\n")
-		fmt.Fprintf(os.Stderr, "    runsql -f users.csv,orders.json -q \"SELECT * FROM users JOIN orders ON users.id = orders.user_id\"\n")
-		fmt.Fprintf(os.Stderr, "    runsql -web -addr :9090\n\n")
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "%sUnknown command %q%s\n", ui.Colors.Red, args[0], ui.Colors.Reset)
+		printUsage()
+		os.Exit(2)
+	}
 
-		fmt.Fprint(os.Stderr, c.Reset)
+	if err := cmd.run(cmd, args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s%s: %v%s\n", ui.Colors.Red, cmd.failure, err, ui.Colors.Reset)
+		os.Exit(1)
 	}
+}
 
-	// Define CLI flags
-	filePath := flag.String("f", "", "File path (for CLI mode)")
-	query := flag.String("q", "", "SQL query (for CLI mode)")
-	outputFmt := flag.String("o", "table", "Output format: table, json, csv (for CLI mode)")
-	webMode := flag.Bool("web", false, "Run in web mode (default: CLI mode)")
-	addr := flag.String("addr", ":8080", "Web server address (for web mode)")
+// runHelp prints the help of a command, or the top-level help
+func runHelp(args []string) {
+	if len(args) == 0 {
+		printUsage()
+		return
+	}
 
-	flag.Parse()
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "%sUnknown command %q%s\n", ui.Colors.Red, args[0], ui.Colors.Reset)
+		printUsage()
+		os.Exit(2)
+	}
+	cmd.run(cmd, []string{"--help"})
+}
 
-	// Check for help flag equivalent helper (Go flag handles -h/-help automatically calling Usage, but we customized it)
+// printUsage prints the top-level help
+func printUsage() {
+	// Colors aliases for brevity
+	c := ui.Colors
 
-	if *webMode {
-		fmt.Printf("%sStarting web server on %s...%s\n", ui.Colors.Green, *addr, ui.Colors.Reset)
-		server := web.NewServer(*addr)
-		if err := server.Start(); err != nil {
-			fmt.Printf("%sWeb server failed: %v%s\n", ui.Colors.Red, err, ui.Colors.Reset)
-			os.Exit(1)
-		}
-	} else {
-		// CLI mode
-		filePaths := []string{}
-		if *filePath != "" {
-			parts := strings.SplitSeq(*filePath, ",")
-			for p := range parts {
-				trimmed := strings.TrimSpace(p)
-				if trimmed != "" {
-					filePaths = append(filePaths, trimmed)
-				}
-			}
-		}
+	// Header
+	fmt.Fprintf(os.Stderr, "\n  %s%s%s %s%s%s\n\n",
+		c.Cyan, c.Bold, "runsql",
+		c.Reset, c.White, "A hybrid CLI & Web tool to run SQL queries on CSV, XLSX, and JSON files, written in Go.")
 
-		config := cli.CLIConfig{
-			FilePaths: filePaths,
-			Query:     *query,
-			OutputFmt: *outputFmt,
-		}
+	fmt.Fprintf(os.Stderr, "  %s%s:\n", c.Yellow, "Usage")
+	fmt.Fprintf(os.Stderr, "    %srunsql <command> [flags]%s\n\n", c.Reset, c.Reset)
 
-		if err := cli.Run(config); err != nil {
-			fmt.Printf("%sExecution failed: %v%s\n", ui.Colors.Red, err, ui.Colors.Reset)
+	fmt.Fprintf(os.Stderr, "  %s%s:%s\n", c.Yellow, "Commands", c.Reset)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "    %s%-10s%s %s\n", c.Green, cmd.name, c.Reset, cmd.summary)
+	}
+
+	fmt.Fprintf(os.Stderr, "\n    Run %srunsql help <command>%s for the flags of a command.\n", c.Bold, c.Reset)
+	fmt.Fprintf(os.Stderr, "    The flat syntax %srunsql -f <files> -q <sql>%s and %srunsql -web%s still works.\n", c.Bold, c.Reset, c.Bold, c.Reset)
+
+	fmt.Fprintf(os.Stderr, "\n  %s%s:%s\n", c.Yellow, "Examples", c.Reset)
+	fmt.Fprintf(os.Stderr, "    runsql query -f users.csv \"SELECT * FROM users LIMIT 5\"\n")
+	fmt.Fprintf(os.Stderr, "    runsql describe -f users.csv,orders.json\n")
+	fmt.Fprintf(os.Stderr, "    runsql convert sales.xlsx sales.csv\n")
+	fmt.Fprintf(os.Stderr, "    runsql profile -f users.csv -o json\n")
+	fmt.Fprintf(os.Stderr, "    runsql export-db -f users.csv,orders.json shop.sqlite\n")
+	fmt.Fprintf(os.Stderr, "    runsql functions\n")
+	fmt.Fprintf(os.Stderr, "    runsql serve --addr :9090\n\n")
+
+	fmt.Fprint(os.Stderr, c.Reset)
+}
+
+// runLegacy runs the flat syntax used before subcommands existed: a query by default,
+// or the web server with -web. It accepts the flags of both the query and serve commands.
+func runLegacy(args []string) {
+	a := parseLegacy(args)
+
+	if a.webMode {
+		if err := serve(a.addr, a.webDir, a.maxUpload, 0); err != nil {
+			fmt.Fprintf(os.Stderr, "%sWeb server failed: %v%s\n", ui.Colors.Red, err, ui.Colors.Reset)
 			os.Exit(1)
 		}
+		return
+	}
+
+	cacheOptions, err := a.inputs.cache.options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sExecution failed: %v%s\n", ui.Colors.Red, err, ui.Colors.Reset)
+		os.Exit(1)
+	}
+	config := cli.CLIConfig{
+		FilePaths:  splitPaths(a.inputs.files),
+		Union:      a.inputs.union,
+		Format:     a.inputs.format,
+		Options:    a.inputs.options,
+		DBPath:     a.dbPath,
+		Query:      a.query,
+		ScriptPath: a.script,
+		Results:    a.results,
+		Params:     a.params,
+		OutputFmt:  a.outputFmt,
+		Cache:      cacheOptions,
+	}
+	if err := cli.Run(config); err != nil {
+		fmt.Fprintf(os.Stderr, "%sExecution failed: %v%s\n", ui.Colors.Red, err, ui.Colors.Reset)
+		os.Exit(1)
+	}
+}
+
+// legacyArgs holds the flags of the flat syntax
+type legacyArgs struct {
+	inputs                                                             *inputFlags
+	dbPath, query, script, results, outputFmt, addr, webDir, maxUpload string
+	params                                                             []string
+	webMode                                                            bool
+}
+
+// parseLegacy parses the flags of the flat syntax, which takes no positional arguments
+func parseLegacy(args []string) *legacyArgs {
+	a := &legacyArgs{}
+	fs := newFlagSet(&command{})
+	fs.Usage = printUsage
+	a.inputs = addInputFlags(fs)
+	fs.StringVar(&a.dbPath, "db", "", "", "SQLite database file to load the files into and query")
+	fs.StringVar(&a.query, "query", "q", "", "SQL query to execute")
+	fs.StringVar(&a.script, "script", "Q", "", "SQL script to execute")
+	fs.StringVar(&a.results, "results", "", "all", "Script results to print: all, or only the last")
+	fs.StringsVar(&a.params, "param", "p", "Query parameter as name=value or name:type=value")
+	fs.StringVar(&a.outputFmt, "output", "o", "table", "Output format ("+outputFormats()+")")
+	fs.BoolVar(&a.webMode, "web", "", false, "Start the web interface")
+	fs.StringVar(&a.addr, "addr", "", ":8080", "Address for the web server")
+	fs.StringVar(&a.webDir, "web-dir", "", "", "Serve web assets from a directory")
+	fs.StringVar(&a.maxUpload, "max-upload", "", "512MB", "Maximum upload size for the web server")
+	if positional := fs.parse(args); len(positional) > 0 {
+		fs.fail("unexpected arguments: %s", strings.Join(positional, " "))
 	}
+	return a
 }
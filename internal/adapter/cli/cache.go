@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/runsql/internal/core"
+	"github.com/zulfikawr/runsql/internal/parsers"
+	"github.com/zulfikawr/runsql/internal/ui"
+)
+
+// CacheOptions controls the load cache of a command
+type CacheOptions struct {
+	Enabled bool   // --cache / --no-cache, or RUNSQL_CACHE
+	Dir     string // RUNSQL_CACHE_DIR: Cache directory (default: the user cache directory)
+	MaxSize int64  // RUNSQL_CACHE_SIZE: Maximum total size of the cache in bytes
+}
+
+// CacheConfig holds the arguments of the cache command
+type CacheConfig struct {
+	Action    string // ls or clear
+	OutputFmt string // -o: Output format for ls (table, json)
+	Cache     CacheOptions
+}
+
+// newLoadCache returns the load cache described by the options
+func newLoadCache(options CacheOptions) (*core.LoadCache, error) {
+	dir := options.Dir
+	if dir == "" {
+		var err error
+		if dir, err = core.DefaultCacheDir(); err != nil {
+			return nil, fmt.Errorf("failed to locate the cache directory: %w", err)
+		}
+	}
+	return core.NewLoadCache(dir, options.MaxSize), nil
+}
+
+// fileSource opens the parser of a file on first use, so that a table found in the
+// load cache is copied without the file being parsed at all
+type fileSource struct {
+	path    string
+	union   *input // Set if the files of an input are unioned into one table instead
+	format  string // --format, if given
+	options parsers.Options
+	source  parsers.Source
+	closer  io.Closer
+	openErr error // Set if the file couldn't be parsed
+}
+
+// newFileSource returns the source of an input's table. The parser matching the file
+// type is only created if the table isn't cached.
+func newFileSource(in *input) *fileSource {
+	if in.union {
+		return &fileSource{union: in, format: in.format, options: in.options}
+	}
+	return &fileSource{path: in.paths[0], format: in.format, options: in.options}
+}
+
+func (s *fileSource) open() (parsers.Source, error) {
+	if s.source == nil && s.openErr == nil {
+		if s.union != nil {
+			s.source, s.closer, s.openErr = unionSource(*s.union)
+		} else {
+			s.source, s.closer, s.openErr = openFile(s.path, s.format, s.options)
+		}
+	}
+	return s.source, s.openErr
+}
+
+// Close closes the files opened by the source, if it was opened
+func (s *fileSource) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+func (s *fileSource) GetHeaders() ([]string, error) {
+	source, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return source.GetHeaders()
+}
+
+func (s *fileSource) Read() (chan []interface{}, error) {
+	source, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return source.Read()
+}
+
+// ColumnTypes returns the column types of the source, if it knows them
+func (s *fileSource) ColumnTypes() []string {
+	source, err := s.open()
+	if err != nil {
+		return nil
+	}
+	if typed, ok := source.(parsers.TypedSource); ok {
+		return typed.ColumnTypes()
+	}
+	return nil
+}
+
+// CacheKey identifies the file by path, size and modification time, and the way it is
+// read by its format and the options the format takes
+func (s *fileSource) CacheKey() (core.CacheKey, error) {
+	if s.union != nil {
+		return core.CacheKey{}, errors.New("unioned files are not cached")
+	}
+	format, err := fileFormat(s.path, s.format)
+	if err != nil {
+		return core.CacheKey{}, err
+	}
+	return core.FileCacheKey(s.path, format.Name+";"+s.options.For(format).String())
+}
+
+// Cache lists or clears the load cache
+func Cache(config CacheConfig) error {
+	cache, err := newLoadCache(config.Cache)
+	if err != nil {
+		return err
+	}
+	c := ui.Colors
+
+	switch config.Action {
+	case "ls":
+		entries, err := cache.Entries()
+		if err != nil {
+			return err
+		}
+		return outputCacheEntries(cache, entries, config.OutputFmt)
+
+	case "clear":
+		n, err := cache.Clear()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s✓%s Removed %s from %s\n", c.Green, c.Reset, pluralize(n, "cached table"), cache.Dir())
+		return nil
+
+	default:
+		return fmt.Errorf("unknown cache action %q (use ls or clear)", config.Action)
+	}
+}
+
+func outputCacheEntries(cache *core.LoadCache, entries []core.CacheEntry, format string) error {
+	switch strings.ToLower(format) {
+	case "", "table":
+		var total int64
+		rows := make([][]interface{}, len(entries))
+		for i, e := range entries {
+			total += e.Size
+			rows[i] = []interface{}{e.Source, e.Rows, formatBytes(e.Size), e.LastUsed.Format(time.DateTime)}
+		}
+		if len(entries) > 0 {
+			if err := outputTable([]string{"source", "rows", "size", "last used"}, rows); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%s in %s, using %s of %s\n", pluralize(len(entries), "cached table"), cache.Dir(), formatBytes(total), formatBytes(cache.MaxSize()))
+		return nil
+	case "json":
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format for cache ls: %s (use table or json)", format)
+	}
+}
+
+// formatBytes renders a size for humans, e.g. "1.5 GB"
+func formatBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(n)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
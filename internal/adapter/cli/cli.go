@@ -1,81 +1,132 @@
 package cli
 
 import (
-	"encoding/csv"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
-	"runsql/internal/core"
-	"runsql/internal/parsers"
-	"runsql/internal/ui"
 	"strings"
+	"time"
 
-	"github.com/xuri/excelize/v2"
+	"github.com/zulfikawr/runsql/internal/core"
+	"github.com/zulfikawr/runsql/internal/parsers"
+	"github.com/zulfikawr/runsql/internal/ui"
+	"github.com/zulfikawr/runsql/internal/writers"
 )
 
 // CLIConfig holds the CLI command-line arguments
 type CLIConfig struct {
-	FilePaths []string // -f: File paths (comma separated)
-	Query     string   // -q: SQL query
-	OutputFmt string   // -o: Output format (table, json, csv)
+	FilePaths  []string // -f: File paths (comma separated), globs or directories
+	Union      bool     // --union: Load the files of each glob or directory into one table
+	Format     string   // --format: Input format of every file, detected from its extension or content if empty
+	Options    []string // --option: Parser options as name=value, e.g. delimiter=; for CSV files
+	DBPath     string   // --db: SQLite database file backing the engine, kept between runs
+	Query      string   // -q: SQL query
+	ScriptPath string   // -Q: SQL script file with one or more statements ("-" for stdin)
+	Results    string   // --results: Which script results to print (all, last)
+	Params     []string // -p: Query parameters as name=value or name:type=value
+	OutputFmt  string   // -o: Output format (table, json, ndjson, csv, xlsx, parquet)
+	Cache      CacheOptions
 }
 
 // Run executes the CLI workflow
 func Run(config CLIConfig) error {
 	// Validate inputs
-	if len(config.FilePaths) == 0 {
+	if len(config.FilePaths) == 0 && config.DBPath == "" {
 		return fmt.Errorf("file path is required (-f)")
 	}
 
-	if config.Query == "" {
+	if config.Query != "" && config.ScriptPath != "" {
+		return fmt.Errorf("use either a query (-q) or a script (-Q), not both")
+	}
+
+	args, err := parseParams(config.Params)
+	if err != nil {
+		return err
+	}
+
+	inputs, err := expandInputs(config.FilePaths, config.Union, config.Format, config.Options)
+	if err != nil {
+		return err
+	}
+	if config.Query != "" && config.DBPath == "" {
+		// A table kept in a --db file must hold every partition, whatever the query
+		skipPartitions(inputs, config.Query)
+	}
+
+	var script string
+	if config.ScriptPath != "" {
+		if script, err = readScript(config.ScriptPath); err != nil {
+			return err
+		}
+	} else if config.Query == "" {
 		// Default to selecting from the first table if available
-		if len(config.FilePaths) > 0 {
-			firstTable := getTableNameFromPath(config.FilePaths[0])
-			config.Query = fmt.Sprintf("SELECT * FROM %s", firstTable)
-		} else {
-			config.Query = "SELECT 1" // Fallback if no files (though validation prevents this)
+		if len(inputs) == 0 {
+			return fmt.Errorf("query is required (-q) when no file is given")
 		}
+		config.Query = fmt.Sprintf("SELECT * FROM %s", inputs[0].table)
 	}
 
 	if config.OutputFmt == "" {
 		config.OutputFmt = "table"
 	}
 
-	// Colors
-	c := ui.Colors
+	// Only the tables the query names are loaded up front, however many files are given;
+	// the others are loaded if the query turns out to use them, e.g. through a view. A
+	// --db file gets every table, to be queried later.
+	var skipped []input
+	if config.DBPath == "" {
+		sql := config.Query
+		if config.ScriptPath != "" {
+			sql = script
+		}
+		if inputs, skipped = skipUnreferenced(inputs, sql); len(skipped) > 0 {
+			c := ui.Colors
+			var names []string
+			for _, in := range skipped {
+				names = append(names, in.table)
+			}
+			list := strings.Join(names, ", ")
+			if len(names) > 5 {
+				list = strings.Join(names[:5], ", ") + ", ..."
+			}
+			fmt.Fprintf(os.Stderr, "%sSkipping %s not used by the query (%s)%s\n",
+				c.Dim, pluralize(len(names), "table"), list, c.Reset)
+		}
+	}
 
-	// Step 1: Create engine
-	engine, err := core.NewEngine()
+	// Step 1: Create engine, in memory or on the --db file
+	engine, err := openEngine(config.DBPath, config.Cache)
 	if err != nil {
-		return fmt.Errorf("failed to create engine: %w", err)
+		return err
 	}
 	defer engine.Close()
 
-	// Step 2: Load all files
-
-	for _, path := range config.FilePaths {
-		fmt.Fprintf(os.Stderr, "%sProcessing %s%s%s...%s\n", c.Yellow, c.White, c.Bold, path, c.Reset)
-
-		// Detect file type and create appropriate parser
-		source, err := getSourceFromFile(path)
-		if err != nil {
-			return fmt.Errorf("failed to parse file '%s': %w", path, err)
+	if len(skipped) > 0 {
+		loader := core.NewLazyLoader(engine)
+		for i := range skipped {
+			in := &skipped[i]
+			loader.Add(in.table, func() (parsers.Source, io.Closer, error) {
+				c := ui.Colors
+				fmt.Fprintf(os.Stderr, "%sProcessing %s%s%s, used by the query after all...%s\n", c.Yellow, c.White, c.Bold, in.name, c.Reset)
+				source := newFileSource(in)
+				return source, source, nil
+			})
 		}
+		engine.UseLoader(loader)
+	}
 
-		// Derive table name from filename
-		tableName := getTableNameFromPath(path)
-
-		err = engine.Load(tableName, source)
-		if err != nil {
-			return fmt.Errorf("failed to load data from '%s': %w", path, err)
-		}
+	// Step 2: Load all files
+	if _, err := loadFiles(engine, inputs); err != nil {
+		return err
+	}
 
-		fmt.Fprintf(os.Stderr, "%s✓%s Loaded '%s' as table '%s'\n", c.Green, c.Reset, path, tableName)
+	if config.ScriptPath != "" {
+		return runScript(engine, script, args, config)
 	}
 
-	// Step 3: Execute query
-	columns, rows, err := engine.Query(config.Query)
+	// Step 3: Execute query, binding the parameters to its placeholders
+	columns, rows, err := engine.Query(config.Query, args...)
 	if err != nil {
 		return fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -84,69 +135,97 @@ func Run(config CLIConfig) error {
 	return formatOutput(config.OutputFmt, columns, rows)
 }
 
-// getTableNameFromPath derives a table name from a file path
-func getTableNameFromPath(path string) string {
-	base := filepath.Base(path)
-	ext := filepath.Ext(base)
-	name := strings.TrimSuffix(base, ext)
-	return sanitizeTableName(name)
-}
+// loadProgressInterval is how often a file that is still loading reports its row count
+const loadProgressInterval = 2 * time.Second
 
-func sanitizeTableName(name string) string {
-	var sb strings.Builder
-	for _, r := range name {
-		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
-			sb.WriteRune(r)
+// loadFiles loads the inputs into the engine and returns the table names, in order.
+// Inputs are parsed concurrently; if some of them fail, the others are still loaded and
+// the errors are reported in the order of the inputs.
+func loadFiles(engine *core.Engine, inputs []input) ([]string, error) {
+	c := ui.Colors
+	tables := make([]string, len(inputs))
+	sources := make([]*fileSource, len(inputs))
+	jobs := make([]core.LoadJob, len(inputs))
+	paths := make([]string, len(inputs))
+
+	for i, in := range inputs {
+		paths[i] = in.name
+		if in.union {
+			files := fmt.Sprintf("%d files", len(in.paths))
+			if in.skipped > 0 {
+				files = fmt.Sprintf("%d of %d files, %d partitions skipped by the query", len(in.paths), len(in.paths)+in.skipped, in.skipped)
+			}
+			fmt.Fprintf(os.Stderr, "%sProcessing %s%s%s (%s)...%s\n", c.Yellow, c.White, c.Bold, in.name, files, c.Reset)
 		} else {
-			sb.WriteRune('_')
+			fmt.Fprintf(os.Stderr, "%sProcessing %s%s%s...%s\n", c.Yellow, c.White, c.Bold, in.name, c.Reset)
 		}
-	}
-	return sb.String()
-}
+		sources[i] = newFileSource(&inputs[i])
 
-// getSourceFromFile detects file type and returns appropriate parser
-func getSourceFromFile(filePath string) (parsers.Source, error) {
-	ext := strings.ToLower(filepath.Ext(filePath))
+		tables[i] = in.table
+		jobs[i] = core.LoadJob{Table: tables[i], Source: sources[i]}
+	}
 
-	switch ext {
-	case ".csv":
-		file, err := os.Open(filePath)
-		if err != nil {
-			return nil, err
+	// When each file last reported its row count
+	reported := make([]time.Duration, len(inputs))
+	progress := func(p core.LoadProgress) {
+		path := paths[p.Index]
+		switch {
+		case p.Done && p.Err != nil:
+			fmt.Fprintf(os.Stderr, "%s✗%s Failed to load '%s'\n", c.Red, c.Reset, path)
+		case p.Done:
+			cached := ""
+			if p.Cached {
+				cached = ", from cache"
+			}
+			fmt.Fprintf(os.Stderr, "%s✓%s Loaded '%s' as table '%s' (%d rows, %s%s)\n",
+				c.Green, c.Reset, path, p.Table, p.Rows, p.Duration.Round(time.Millisecond), cached)
+		case p.Duration-reported[p.Index] >= loadProgressInterval:
+			reported[p.Index] = p.Duration
+			fmt.Fprintf(os.Stderr, "%s  %s: %d rows so far...%s\n", c.Dim, path, p.Rows, c.Reset)
 		}
-		return parsers.NewCSVSource(file)
+	}
 
-	case ".json":
-		file, err := os.Open(filePath)
-		if err != nil {
-			return nil, err
-		}
-		return parsers.NewJSONSource(file)
+	err := engine.LoadAll(jobs, core.LoadOptions{Progress: progress})
+	for _, source := range sources {
+		source.Close()
+	}
+	if err == nil {
+		return tables, nil
+	}
 
-	case ".xlsx":
-		file, err := excelize.OpenFile(filePath)
-		if err != nil {
-			return nil, err
+	// Reword each failure in terms of its file
+	failures := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		failures = joined.Unwrap()
+	}
+	var errs []error
+	for _, err := range failures {
+		var loadErr *core.LoadError
+		if !errors.As(err, &loadErr) {
+			errs = append(errs, err)
+			continue
+		}
+		path := paths[loadErr.Index]
+		if openErr := sources[loadErr.Index].openErr; openErr != nil {
+			errs = append(errs, fmt.Errorf("failed to parse file '%s': %w", path, openErr))
+		} else {
+			errs = append(errs, fmt.Errorf("failed to load data from '%s': %w", path, loadErr.Err))
 		}
-		return parsers.NewXLSXSource(file)
-
-	default:
-		return nil, fmt.Errorf("unsupported file type: %s", ext)
 	}
+	return nil, errors.Join(errs...)
 }
 
 // formatOutput handles different output formats
 func formatOutput(format string, columns []string, rows [][]interface{}) error {
-	switch strings.ToLower(format) {
-	case "table":
+	if strings.ToLower(format) == "table" {
 		return outputTable(columns, rows)
-	case "json":
-		return outputJSON(columns, rows)
-	case "csv":
-		return outputCSV(columns, rows)
-	default:
-		return fmt.Errorf("unsupported output format: %s", format)
 	}
+
+	writer, err := writers.New(format, os.Stdout)
+	if err != nil {
+		return err
+	}
+	return writers.WriteAll(writer, columns, rows)
 }
 
 // outputTable renders results as a styled text table
@@ -205,46 +284,3 @@ func outputTable(columns []string, rows [][]interface{}) error {
 
 	return nil
 }
-
-// outputJSON renders results as JSON
-func outputJSON(columns []string, rows [][]interface{}) error {
-	// Convert to array of objects
-	result := make([]map[string]interface{}, len(rows))
-	for i, row := range rows {
-		obj := make(map[string]interface{})
-		for j, col := range columns {
-			if j < len(row) {
-				obj[col] = row[j]
-			}
-		}
-		result[i] = obj
-	}
-
-	jsonData, err := json.MarshalIndent(result, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	fmt.Println(string(jsonData))
-	return nil
-}
-
-// outputCSV renders results as CSV
-func outputCSV(columns []string, rows [][]interface{}) error {
-	writer := csv.NewWriter(os.Stdout)
-	defer writer.Flush()
-
-	// Write header
-	writer.Write(columns)
-
-	// Write rows
-	for _, row := range rows {
-		strRow := make([]string, len(row))
-		for i, val := range row {
-			strRow[i] = fmt.Sprintf("%v", val)
-		}
-		writer.Write(strRow)
-	}
-
-	return nil
-}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/zulfikawr/runsql/internal/core"
+	"github.com/zulfikawr/runsql/internal/parsers"
+	"github.com/zulfikawr/runsql/internal/ui"
+	"github.com/zulfikawr/runsql/internal/writers"
+)
+
+// ConvertConfig holds the arguments of the convert command
+type ConvertConfig struct {
+	Input   string   // Input file path
+	Output  string   // Output file path, or "-" for stdout
+	Format  string   // --to: Output format; detected from the output extension if empty
+	Select  string   // --select: Columns to keep, e.g. "id, name AS full_name"
+	Where   string   // --where: SQL expression rows must satisfy, e.g. "age > 30"
+	From    string   // --from: Input format; detected from the input extension or content if empty
+	Options []string // --option: Parser options as name=value, e.g. delimiter=; for CSV files
+}
+
+// Convert streams a file into another format, optionally keeping only some columns
+// and rows. The data is never loaded into a table.
+func Convert(config ConvertConfig) error {
+	if config.Input == "" || config.Output == "" {
+		return fmt.Errorf("input and output paths are required")
+	}
+
+	format, err := convertFormat(config)
+	if err != nil {
+		return err
+	}
+
+	columns, err := parseSelect(config.Select)
+	if err != nil {
+		return err
+	}
+
+	options, err := parsers.ParseOptions(config.Options)
+	if err != nil {
+		return err
+	}
+	source, closer, err := openFile(config.Input, config.From, options)
+	if err != nil {
+		return fmt.Errorf("failed to parse file '%s': %w", config.Input, err)
+	}
+	defer closer.Close()
+
+	out := os.Stdout
+	if config.Output != "-" {
+		out, err = os.Create(config.Output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+	}
+
+	writer, err := format.New(out)
+	if err == nil {
+		var rows int64
+		rows, err = core.Convert(source, writer, core.ConvertOptions{Columns: columns, Where: config.Where})
+		if closeErr := writer.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil && config.Output != "-" {
+			c := ui.Colors
+			fmt.Fprintf(os.Stderr, "%s✓%s Wrote %d rows to '%s'\n", c.Green, c.Reset, rows, config.Output)
+		}
+	}
+
+	if config.Output != "-" {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			// Don't leave a truncated file behind
+			os.Remove(config.Output)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to convert '%s': %w", config.Input, err)
+	}
+	return nil
+}
+
+// convertFormat picks the output format from the --to flag or the output file extension
+func convertFormat(config ConvertConfig) (writers.Format, error) {
+	if config.Format != "" {
+		return writers.Lookup(config.Format)
+	}
+	if config.Output == "-" {
+		return writers.Format{}, fmt.Errorf("output format is required when writing to stdout (--to)")
+	}
+	return writers.ForPath(config.Output)
+}
+
+var aliasRegex = regexp.MustCompile(`(?i)^(.+?)\s+as\s+(.+)$`)
+
+// parseSelect parses a comma-separated column list where each column may be
+// renamed with AS, e.g. `id, "first name" AS first_name`
+func parseSelect(spec string) ([]core.ColumnSelection, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	var columns []core.ColumnSelection
+	for item := range strings.SplitSeq(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, fmt.Errorf("invalid column list %q: empty column", spec)
+		}
+
+		col := core.ColumnSelection{Name: item}
+		if m := aliasRegex.FindStringSubmatch(item); m != nil {
+			col = core.ColumnSelection{Name: strings.TrimSpace(m[1]), Alias: strings.TrimSpace(m[2])}
+		}
+		col.Name = unquoteIdentifier(col.Name)
+		col.Alias = unquoteIdentifier(col.Alias)
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+// unquoteIdentifier strips SQL double quotes from a column name
+func unquoteIdentifier(name string) string {
+	if len(name) >= 2 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+	return name
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zulfikawr/runsql/internal/core"
+	"github.com/zulfikawr/runsql/internal/ui"
+)
+
+// ExportDBConfig holds the arguments of the export-db command
+type ExportDBConfig struct {
+	FilePaths  []string // -f: File paths (comma separated), globs or directories
+	Union      bool     // --union: Load the files of each glob or directory into one table
+	Format     string   // --format: Input format of every file, detected from its extension or content if empty
+	Options    []string // --option: Parser options as name=value, e.g. delimiter=; for CSV files
+	DBPath     string   // --db: Start from the tables of this database file
+	Query      string   // -q: SQL query whose result is saved as a table
+	Table      string   // --as: Name of the table holding the query result
+	ScriptPath string   // -Q: SQL script run before exporting, e.g. to create tables
+	Params     []string // -p: Query parameters as name=value or name:type=value
+	Output     string   // Path of the database file to write
+	Cache      CacheOptions
+}
+
+// openEngine creates an in-memory engine, or opens the database file given with --db,
+// and sets up its load cache
+func openEngine(dbPath string, cacheOptions CacheOptions) (*core.Engine, error) {
+	var engine *core.Engine
+	var err error
+	if dbPath == "" {
+		if engine, err = core.NewEngine(); err != nil {
+			return nil, fmt.Errorf("failed to create engine: %w", err)
+		}
+	} else {
+		if engine, err = core.OpenEngine(dbPath); err != nil {
+			return nil, err
+		}
+		c := ui.Colors
+		fmt.Fprintf(os.Stderr, "%s✓%s Opened database '%s'\n", c.Green, c.Reset, dbPath)
+	}
+
+	if cacheOptions.Enabled {
+		cache, err := newLoadCache(cacheOptions)
+		if err != nil {
+			engine.Close()
+			return nil, err
+		}
+		engine.UseCache(cache)
+	}
+	return engine, nil
+}
+
+// loadTables loads the -f entries into the engine and returns their tables, unioning
+// the files of each pattern or directory if union is set and reading them with the
+// --format and --option values. Without entries, it returns every table already in the
+// engine's database.
+func loadTables(engine *core.Engine, entries []string, union bool, format string, options []string) ([]string, error) {
+	if len(entries) == 0 {
+		return engine.Tables()
+	}
+	inputs, err := expandInputs(entries, union, format, options)
+	if err != nil {
+		return nil, err
+	}
+	return loadFiles(engine, inputs)
+}
+
+// parseParams parses --param values into query arguments
+func parseParams(specs []string) ([]interface{}, error) {
+	params := make([]core.Param, len(specs))
+	for i, spec := range specs {
+		param, err := core.ParseParam(spec)
+		if err != nil {
+			return nil, err
+		}
+		params[i] = param
+	}
+	return core.BindArgs(params)
+}
+
+// ExportDB loads the files, optionally saves a query result as a table, and writes
+// every table to a standalone SQLite database file
+func ExportDB(config ExportDBConfig) error {
+	if config.Output == "" {
+		return fmt.Errorf("output database path is required")
+	}
+	if len(config.FilePaths) == 0 && config.DBPath == "" {
+		return fmt.Errorf("file path is required (-f or --db)")
+	}
+	if config.DBPath != "" && samePath(config.DBPath, config.Output) {
+		return fmt.Errorf("the output must be a different file from --db")
+	}
+	if config.Table == "" {
+		config.Table = "result"
+	}
+
+	args, err := parseParams(config.Params)
+	if err != nil {
+		return err
+	}
+
+	var script string
+	if config.ScriptPath != "" {
+		if script, err = readScript(config.ScriptPath); err != nil {
+			return err
+		}
+	}
+
+	engine, err := openEngine(config.DBPath, config.Cache)
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+
+	if _, err := loadTables(engine, config.FilePaths, config.Union, config.Format, config.Options); err != nil {
+		return err
+	}
+
+	c := ui.Colors
+	if script != "" {
+		results, err := engine.RunScript(script, args...)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s✓%s Ran %s\n", c.Green, c.Reset, pluralize(len(results), "statement"))
+	}
+
+	if config.Query != "" {
+		if err := engine.SaveQuery(config.Table, config.Query, args...); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s✓%s Saved query result as table '%s'\n", c.Green, c.Reset, config.Table)
+	}
+
+	if err := engine.Export(config.Output); err != nil {
+		return err
+	}
+
+	tables, err := engine.Tables()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s✓%s Wrote %s (%s) to '%s'\n", c.Green, c.Reset,
+		pluralize(len(tables), "table"), strings.Join(tables, ", "), config.Output)
+	return nil
+}
+
+// samePath reports whether two paths refer to the same file
+func samePath(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA == nil && errB == nil {
+		return os.SameFile(infoA, infoB)
+	}
+	absA, _ := filepath.Abs(a)
+	absB, _ := filepath.Abs(b)
+	return absA == absB
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zulfikawr/runsql/internal/core"
+	"github.com/zulfikawr/runsql/internal/ui"
+)
+
+// DescribeConfig holds the arguments of the describe command
+type DescribeConfig struct {
+	FilePaths []string // -f: File paths (comma separated), globs or directories
+	Union     bool     // --union: Load the files of each glob or directory into one table
+	Format    string   // --format: Input format of every file, detected from its extension or content if empty
+	Options   []string // --option: Parser options as name=value, e.g. delimiter=; for CSV files
+	DBPath    string   // --db: SQLite database file, whose tables are used if no file is given
+	Table     string   // -t: Only describe this table
+	OutputFmt string   // -o: Output format (table, json)
+	Cache     CacheOptions
+}
+
+// tableDescription is the JSON form of a described table
+type tableDescription struct {
+	Name     string              `json:"name"`
+	RowCount int64               `json:"row_count"`
+	Columns  []columnDescription `json:"columns"`
+}
+
+type columnDescription struct {
+	Name           string        `json:"name"`
+	Type           string        `json:"type"`
+	Nullable       bool          `json:"nullable"`
+	Distinct       int64         `json:"distinct"`
+	DistinctApprox bool          `json:"distinct_approx,omitempty"`
+	Min            interface{}   `json:"min"`
+	Max            interface{}   `json:"max"`
+	Samples        []interface{} `json:"samples"`
+}
+
+// Describe loads the files and prints the schema of each table without running a query
+func Describe(config DescribeConfig) error {
+	if len(config.FilePaths) == 0 && config.DBPath == "" {
+		return fmt.Errorf("file path is required (-f)")
+	}
+
+	engine, err := openEngine(config.DBPath, config.Cache)
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+
+	tableNames, err := loadTables(engine, config.FilePaths, config.Union, config.Format, config.Options)
+	if err != nil {
+		return err
+	}
+	if config.Table != "" {
+		tableNames = []string{config.Table}
+	}
+
+	tables := make([]core.Table, 0, len(tableNames))
+	for _, name := range tableNames {
+		table, err := engine.DescribeTable(name)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, table)
+	}
+
+	switch strings.ToLower(config.OutputFmt) {
+	case "", "table":
+		return outputDescriptions(tables)
+	case "json":
+		descriptions := make([]tableDescription, len(tables))
+		for i, table := range tables {
+			descriptions[i] = describeTable(table)
+		}
+		data, err := json.MarshalIndent(descriptions, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format for describe: %s (use table or json)", config.OutputFmt)
+	}
+}
+
+func describeTable(table core.Table) tableDescription {
+	desc := tableDescription{Name: table.Name, RowCount: table.RowCount}
+	for i, col := range table.Columns {
+		column := columnDescription{Name: col, Type: table.Types[i], Samples: []interface{}{}}
+		if i < len(table.Stats) {
+			stats := table.Stats[i]
+			column.Nullable = stats.Nullable
+			column.Distinct = stats.Distinct
+			column.DistinctApprox = stats.DistinctApprox
+			column.Min = stats.Min
+			column.Max = stats.Max
+			if stats.Samples != nil {
+				column.Samples = stats.Samples
+			}
+		}
+		desc.Columns = append(desc.Columns, column)
+	}
+	return desc
+}
+
+// outputDescriptions renders each table schema as a styled text table, one row per column
+func outputDescriptions(tables []core.Table) error {
+	c := ui.Colors
+	columns := []string{"column", "type", "nullable", "distinct", "min", "max", "samples"}
+
+	for i, table := range tables {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s%s%s%s (%d rows)\n", c.Cyan, c.Bold, table.Name, c.Reset, table.RowCount)
+
+		desc := describeTable(table)
+		rows := make([][]interface{}, len(desc.Columns))
+		for j, col := range desc.Columns {
+			samples := make([]string, len(col.Samples))
+			for k, v := range col.Samples {
+				samples[k] = truncate(formatProfileValue(v), 20)
+			}
+			var distinct interface{} = col.Distinct
+			if col.DistinctApprox {
+				distinct = fmt.Sprintf("~%d", col.Distinct)
+			}
+			rows[j] = []interface{}{
+				col.Name,
+				col.Type,
+				col.Nullable,
+				distinct,
+				truncate(formatProfileValue(col.Min), 20),
+				truncate(formatProfileValue(col.Max), 20),
+				strings.Join(samples, ", "),
+			}
+		}
+
+		if err := outputTable(columns, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zulfikawr/runsql/internal/core"
+)
+
+// FunctionsConfig holds the arguments of the functions command
+type FunctionsConfig struct {
+	OutputFmt string // -o: Output format (table, json)
+}
+
+// Functions prints the SQL functions that runsql adds to SQLite
+func Functions(config FunctionsConfig) error {
+	functions := core.Functions()
+
+	switch strings.ToLower(config.OutputFmt) {
+	case "", "table":
+		rows := make([][]interface{}, len(functions))
+		for i, f := range functions {
+			kind := "scalar"
+			if f.Aggregate {
+				kind = "aggregate"
+			}
+			rows[i] = []interface{}{f.Signature, kind, f.Description}
+		}
+		return outputTable([]string{"function", "kind", "description"}, rows)
+	case "json":
+		data, err := json.MarshalIndent(functions, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format for functions: %s (use table or json)", config.OutputFmt)
+	}
+}
@@ -0,0 +1,365 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/zulfikawr/runsql/internal/core"
+	"github.com/zulfikawr/runsql/internal/parsers"
+	"github.com/zulfikawr/runsql/internal/ui"
+)
+
+// input is a table to load, from a single file or, with --union, from several
+type input struct {
+	name  string // The file, or the pattern or directory whose files are unioned
+	table string
+	paths []string
+	union bool // Whether paths are unioned into one table, even if there is only one
+	alias bool // Whether the table was named with alias=path
+
+	format  string          // --format: Format of every file, detected if empty
+	options parsers.Options // --option values, passed to the parser of each file
+
+	// A partitioned directory has the keys of its partitions and, for each path, their values
+	keys       []string
+	partitions [][]interface{}
+	skipped    int // Partitions left out because the query can't match them
+}
+
+// expandInputs resolves the -f entries into the tables to load. An entry may be a file,
+// a glob pattern such as logs/events-*.csv, or a directory, which stands for the files
+// in it with a supported extension. Matched files are taken in name order and each is
+// loaded into its own table, unless union is set: then the files matched by a pattern or
+// directory are loaded into a single table named after it. A directory partitioned the
+// Hive way, as in data/year=2025/month=03/part.csv, is always loaded into one table.
+//
+// An entry written as alias=path names its table. Other tables are named after their
+// files; when two would get the same name, the later one gets a numbered name instead,
+// with a warning. Every file is read in the format given with --format, if any, and
+// with the parser options given with --option.
+func expandInputs(entries []string, union bool, format string, optionValues []string) ([]input, error) {
+	if format != "" {
+		if _, err := parsers.Lookup(format); err != nil {
+			return nil, err
+		}
+	}
+	options, err := parsers.ParseOptions(optionValues)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []input
+	for _, entry := range entries {
+		alias, entry, err := core.SplitAlias(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		var expanded []input
+		if isPartitioned(entry) {
+			in, err := partitionedInput(entry)
+			if err != nil {
+				return nil, err
+			}
+			expanded = []input{in}
+		} else {
+			paths, multiple, err := expandEntry(entry)
+			if err != nil {
+				return nil, err
+			}
+
+			if union && multiple {
+				expanded = []input{{name: entry, table: unionTableName(entry), paths: paths, union: true}}
+			} else {
+				for _, path := range paths {
+					expanded = append(expanded, input{name: path, table: core.FileTableName(path), paths: []string{path}})
+				}
+			}
+		}
+		for i := range expanded {
+			expanded[i].format, expanded[i].options = format, options
+		}
+
+		if alias != "" {
+			if len(expanded) > 1 {
+				return nil, fmt.Errorf("%s matches %d files and can't be loaded as table %s; use --union to load them into one table", entry, len(expanded), alias)
+			}
+			expanded[0].table, expanded[0].alias = alias, true
+		}
+		inputs = append(inputs, expanded...)
+	}
+
+	// Aliases are claimed first, so that they keep their names whatever their position
+	namer := core.NewTableNamer()
+	for _, in := range inputs {
+		if in.alias && !namer.Claim(in.table) {
+			return nil, fmt.Errorf("table name %s is given to more than one input", in.table)
+		}
+	}
+	c := ui.Colors
+	for i := range inputs {
+		in := &inputs[i]
+		if in.alias {
+			continue
+		}
+		if table := namer.Unique(in.table); table != in.table {
+			fmt.Fprintf(os.Stderr, "%s! Table %s is already taken, loading '%s' as %s (name it with alias=path)%s\n",
+				c.Yellow, in.table, in.name, table, c.Reset)
+			in.table = table
+		}
+	}
+	return inputs, nil
+}
+
+// expandEntry returns the files an -f entry stands for, and whether it is a pattern or
+// directory rather than a single file
+func expandEntry(entry string) ([]string, bool, error) {
+	if strings.ContainsAny(entry, "*?[") {
+		paths, err := filepath.Glob(entry)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid pattern %s: %w", entry, err)
+		}
+		// Subdirectories matched by the pattern are skipped
+		paths = slices.DeleteFunc(paths, func(path string) bool {
+			info, err := os.Stat(path)
+			return err == nil && info.IsDir()
+		})
+		if len(paths) == 0 {
+			return nil, false, fmt.Errorf("no files match %s", entry)
+		}
+		return paths, true, nil
+	}
+
+	info, err := os.Stat(entry)
+	if err != nil || !info.IsDir() {
+		// A missing file is reported when it's loaded
+		return []string{entry}, false, nil
+	}
+
+	dirEntries, err := os.ReadDir(entry)
+	if err != nil {
+		return nil, false, err
+	}
+	var paths []string
+	for _, d := range dirEntries {
+		if !d.IsDir() && supportedFile(d.Name()) {
+			paths = append(paths, filepath.Join(entry, d.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, false, fmt.Errorf("no supported files in directory %s", entry)
+	}
+	return paths, true, nil
+}
+
+// supportedFile reports whether a file found in a directory given to -f has the
+// extension of a registered format
+func supportedFile(name string) bool {
+	return slices.Contains(parsers.Extensions(), strings.ToLower(filepath.Ext(name)))
+}
+
+// isPartitioned reports whether a path is a directory with key=value subdirectories
+func isPartitioned(path string) bool {
+	dirEntries, err := os.ReadDir(path)
+	if err != nil {
+		return false
+	}
+	for _, d := range dirEntries {
+		if d.IsDir() && !hiddenFile(d.Name()) && strings.Contains(d.Name(), "=") {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenFile reports whether a file or directory of a dataset is skipped, like the
+// _SUCCESS markers and .crc files written next to the data
+func hiddenFile(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// partitionedInput reads every supported file under a Hive-partitioned directory. The
+// key=value directories on the way to each file give the values of its partition keys,
+// which become columns of the table; a key missing from a path is NULL.
+func partitionedInput(dir string) (input, error) {
+	in := input{name: dir, table: unionTableName(dir), union: true}
+	keyIndex := make(map[string]int)
+	var raw [][]string
+
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && hiddenFile(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !supportedFile(path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		values := make([]string, len(in.keys))
+		for _, segment := range strings.Split(filepath.ToSlash(rel), "/") {
+			key, value, ok := strings.Cut(segment, "=")
+			if !ok || key == "" {
+				continue
+			}
+			if unescaped, err := url.PathUnescape(value); err == nil {
+				value = unescaped
+			}
+			i, seen := keyIndex[key]
+			if !seen {
+				i = len(in.keys)
+				keyIndex[key] = i
+				in.keys = append(in.keys, key)
+				values = append(values, "")
+			}
+			values[i] = value
+		}
+		in.paths = append(in.paths, path)
+		raw = append(raw, values)
+		return nil
+	})
+	if err != nil {
+		return input{}, err
+	}
+	if len(in.paths) == 0 {
+		return input{}, fmt.Errorf("no supported files in directory %s", dir)
+	}
+
+	// Paths found before a key was first seen don't have it
+	for i := range raw {
+		raw[i] = append(raw[i], make([]string, len(in.keys)-len(raw[i]))...)
+	}
+	in.partitions = core.PartitionColumns(raw)
+	return in, nil
+}
+
+// skipPartitions leaves out the partitions of partitioned inputs that the query's WHERE
+// clause can't match, so that their files aren't parsed. One partition is always kept,
+// so that the table still has its columns.
+func skipPartitions(inputs []input, query string) {
+	for i := range inputs {
+		in := &inputs[i]
+		if len(in.keys) == 0 {
+			continue
+		}
+		filter := core.NewPartitionFilter(query, in.table, in.keys)
+		if filter == nil {
+			continue
+		}
+
+		var paths []string
+		var partitions [][]interface{}
+		for j, values := range in.partitions {
+			if filter.Match(values) {
+				paths = append(paths, in.paths[j])
+				partitions = append(partitions, values)
+			}
+		}
+		if len(paths) == 0 {
+			paths, partitions = in.paths[:1], in.partitions[:1]
+		}
+		in.skipped = len(in.paths) - len(paths)
+		in.paths, in.partitions = paths, partitions
+	}
+}
+
+// skipUnreferenced leaves out the inputs whose tables the query or script doesn't
+// name, so that their files aren't parsed unless the query uses them after all, and
+// returns the inputs left out.
+func skipUnreferenced(inputs []input, sql string) (kept, skipped []input) {
+	refs := core.FindTableRefs(sql)
+	for _, in := range inputs {
+		if refs.Has(in.table) {
+			kept = append(kept, in)
+		} else {
+			skipped = append(skipped, in)
+		}
+	}
+	return kept, skipped
+}
+
+// unionTableName derives a table name from a pattern or directory: the file name of the
+// pattern without its extension and wildcards, e.g. events_2025 for events-2025-*.csv, or
+// the name of the directory
+func unionTableName(entry string) string {
+	clean := filepath.Clean(entry)
+	if info, err := os.Stat(clean); err == nil && info.IsDir() {
+		if abs, err := filepath.Abs(clean); err == nil {
+			clean = abs
+		}
+		return core.TableName(filepath.Base(clean))
+	}
+
+	base := filepath.Base(clean)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	var sb strings.Builder
+	inClass := false
+	for _, r := range base {
+		switch {
+		case r == '[':
+			inClass = true
+		case r == ']':
+			inClass = false
+		case !inClass && r != '*' && r != '?':
+			sb.WriteRune(r)
+		}
+	}
+	if strings.Trim(sb.String(), "_-. ") == "" {
+		// A pattern like *.csv is named after its directory
+		return unionTableName(filepath.Dir(clean))
+	}
+	return core.TableName(sb.String())
+}
+
+// fileFormat returns the format a file is read in: the named one, given with --format,
+// or the one detected from the file's extension or content
+func fileFormat(path, name string) (parsers.Format, error) {
+	if name != "" {
+		return parsers.Lookup(name)
+	}
+	return parsers.DetectFile(path)
+}
+
+// openFile opens a file in the format chosen by fileFormat, see parsers.Open
+func openFile(path, format string, options parsers.Options) (parsers.Source, io.Closer, error) {
+	f, err := fileFormat(path, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f.Open(path, options)
+}
+
+// unionSource returns the source of an input loaded from several files into one table,
+// with a parsers.SourceFileColumn column holding the file of each row. The io.Closer
+// closes every file once the source has been read.
+func unionSource(in input) (parsers.Source, io.Closer, error) {
+	sources := make([]parsers.Source, len(in.paths))
+	closers := make([]io.Closer, len(in.paths))
+	for i, path := range in.paths {
+		source, closer, err := openFile(path, in.format, in.options)
+		if err != nil {
+			parsers.Closers(closers...).Close()
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		sources[i], closers[i] = source, closer
+	}
+	source, err := parsers.NewPartitionedSource(in.paths, sources, in.keys, in.partitions)
+	if err != nil {
+		parsers.Closers(closers...).Close()
+		return nil, nil, err
+	}
+	return source, parsers.Closers(closers...), nil
+}
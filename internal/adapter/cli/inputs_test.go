@@ -0,0 +1,341 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/runsql/internal/core"
+)
+
+// writeFiles creates the files under dir, with their parent directories
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// describeInputs lists each input as table:files, with the files relative to dir
+func describeInputs(t *testing.T, dir string, inputs []input) string {
+	t.Helper()
+	var described []string
+	for _, in := range inputs {
+		var paths []string
+		for _, path := range in.paths {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		described = append(described, in.table+":"+strings.Join(paths, "+"))
+	}
+	return strings.Join(described, " ")
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"users.csv":                "id\n1\n",
+		"logs/events-2025-01.csv":  "id\n1\n",
+		"logs/events-2025-02.json": `[{"id": 2}]`,
+		"logs/notes.txt":           "not data",
+		"logs/old/events-2024.csv": "id\n0\n",
+		"empty/notes.txt":          "not data",
+	})
+	at := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		name    string
+		entries []string
+		union   bool
+		want    string // table:files of each input, or the start of the error
+	}{
+		{"file", []string{at("users.csv")}, false, "users:users.csv"},
+		{"missing file", []string{at("missing.csv")}, false, "missing:missing.csv"},
+		{"pattern", []string{at("logs/events-*")}, false, "events_2025_01:logs/events-2025-01.csv events_2025_02:logs/events-2025-02.json"},
+		{"pattern union", []string{at("logs/events-*")}, true, "events:logs/events-2025-01.csv+logs/events-2025-02.json"},
+		{"pattern of one file", []string{at("logs/events-*-01.csv")}, true, "events_01:logs/events-2025-01.csv"},
+		{"directory", []string{at("logs")}, false, "events_2025_01:logs/events-2025-01.csv events_2025_02:logs/events-2025-02.json"},
+		{"directory union", []string{at("logs/")}, true, "logs:logs/events-2025-01.csv+logs/events-2025-02.json"},
+		{"extension pattern union", []string{at("logs/*.csv")}, true, "logs:logs/events-2025-01.csv"},
+		{"no match", []string{at("logs/*.parquet")}, false, "no files match"},
+		{"bad pattern", []string{at("logs/[")}, false, "invalid pattern"},
+		{"no supported files", []string{at("empty")}, false, "no supported files"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs, err := expandInputs(tt.entries, tt.union, "", nil)
+			if err != nil {
+				if !strings.HasPrefix(err.Error(), tt.want) {
+					t.Errorf("expected %q, got error %v", tt.want, err)
+				}
+				return
+			}
+			if got := describeInputs(t, dir, inputs); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			for _, in := range inputs {
+				if in.union != tt.union || len(in.keys) != 0 {
+					t.Errorf("%s: unexpected union %v with keys %v", in.table, in.union, in.keys)
+				}
+			}
+		})
+	}
+}
+
+func TestInputTableNames(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a/users.csv":   "id\n1\n",
+		"b/users.csv":   "id\n2\n",
+		"c/users.json":  `[{"id": 3}]`,
+		"orders.csv":    "id\n1\n",
+		"year=2025.csv": "id\n1\n",
+	})
+	at := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		name    string
+		entries []string
+		want    string // table:files of each input, or the start of the error
+	}{
+		{"numbered renames", []string{at("a/users.csv"), at("b/users.csv"), at("c/users.json")},
+			"users:a/users.csv users_2:b/users.csv users_3:c/users.json"},
+		{"case-insensitive collision", []string{at("a/users.csv"), "Users=" + at("orders.csv")},
+			"users_2:a/users.csv Users:orders.csv"},
+		{"alias claimed first", []string{at("a/users.csv"), "users=" + at("b/users.csv")},
+			"users_2:a/users.csv users:b/users.csv"},
+		{"alias of a pattern", []string{"u=" + at("a/*.csv")}, "u:a/users.csv"},
+		{"renamed name taken", []string{at("a/users.csv"), at("b/users.csv"), "users_2=" + at("orders.csv")},
+			"users:a/users.csv users_3:b/users.csv users_2:orders.csv"},
+		{"path with =", []string{at("year=2025.csv")}, "year_2025:year=2025.csv"},
+		{"alias given twice", []string{"t=" + at("orders.csv"), "T=" + at("a/users.csv")},
+			"table name T is given to more than one input"},
+		{"alias of several files", []string{"u=" + at("*/users.*")}, "matches 3 files and can't be loaded as table u"},
+		{"invalid alias", []string{"select=" + at("orders.csv")}, "table name \"select\" is an SQL keyword"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs, err := expandInputs(tt.entries, false, "", nil)
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("expected %q, got error %v", tt.want, err)
+				}
+				return
+			}
+			if got := describeInputs(t, dir, inputs); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUnionTableName(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"sales 2025/a.csv": "id\n1\n"})
+	t.Chdir(dir)
+
+	tests := []struct {
+		entry string
+		want  string
+	}{
+		{"logs/events-2025-*.csv", "events_2025"},
+		{"logs/events-[0-9][0-9].csv", "events"},
+		{"logs/*.csv", "logs"},
+		{"logs/*", "logs"},
+		{"data/2025/??.json", "t_2025"},
+		{"sales 2025", "sales_2025"},
+		{"sales 2025/", "sales_2025"},
+		{"sales 2025/*.csv", "sales_2025"},
+	}
+	for _, tt := range tests {
+		if got := unionTableName(tt.entry); got != tt.want {
+			t.Errorf("unionTableName(%q) = %q, want %q", tt.entry, got, tt.want)
+		}
+	}
+
+	// The current directory is named after its path
+	t.Chdir("sales 2025")
+	for _, entry := range []string{".", "*.csv", "./*"} {
+		if got := unionTableName(entry); got != "sales_2025" {
+			t.Errorf("unionTableName(%q) = %q, want sales_2025", entry, got)
+		}
+	}
+}
+
+func TestPartitionedInput(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"region=eu%2Fwest/a.csv":                       "v\n1\n",
+		"year=2025/month=01/b.csv":                     "v\n2\n",
+		"year=2025/month=11/c.json":                    `[{"v": 3}]`,
+		"year=2025/d.csv":                              "v\n4\n",
+		"year=" + core.HiveDefaultPartition + "/e.csv": "v\n5\n",
+		"year=2025/_SUCCESS":                           "",
+		"year=2025/month=01/.b.csv.crc":                "",
+		"year=2025/month=01/notes.txt":                 "not data",
+		"_temporary/year=2026/f.csv":                   "v\n6\n",
+		".staging/year=2026/g.csv":                     "v\n7\n",
+	})
+	if !isPartitioned(dir) || isPartitioned(filepath.Join(dir, "year=2025", "month=01")) {
+		t.Fatal("Expected only the top directory to be partitioned")
+	}
+
+	in, err := partitionedInput(dir)
+	if err != nil {
+		t.Fatalf("partitionedInput failed: %v", err)
+	}
+	if !in.union || in.table != unionTableName(dir) {
+		t.Errorf("Unexpected input %s (union %v)", in.table, in.union)
+	}
+	if got := strings.Join(in.keys, ","); got != "region,year,month" {
+		t.Errorf("Unexpected keys: %s", got)
+	}
+
+	// Keys missing from a path are NULL, like the default partition; values are unescaped
+	// and typed by the values of all partitions
+	want := []string{
+		"region=eu%2Fwest/a.csv [eu/west <nil> <nil>]",
+		"year=2025/d.csv [<nil> 2025 <nil>]",
+		"year=2025/month=01/b.csv [<nil> 2025 1]",
+		"year=2025/month=11/c.json [<nil> 2025 11]",
+		"year=" + core.HiveDefaultPartition + "/e.csv [<nil> <nil> <nil>]",
+	}
+	var got []string
+	for i, path := range in.paths {
+		rel, _ := filepath.Rel(dir, path)
+		got = append(got, fmt.Sprintf("%s %v", filepath.ToSlash(rel), in.partitions[i]))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected partitions:\n%s", strings.Join(got, "\n"))
+	}
+
+	if _, err := partitionedInput(filepath.Join(dir, "year=2025", "month=01", "notes.txt")); err == nil {
+		t.Error("Expected an error for a directory without supported files")
+	}
+}
+
+func TestSkipPartitions(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"sales/year=2024/part.csv":           "amount\n10\n20\n",
+		"sales/year=2025/part.csv":           "amount\n30\n",
+		"sales/year=2025/region=eu/part.csv": "amount\n40\n",
+		"codes/code=abc/part.csv":            "v\n1\n",
+	}
+	// More rows than types are inferred from, so that only the type of every partition
+	// value keeps code=007 as text
+	codes := "v\n"
+	for i := 0; i < 150; i++ {
+		codes += fmt.Sprintf("%d\n", i)
+	}
+	files["codes/code=007/part.csv"] = codes
+	writeFiles(t, dir, files)
+
+	// query loads the partitioned directory, leaving out the partitions the query can't
+	// match if skip is set, and returns the result of the query
+	query := func(entry, sql string, skip bool) (string, []string) {
+		t.Helper()
+		inputs, err := expandInputs([]string{filepath.Join(dir, entry)}, false, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if skip {
+			skipPartitions(inputs, sql)
+		}
+		var kept []string
+		for _, path := range inputs[0].paths {
+			rel, _ := filepath.Rel(dir, path)
+			kept = append(kept, filepath.ToSlash(filepath.Dir(rel)))
+		}
+
+		engine, err := core.NewEngine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer engine.Close()
+		if _, err := loadFiles(engine, inputs); err != nil {
+			t.Fatal(err)
+		}
+		_, rows, err := engine.Query(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		return fmt.Sprint(rows), kept
+	}
+
+	tests := []struct {
+		entry string
+		sql   string
+		kept  string // Partition directories kept, or "all"
+	}{
+		{"sales", "SELECT sum(amount) FROM sales WHERE year = 2025", "sales/year=2025 sales/year=2025/region=eu"},
+		{"sales", "SELECT sum(amount) FROM sales WHERE region = 'eu'", "sales/year=2025/region=eu"},
+		{"sales", "SELECT sum(amount) FROM sales WHERE region IS NULL", "all"},
+		{"sales", "SELECT count(*) FROM sales WHERE year = 2023", "sales/year=2024"},
+		{"sales", "SELECT count(*), (SELECT count(*) FROM sales) FROM sales WHERE year = 2024", "all"},
+		{"sales", "SELECT * FROM sales WHERE year = 2024 AND amount IN (SELECT amount FROM sales WHERE year = 2025)", "all"},
+		{"codes", "SELECT count(*) FROM codes WHERE code IN (7, 'abc')", "codes/code=abc"},
+		{"codes", "SELECT count(*) FROM codes WHERE code = '007'", "codes/code=007"},
+	}
+	for _, tt := range tests {
+		want, all := query(tt.entry, tt.sql, false)
+		got, kept := query(tt.entry, tt.sql, true)
+		if got != want {
+			t.Errorf("%s: got %s with partitions skipped, %s without", tt.sql, got, want)
+		}
+		keptPartitions := strings.Join(kept, " ")
+		if len(kept) == len(all) {
+			keptPartitions = "all"
+		}
+		if keptPartitions != tt.kept {
+			t.Errorf("%s: kept %s, want %s", tt.sql, keptPartitions, tt.kept)
+		}
+	}
+}
+
+func TestSkipUnreferenced(t *testing.T) {
+	inputs := []input{{table: "users"}, {table: "orders"}, {table: "order_items"}, {table: "Events"}}
+
+	tests := []struct {
+		sql     string
+		kept    string
+		skipped string
+	}{
+		{"SELECT * FROM users", "users", "orders order_items Events"},
+		{"SELECT * FROM users u JOIN orders o ON o.user_id = u.id", "users orders", "order_items Events"},
+		{"SELECT count(*) FROM events", "Events", "users orders order_items"},
+		{"SELECT * FROM pragma_table_info('users') -- FROM orders", "users", "orders order_items Events"},
+		{"SELECT * FROM orders_2025", "", "users orders order_items Events"},
+		{"CREATE TEMP TABLE t AS SELECT * FROM order_items; SELECT * FROM t", "order_items", "users orders Events"},
+		{"SELECT name FROM sqlite_master", "users orders order_items Events", ""},
+	}
+	for _, tt := range tests {
+		kept, skipped := skipUnreferenced(inputs, tt.sql)
+		if got := tables(kept); got != tt.kept {
+			t.Errorf("%s: kept %q, want %q", tt.sql, got, tt.kept)
+		}
+		if got := tables(skipped); got != tt.skipped {
+			t.Errorf("%s: skipped %q, want %q", tt.sql, got, tt.skipped)
+		}
+	}
+}
+
+// tables lists the tables of the inputs
+func tables(inputs []input) string {
+	var names []string
+	for _, in := range inputs {
+		names = append(names, in.table)
+	}
+	return strings.Join(names, " ")
+}
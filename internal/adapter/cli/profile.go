@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zulfikawr/runsql/internal/core"
+	"github.com/zulfikawr/runsql/internal/ui"
+)
+
+// ProfileConfig holds the arguments of the profile command
+type ProfileConfig struct {
+	FilePaths []string // -f: File paths (comma separated), globs or directories
+	Union     bool     // --union: Load the files of each glob or directory into one table
+	Format    string   // --format: Input format of every file, detected from its extension or content if empty
+	Options   []string // --option: Parser options as name=value, e.g. delimiter=; for CSV files
+	DBPath    string   // --db: SQLite database file, whose tables are used if no file is given
+	Table     string   // -t: Only profile this table
+	OutputFmt string   // -o: Output format (table, json)
+	TopN      int      // -top: Number of most frequent values per column
+	Cache     CacheOptions
+}
+
+// Profile loads the files and prints per-column statistics for each table
+func Profile(config ProfileConfig) error {
+	if len(config.FilePaths) == 0 && config.DBPath == "" {
+		return fmt.Errorf("file path is required (-f)")
+	}
+
+	engine, err := openEngine(config.DBPath, config.Cache)
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+
+	tables, err := loadTables(engine, config.FilePaths, config.Union, config.Format, config.Options)
+	if err != nil {
+		return err
+	}
+	if config.Table != "" {
+		tables = []string{config.Table}
+	}
+
+	profiles := make([]core.TableProfile, 0, len(tables))
+	for _, table := range tables {
+		profile, err := engine.Profile(table, config.TopN)
+		if err != nil {
+			return fmt.Errorf("failed to profile table '%s': %w", table, err)
+		}
+		profiles = append(profiles, profile)
+	}
+
+	switch strings.ToLower(config.OutputFmt) {
+	case "", "table":
+		return outputProfiles(profiles)
+	case "json":
+		data, err := json.MarshalIndent(profiles, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format for profile: %s (use table or json)", config.OutputFmt)
+	}
+}
+
+// outputProfiles renders each table profile as a styled text table, one row per column
+func outputProfiles(profiles []core.TableProfile) error {
+	c := ui.Colors
+	columns := []string{"column", "type", "null %", "distinct", "min", "max", "mean", "stddev", "top values", "length (min/p50/p90/max)", "patterns"}
+
+	for i, profile := range profiles {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s%s%s%s (%d rows)\n", c.Cyan, c.Bold, profile.Table, c.Reset, profile.RowCount)
+
+		rows := make([][]interface{}, len(profile.Columns))
+		for j, col := range profile.Columns {
+			rows[j] = []interface{}{
+				col.Name,
+				col.Type,
+				fmt.Sprintf("%.1f", col.NullPercent),
+				col.Distinct,
+				truncate(formatProfileValue(col.Min), 20),
+				truncate(formatProfileValue(col.Max), 20),
+				formatOptionalFloat(col.Mean),
+				formatOptionalFloat(col.StdDev),
+				formatTopValues(col.TopValues),
+				fmt.Sprintf("%d/%d/%d/%d", col.Lengths.Min, col.Lengths.P50, col.Lengths.P90, col.Lengths.Max),
+				formatPatterns(col.Patterns),
+			}
+		}
+
+		if err := outputTable(columns, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatProfileValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func formatOptionalFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.4g", *v)
+}
+
+func formatTopValues(values []core.ValueCount) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%s (%d)", truncate(formatProfileValue(v.Value), 20), v.Count)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatPatterns(patterns []core.PatternCount) string {
+	parts := make([]string, len(patterns))
+	for i, p := range patterns {
+		parts[i] = fmt.Sprintf("%s %.0f%%", truncate(p.Pattern, 30), p.Percent)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// truncate shortens a string to at most n runes, marking the cut with "..."
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/runsql/internal/core"
+	"github.com/zulfikawr/runsql/internal/ui"
+)
+
+// readScript reads a SQL script from a file, or from stdin if the path is "-"
+func readScript(path string) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read script: %w", err)
+	}
+	return string(data), nil
+}
+
+// runScript executes every statement of a script, reporting each one on stderr and
+// printing the rows of statements that return them: all of them, or with
+// --results last only the last one
+func runScript(engine *core.Engine, script string, args []interface{}, config CLIConfig) error {
+	results := strings.ToLower(config.Results)
+	if results == "" {
+		results = "all"
+	}
+	if results != "all" && results != "last" {
+		return fmt.Errorf("unsupported --results value: %s (use all or last)", config.Results)
+	}
+
+	statements, runErr := engine.RunScript(script, args...)
+
+	last := -1
+	for i, stmt := range statements {
+		if len(stmt.Columns) > 0 {
+			last = i
+		}
+	}
+
+	c := ui.Colors
+	printed := false
+	for i, stmt := range statements {
+		fmt.Fprintf(os.Stderr, "%s✓%s [%d] line %d: %s %s(%s, %s)%s\n",
+			c.Green, c.Reset, stmt.Index, stmt.Line, summarizeSQL(stmt.SQL),
+			c.Dim, describeStatement(stmt), formatDuration(stmt.Duration), c.Reset)
+
+		if len(stmt.Columns) == 0 || (results == "last" && i != last) {
+			continue
+		}
+		if printed && strings.ToLower(config.OutputFmt) == "table" {
+			fmt.Println()
+		}
+		if err := formatOutput(config.OutputFmt, stmt.Columns, stmt.Rows); err != nil {
+			return err
+		}
+		printed = true
+	}
+
+	return runErr
+}
+
+// describeStatement summarizes what a statement did, e.g. "3 rows" or "2 rows affected"
+func describeStatement(stmt core.StatementResult) string {
+	if len(stmt.Columns) > 0 {
+		return pluralize(len(stmt.Rows), "row")
+	}
+	return pluralize(int(stmt.RowsAffected), "row") + " affected"
+}
+
+func pluralize(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return fmt.Sprintf("%dµs", d.Microseconds())
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// summarizeSQL returns the first line of a statement, shortened for the log
+func summarizeSQL(sql string) string {
+	first, _, multiline := strings.Cut(sql, "\n")
+	first = strings.TrimSpace(first)
+	if multiline {
+		first += " ..."
+	}
+	return truncate(first, 60)
+}
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	webassets "github.com/zulfikawr/runsql/web"
+)
+
+// assetStore serves the frontend files either from the copy embedded in the binary
+// or, during frontend development, straight from a directory on disk.
+type assetStore struct {
+	fsys fs.FS
+	live bool // files may change between requests, so nothing is cached
+
+	mu    sync.Mutex
+	cache map[string]*asset
+}
+
+// asset is a loaded frontend file and its ETag
+type asset struct {
+	data []byte
+	etag string
+}
+
+// newAssetStore returns a store for the embedded assets, or for dir if it is not empty
+func newAssetStore(dir string) *assetStore {
+	if dir != "" {
+		return &assetStore{fsys: os.DirFS(dir), live: true, cache: make(map[string]*asset)}
+	}
+	return &assetStore{fsys: webassets.FS, cache: make(map[string]*asset)}
+}
+
+// load reads a file and computes its ETag, caching the result for embedded assets
+func (s *assetStore) load(name string) (*asset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.cache[name]; ok && !s.live {
+		return a, nil
+	}
+
+	data, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	a := &asset{data: data, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+	s.cache[name] = a
+	return a, nil
+}
+
+// serve writes a file with its ETag. Browsers revalidate on every load and get
+// a 304 Not Modified while the file is unchanged.
+func (s *assetStore) serve(w http.ResponseWriter, r *http.Request, name, contentType string) {
+	a, err := s.load(name)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", a.etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(a.data))
+}
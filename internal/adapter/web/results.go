@@ -0,0 +1,97 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPageSize is the number of rows returned when the client doesn't ask for a limit
+	DefaultPageSize = 1000
+	// MaxPageSize caps the number of rows returned in a single response
+	MaxPageSize = 10000
+	// DefaultMaxRows is the default number of rows of a query result kept on the server;
+	// the rest of the result is not read
+	DefaultMaxRows = 100000
+
+	resultCacheSize = 20
+	resultCacheTTL  = 30 * time.Minute
+)
+
+// cachedResult holds the full result of a query so it can be paged without re-running the upload
+type cachedResult struct {
+	columns []string
+	rows    [][]interface{}
+	capped  bool // The query returned more rows than the server keeps
+	created time.Time
+}
+
+// page returns the rows in [offset, offset+limit)
+func (r *cachedResult) page(offset, limit int) [][]interface{} {
+	if offset >= len(r.rows) {
+		return [][]interface{}{}
+	}
+	end := offset + limit
+	if end > len(r.rows) {
+		end = len(r.rows)
+	}
+	return r.rows[offset:end]
+}
+
+// resultCache keeps the most recent query results in memory, keyed by a random ID
+type resultCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedResult
+	order   []string // insertion order, oldest first
+}
+
+func newResultCache() *resultCache {
+	return &resultCache{entries: make(map[string]*cachedResult)}
+}
+
+// put stores a result and returns its ID, evicting the oldest entries if the cache is full
+func (c *resultCache) put(columns []string, rows [][]interface{}, capped bool) string {
+	id := newResultID()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evictExpired()
+	for len(c.order) >= resultCacheSize {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+
+	c.entries[id] = &cachedResult{columns: columns, rows: rows, capped: capped, created: time.Now()}
+	c.order = append(c.order, id)
+	return id
+}
+
+// get returns a cached result, or nil if it is unknown or expired
+func (c *resultCache) get(id string) *cachedResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evictExpired()
+	return c.entries[id]
+}
+
+// evictExpired drops entries older than the TTL. Callers must hold c.mu.
+func (c *resultCache) evictExpired() {
+	for len(c.order) > 0 {
+		oldest := c.entries[c.order[0]]
+		if oldest != nil && time.Since(oldest.created) < resultCacheTTL {
+			return
+		}
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+func newResultID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,57 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zulfikawr/runsql/internal/core"
+)
+
+// runScript executes a multi-statement script and responds with a summary of every
+// statement. Each result set is cached so the client can page through any of them;
+// the response carries the first page of the last one.
+func (s *Server) runScript(w http.ResponseWriter, engine *core.Engine, script string, args []interface{}, warnings []string, offset, limit int, startTime time.Time) {
+	results, err := engine.RunScriptLimit(script, s.maxRows, args...)
+
+	response := QueryResponse{Status: "success", Columns: []string{}, Rows: [][]interface{}{}, Warnings: warnings}
+	for _, result := range results {
+		stmt := StatementResponse{
+			Index:        result.Index,
+			Line:         result.Line,
+			SQL:          result.SQL,
+			RowCount:     len(result.Rows),
+			RowsAffected: result.RowsAffected,
+			TimeMs:       result.Duration.Milliseconds(),
+		}
+
+		if len(result.Columns) > 0 {
+			cached := &cachedResult{columns: result.Columns, rows: result.Rows, capped: result.Truncated}
+			stmt.ResultID = s.results.put(result.Columns, result.Rows, result.Truncated)
+			stmt.Columns = result.Columns
+
+			statements := response.Statements
+			response = newPageResponse(stmt.ResultID, cached, offset, limit)
+			response.Statements = statements
+			response.Warnings = warnings
+			if result.Truncated {
+				response.Warnings = append(response.Warnings, s.cappedWarning())
+			}
+		}
+		response.Statements = append(response.Statements, stmt)
+	}
+	response.TimeMs = time.Since(startTime).Milliseconds()
+
+	fmt.Printf("[WEB] SQL Script: %d statements executed in %dms\n", len(results), response.TimeMs)
+
+	if err != nil {
+		// Report the failing statement along with the ones that ran before it
+		response.Status = "error"
+		response.Error = fmt.Sprintf("Script error: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,252 @@
+package web
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zulfikawr/runsql/internal/core"
+	"github.com/zulfikawr/runsql/internal/parsers"
+)
+
+// maxFieldSize caps the size of a non-file form field such as the query
+const maxFieldSize = 1 << 20
+
+// requestError is an error reported to the client with a specific HTTP status
+type requestError struct {
+	status  int
+	message string
+}
+
+// uploadForm holds the result of reading a multipart upload
+type uploadForm struct {
+	values   map[string]string // non-file fields, e.g. "query"
+	tables   []string          // tables loaded from the uploaded files, in upload order
+	uploads  []UploadedFile    // the file each table was loaded from
+	skipped  []string          // tables of files left unread because the query doesn't use them
+	warnings []string          // e.g. a table renamed because its name was taken
+}
+
+// limitedBody wraps http.MaxBytesReader and remembers whether the limit was hit,
+// since parsers don't always pass the underlying read error through
+type limitedBody struct {
+	io.ReadCloser
+	exceeded atomic.Bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		b.exceeded.Store(true)
+	}
+	return n, err
+}
+
+// readUpload streams a multipart request. Each "file" part is parsed straight from
+// the request body into the engine as it arrives, without being staged on disk;
+// every other part is collected as a form field.
+//
+// A file is loaded into a table named after it, or into the table named by a "table"
+// field sent just before it. A file whose name is already taken by another table is
+// loaded under a numbered name instead, with a warning. Likewise, a "file_format" field
+// sets the format of the next file, which is otherwise detected.
+//
+// When a "query" field comes before the files, as the web UI sends it, the files of
+// tables the query doesn't reference are skipped without being parsed.
+func (s *Server) readUpload(w http.ResponseWriter, r *http.Request, engine *core.Engine) (*uploadForm, *requestError) {
+	var body *limitedBody
+	if s.maxUpload > 0 {
+		body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, s.maxUpload)}
+		r.Body = body
+	}
+
+	// fail turns an error into a requestError, reporting 413 if the body was cut off
+	fail := func(status int, message string) *requestError {
+		if body != nil && body.exceeded.Load() {
+			return &requestError{
+				status:  http.StatusRequestEntityTooLarge,
+				message: fmt.Sprintf("Upload exceeds the maximum size of %s", formatSize(s.maxUpload)),
+			}
+		}
+		return &requestError{status: status, message: message}
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, fail(http.StatusBadRequest, "Failed to parse form")
+	}
+
+	form := &uploadForm{values: make(map[string]string)}
+	namer := core.NewTableNamer()
+	alias := ""      // Table named by a "table" field, for the next file
+	fileFormat := "" // Format named by a "file_format" field, for the next file
+
+	// Parts of RandomAccess formats (XLSX, Parquet) are read into memory anyway and don't
+	// hold up the request body, so they are loaded in the background while the next parts
+	// are read. Streamed parts must be loaded before the next part can be read.
+	var pending sync.WaitGroup
+	var loadErrs []*error // Error of each file, in upload order
+	defer pending.Wait()
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fail(http.StatusBadRequest, "Failed to parse form")
+		}
+
+		if part.FormName() != "file" || part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldSize))
+			if err != nil {
+				return nil, fail(http.StatusBadRequest, "Failed to parse form")
+			}
+			switch part.FormName() {
+			case "table":
+				alias = strings.TrimSpace(string(value))
+				continue
+			case "file_format":
+				fileFormat = strings.TrimSpace(string(value))
+				continue
+			}
+			form.values[part.FormName()] = string(value)
+			continue
+		}
+
+		filename := part.FileName()
+		var tableName string
+		if alias != "" {
+			if err := core.ValidTableName(alias); err != nil {
+				return nil, fail(http.StatusBadRequest, fmt.Sprintf("Invalid table name for %s: %v", filename, err))
+			}
+			if !namer.Claim(alias) {
+				return nil, fail(http.StatusBadRequest, fmt.Sprintf("Table name %s is given to more than one file", alias))
+			}
+			tableName, alias = alias, ""
+		} else {
+			name := core.FileTableName(uploadBaseName(filename))
+			tableName = namer.Unique(name)
+			if tableName != name {
+				form.warnings = append(form.warnings, fmt.Sprintf("Table %s is already taken, loading %s as %s", name, uploadBaseName(filename), tableName))
+			}
+		}
+
+		if query, ok := form.values["query"]; ok && !core.FindTableRefs(query).Has(tableName) {
+			// The rest of the part is discarded by the next NextPart
+			fmt.Printf("[WEB] Skipped table: %s (not used by the query)\n", tableName)
+			form.skipped = append(form.skipped, tableName)
+			fileFormat = ""
+			continue
+		}
+
+		body := bufio.NewReaderSize(part, parsers.SniffSize)
+		format, err := uploadFormat(filename, part.Header.Get("Content-Type"), fileFormat, body)
+		fileFormat = ""
+		if err != nil {
+			return nil, fail(http.StatusBadRequest, fmt.Sprintf("Failed to parse file %s: %v", filename, err))
+		}
+
+		source, closer, err := format.Read(body, nil)
+		if err != nil {
+			return nil, fail(http.StatusBadRequest, fmt.Sprintf("Failed to parse file %s: %v", filename, err))
+		}
+
+		loadErr := new(error)
+		loadErrs = append(loadErrs, loadErr)
+		load := func() {
+			err := engine.Load(tableName, source)
+			if closer != nil {
+				closer.Close()
+			}
+			if err != nil {
+				*loadErr = fmt.Errorf("Failed to load data from %s: %v", filename, err)
+				return
+			}
+			fmt.Printf("[WEB] Loaded table: %s\n", tableName)
+		}
+		if format.RandomAccess {
+			pending.Go(load)
+		} else {
+			load()
+			if *loadErr != nil {
+				break // The rest of the upload is left unread
+			}
+		}
+
+		form.tables = append(form.tables, tableName)
+		form.uploads = append(form.uploads, UploadedFile{File: uploadBaseName(filename), Table: tableName, Format: format.Name})
+	}
+
+	// Report the first failure in upload order, whichever finished first
+	pending.Wait()
+	for _, err := range loadErrs {
+		if *err != nil {
+			return nil, fail(http.StatusBadRequest, (*err).Error())
+		}
+	}
+
+	if len(form.tables) == 0 && len(form.skipped) == 0 {
+		return nil, &requestError{status: http.StatusBadRequest, message: "At least one file is required"}
+	}
+
+	return form, nil
+}
+
+// uploadFormat returns the format of an uploaded file: the one named by the client, if
+// any, or the one of the extension of its name, the content type it was sent with, or
+// failing those, its first bytes, peeked from body
+func uploadFormat(filename, contentType, name string, body *bufio.Reader) (parsers.Format, error) {
+	if name != "" {
+		return parsers.Lookup(name)
+	}
+	if format, err := parsers.ForPath(safeExt(filename)); err == nil {
+		return format, nil
+	}
+	if format, ok := parsers.ForMIMEType(contentType); ok {
+		return format, nil
+	}
+	head, _ := body.Peek(parsers.SniffSize) // Shorter at the end of the part
+	return parsers.Detect(safeExt(filename), head)
+}
+
+// safeExt returns the lower-cased extension of a client-supplied filename,
+// keeping only letters and digits
+func safeExt(name string) string {
+	ext := strings.ToLower(path.Ext(uploadBaseName(name)))
+
+	var sb strings.Builder
+	for _, r := range strings.TrimPrefix(ext, ".") {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+		}
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "." + sb.String()
+}
+
+// uploadBaseName strips any directory from a client-supplied filename.
+// Clients may send Windows paths, which filepath.Base doesn't split on other systems.
+func uploadBaseName(name string) string {
+	return name[strings.LastIndexAny(name, `/\`)+1:]
+}
+
+// formatSize renders a byte count for error messages, e.g. "512MB"
+func formatSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for n >= 1024 && n%1024 == 0 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%d%s", n, units[i])
+}
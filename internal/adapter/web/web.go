@@ -3,17 +3,13 @@ package web
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"runsql/internal/core"
-	"runsql/internal/parsers"
-
-	"github.com/xuri/excelize/v2"
+	"github.com/zulfikawr/runsql/internal/core"
+	"github.com/zulfikawr/runsql/internal/writers"
 )
 
 // QueryRequest represents the request body for /query
@@ -22,38 +18,146 @@ type QueryRequest struct {
 	Format string
 }
 
-// QueryResponse represents the response from /query
+// QueryResponse represents the response from /query and /results
 type QueryResponse struct {
-	Status  string          `json:"status"`
-	Columns []string        `json:"columns"`
-	Rows    [][]interface{} `json:"rows"`
-	TimeMs  int64           `json:"time_ms"`
-	Error   string          `json:"error,omitempty"`
+	Status    string          `json:"status"`
+	ResultID  string          `json:"result_id,omitempty"`
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Offset    int             `json:"offset"`
+	Limit     int             `json:"limit"`
+	TotalRows int             `json:"total_rows"`
+	Truncated bool            `json:"truncated"`
+	Capped    bool            `json:"capped,omitempty"` // TotalRows stopped at the server's row limit
+	TimeMs    int64           `json:"time_ms"`
+	Error     string          `json:"error,omitempty"`
+	Warnings  []string        `json:"warnings,omitempty"`
+
+	// Statements reports every executed statement when the query runs as a script
+	// (mode=script); the fields above then hold the last statement that returned rows
+	Statements []StatementResponse `json:"statements,omitempty"`
+}
+
+// StatementResponse describes one executed statement of a script
+type StatementResponse struct {
+	Index        int      `json:"index"`
+	Line         int      `json:"line"`
+	SQL          string   `json:"sql"`
+	ResultID     string   `json:"result_id,omitempty"` // Set for statements that return rows
+	Columns      []string `json:"columns,omitempty"`
+	RowCount     int      `json:"row_count"`
+	RowsAffected int64    `json:"rows_affected"`
+	TimeMs       int64    `json:"time_ms"`
+}
+
+// DefaultMaxUpload is the default limit on the size of an upload request
+const DefaultMaxUpload = 512 << 20
+
+// SchemaResponse represents the response from /schema
+type SchemaResponse struct {
+	Status   string              `json:"status"`
+	Schemas  map[string][]string `json:"schemas"` // Column names per table
+	Tables   []TableSchema       `json:"tables"`
+	Uploads  []UploadedFile      `json:"uploads"` // The table of each uploaded file, in upload order
+	Warnings []string            `json:"warnings,omitempty"`
+}
+
+// UploadedFile names the table an uploaded file was loaded into, and the format it was
+// read in
+type UploadedFile struct {
+	File   string `json:"file"`
+	Table  string `json:"table"`
+	Format string `json:"format"`
+}
+
+// TableSchema describes a loaded table
+type TableSchema struct {
+	Name     string         `json:"name"`
+	RowCount int64          `json:"row_count"`
+	Columns  []ColumnSchema `json:"columns"`
+}
+
+// ColumnSchema describes a column of a loaded table
+type ColumnSchema struct {
+	Name           string        `json:"name"`
+	Type           string        `json:"type"`
+	Nullable       bool          `json:"nullable"`
+	Distinct       int64         `json:"distinct"`
+	DistinctApprox bool          `json:"distinct_approx,omitempty"`
+	Min            interface{}   `json:"min"`
+	Max            interface{}   `json:"max"`
+	Samples        []interface{} `json:"samples"`
+}
+
+// ProfileResponse represents the response from /profile
+type ProfileResponse struct {
+	Status   string              `json:"status"`
+	Profiles []core.TableProfile `json:"profiles"`
+	TimeMs   int64               `json:"time_ms"`
+	Warnings []string            `json:"warnings,omitempty"`
+}
+
+// FunctionsResponse represents the response from /functions
+type FunctionsResponse struct {
+	Status    string          `json:"status"`
+	Functions []core.Function `json:"functions"`
+}
+
+// ServerConfig holds the web server settings
+type ServerConfig struct {
+	Addr      string // -addr: Address to listen on
+	WebDir    string // -web-dir: Serve frontend assets from this directory instead of the embedded copy
+	MaxUpload int64  // -max-upload: Maximum size of an upload request in bytes (0 means no limit)
+	MaxRows   int    // -max-rows: Maximum number of rows of a query result kept (0 means DefaultMaxRows)
 }
 
 // Server handles the web interface
 type Server struct {
-	addr string
+	addr      string
+	maxUpload int64
+	maxRows   int
+	assets    *assetStore
+	results   *resultCache
 }
 
 // NewServer creates a new web server
-func NewServer(addr string) *Server {
-	return &Server{addr: addr}
+func NewServer(config ServerConfig) *Server {
+	maxRows := config.MaxRows
+	if maxRows <= 0 {
+		maxRows = DefaultMaxRows
+	}
+	return &Server{
+		addr:      config.Addr,
+		maxUpload: config.MaxUpload,
+		maxRows:   maxRows,
+		assets:    newAssetStore(config.WebDir),
+		results:   newResultCache(),
+	}
 }
 
-// Start starts the web server
-func (s *Server) Start() error {
-	http.HandleFunc("/", s.handleIndex)
-	http.HandleFunc("/health", s.handleHealth)
-	http.HandleFunc("/schema", s.handleSchema)
-	http.HandleFunc("/query", s.handleQuery)
+// Handler returns the HTTP handler serving the frontend and the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/schema", s.handleSchema)
+	mux.HandleFunc("/query", s.handleQuery)
+	mux.HandleFunc("/profile", s.handleProfile)
+	mux.HandleFunc("/functions", s.handleFunctions)
+	mux.HandleFunc("/results", s.handleResults)
+	mux.HandleFunc("/download", s.handleDownload)
 
 	// Serve static files (CSS, JS)
-	http.Handle("/style.css", http.HandlerFunc(s.handleStaticFile("style.css", "text/css")))
-	http.Handle("/script.js", http.HandlerFunc(s.handleStaticFile("script.js", "application/javascript")))
+	mux.HandleFunc("/style.css", s.handleStaticFile("style.css", "text/css; charset=utf-8"))
+	mux.HandleFunc("/script.js", s.handleStaticFile("script.js", "application/javascript; charset=utf-8"))
+
+	return mux
+}
 
+// Start starts the web server
+func (s *Server) Start() error {
 	fmt.Printf("Starting web server on http://localhost%s\n", s.addr)
-	return http.ListenAndServe(s.addr, nil)
+	return http.ListenAndServe(s.addr, s.Handler())
 }
 
 // handleHealth is a simple health check endpoint
@@ -66,14 +170,7 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 // handleStaticFile returns a handler function for serving static files
 func (s *Server) handleStaticFile(filename string, contentType string) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		filePath := filepath.Join(getWebDir(), filename)
-		data, err := os.ReadFile(filePath)
-		if err != nil {
-			http.Error(w, "File not found", http.StatusNotFound)
-			return
-		}
-		w.Header().Set("Content-Type", contentType)
-		w.Write(data)
+		s.assets.serve(w, r, filename, contentType)
 	}
 }
 
@@ -84,16 +181,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Read the index.html file from disk
-	indexPath := filepath.Join(getWebDir(), "index.html")
-	data, err := os.ReadFile(indexPath)
-	if err != nil {
-		http.Error(w, "Failed to load index", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write(data)
+	s.assets.serve(w, r, "index.html", "text/html; charset=utf-8")
 }
 
 // handleSchema returns the schema of an uploaded file
@@ -105,20 +193,6 @@ func (s *Server) handleSchema(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	// Parse multipart form
-	if err := r.ParseMultipartForm(10 * 1024 * 1024); err != nil { // 10MB max
-		respondError(w, "Failed to parse form", http.StatusBadRequest)
-		return
-	}
-
-	// Get files
-	if r.MultipartForm == nil || len(r.MultipartForm.File["file"]) == 0 {
-		respondError(w, "At least one file is required", http.StatusBadRequest)
-		return
-	}
-
-	files := r.MultipartForm.File["file"]
-
 	// Create engine
 	engine, err := core.NewEngine()
 	if err != nil {
@@ -127,69 +201,91 @@ func (s *Server) handleSchema(w http.ResponseWriter, r *http.Request) {
 	}
 	defer engine.Close()
 
-	schemas := make(map[string][]string)
-	tmpFiles := []string{}
-	defer func() {
-		for _, f := range tmpFiles {
-			os.Remove(f)
-		}
-	}()
+	// Stream the uploaded files into the engine
+	form, reqErr := s.readUpload(w, r, engine)
+	if reqErr != nil {
+		respondError(w, reqErr.message, reqErr.status)
+		return
+	}
 
-	for _, fileHeader := range files {
-		file, err := fileHeader.Open()
+	response := SchemaResponse{
+		Status:   "success",
+		Schemas:  make(map[string][]string),
+		Uploads:  form.uploads,
+		Warnings: form.warnings,
+	}
+	for _, tableName := range form.tables {
+		table, err := engine.DescribeTable(tableName)
 		if err != nil {
-			respondError(w, fmt.Sprintf("Failed to open file %s", fileHeader.Filename), http.StatusInternalServerError)
+			respondError(w, fmt.Sprintf("Failed to get schema for %s: %v", tableName, err), http.StatusBadRequest)
 			return
 		}
-		defer file.Close()
 
-		// Write temp file
-		tmpDir := os.TempDir()
-		tmpFile := filepath.Join(tmpDir, fileHeader.Filename)
-		tmpFiles = append(tmpFiles, tmpFile)
+		response.Schemas[table.Name] = table.Columns
+		response.Tables = append(response.Tables, newTableSchema(table))
+		fmt.Printf("[WEB] Schema loaded for: %s\n", tableName)
+	}
 
-		tmpF, err := os.Create(tmpFile)
-		if err != nil {
-			respondError(w, "Failed to create temp file", http.StatusInternalServerError)
-			return
-		}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
 
-		if _, err := io.Copy(tmpF, file); err != nil {
-			tmpF.Close()
-			respondError(w, "Failed to write temp file", http.StatusInternalServerError)
-			return
-		}
-		tmpF.Close()
+// handleFunctions lists the SQL functions available in queries
+func (s *Server) handleFunctions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-		// Load file
-		source, err := getSourceFromFile(tmpFile)
-		if err != nil {
-			respondError(w, fmt.Sprintf("Failed to parse file: %v", err), http.StatusBadRequest)
-			return
-		}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(FunctionsResponse{Status: "success", Functions: core.Functions()})
+}
+
+// handleProfile returns per-column statistics of the uploaded files
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	// Create engine
+	engine, err := core.NewEngine()
+	if err != nil {
+		respondError(w, "Failed to create engine", http.StatusInternalServerError)
+		return
+	}
+	defer engine.Close()
+
+	// Stream the uploaded files into the engine
+	form, reqErr := s.readUpload(w, r, engine)
+	if reqErr != nil {
+		respondError(w, reqErr.message, reqErr.status)
+		return
+	}
 
-		tableName := getTableNameFromPath(fileHeader.Filename)
-		if err := engine.Load(tableName, source); err != nil {
-			respondError(w, fmt.Sprintf("Failed to load data: %v", err), http.StatusBadRequest)
+	topN := core.DefaultTopValues
+	if v := form.values["top"]; v != "" {
+		topN, err = strconv.Atoi(v)
+		if err != nil || topN <= 0 {
+			respondError(w, fmt.Sprintf("invalid top: %s", v), http.StatusBadRequest)
 			return
 		}
+	}
 
-		// Get schema
-		columns, _, err := engine.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 0", tableName))
+	response := ProfileResponse{Status: "success", Warnings: form.warnings}
+	for _, tableName := range form.tables {
+		profile, err := engine.Profile(tableName, topN)
 		if err != nil {
-			respondError(w, fmt.Sprintf("Failed to get schema for %s: %v", tableName, err), http.StatusBadRequest)
+			respondError(w, fmt.Sprintf("Failed to profile %s: %v", tableName, err), http.StatusBadRequest)
 			return
 		}
-
-		schemas[tableName] = columns
-		fmt.Printf("[WEB] Schema loaded for: %s\n", tableName)
-	}
-
-	// Return schemas
-	response := map[string]interface{}{
-		"status":  "success",
-		"schemas": schemas,
+		response.Profiles = append(response.Profiles, profile)
 	}
+	response.TimeMs = time.Since(startTime).Milliseconds()
+	fmt.Printf("[WEB] Profiled %d tables in %dms\n", len(response.Profiles), response.TimeMs)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
@@ -205,95 +301,54 @@ func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	// Parse multipart form
-	if err := r.ParseMultipartForm(10 * 1024 * 1024); err != nil { // 10MB max
-		respondError(w, "Failed to parse form", http.StatusBadRequest)
+	// Create engine
+	engine, err := core.NewEngine()
+	if err != nil {
+		respondError(w, "Failed to create engine", http.StatusInternalServerError)
 		return
 	}
+	defer engine.Close()
 
-	// Get files
-	if r.MultipartForm == nil || len(r.MultipartForm.File["file"]) == 0 {
-		respondError(w, "At least one file is required", http.StatusBadRequest)
+	// Stream the uploaded files into the engine; the other fields are read along the way
+	form, reqErr := s.readUpload(w, r, engine)
+	if reqErr != nil {
+		respondError(w, reqErr.message, reqErr.status)
 		return
 	}
 
-	files := r.MultipartForm.File["file"]
-
 	// Get query
-	query := r.FormValue("query")
+	query := form.values["query"]
 	if query == "" {
 		respondError(w, "Query is required", http.StatusBadRequest)
 		return
 	}
 
-	format := r.FormValue("format")
-	if format == "" {
-		format = "table"
-	}
-
-	// Create engine
-	engine, err := core.NewEngine()
+	offset, limit, err := parsePagination(form.values["offset"], form.values["limit"])
 	if err != nil {
-		respondError(w, "Failed to create engine", http.StatusInternalServerError)
+		respondError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer engine.Close()
-
-	// Process each file
-	var loadedTables []string
-	tmpFiles := []string{}
-	defer func() {
-		for _, f := range tmpFiles {
-			os.Remove(f)
-		}
-	}()
-
-	for _, fileHeader := range files {
-		file, err := fileHeader.Open()
-		if err != nil {
-			respondError(w, fmt.Sprintf("Failed to open file %s", fileHeader.Filename), http.StatusInternalServerError)
-			return
-		}
-		defer file.Close()
-
-		// Write temp file
-		tmpDir := os.TempDir()
-		tmpFile := filepath.Join(tmpDir, fileHeader.Filename)
-		tmpFiles = append(tmpFiles, tmpFile)
-
-		tmpF, err := os.Create(tmpFile)
-		if err != nil {
-			respondError(w, "Failed to create temp file", http.StatusInternalServerError)
-			return
-		}
 
-		if _, err := io.Copy(tmpF, file); err != nil {
-			tmpF.Close()
-			respondError(w, "Failed to write temp file", http.StatusInternalServerError)
-			return
+	// Optional query parameters: a JSON object of named values or an array of positional ones
+	var args []interface{}
+	if raw := form.values["params"]; strings.TrimSpace(raw) != "" {
+		params, err := core.ParamsFromJSON([]byte(raw))
+		if err == nil {
+			args, err = core.BindArgs(params)
 		}
-		tmpF.Close() // Close explicitly to flush
-
-		// Load file into engine
-		source, err := getSourceFromFile(tmpFile)
 		if err != nil {
-			respondError(w, fmt.Sprintf("Failed to parse file %s: %v", fileHeader.Filename, err), http.StatusBadRequest)
+			respondError(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+	}
 
-		// Derive table name
-		tableName := getTableNameFromPath(fileHeader.Filename)
-
-		if err := engine.Load(tableName, source); err != nil {
-			respondError(w, fmt.Sprintf("Failed to load data from %s: %v", fileHeader.Filename, err), http.StatusBadRequest)
-			return
-		}
-		loadedTables = append(loadedTables, tableName)
-		fmt.Printf("[WEB] Loaded table: %s\n", tableName)
+	if form.values["mode"] == "script" {
+		s.runScript(w, engine, query, args, form.warnings, offset, limit, startTime)
+		return
 	}
 
-	// Execute query
-	columns, rows, err := engine.Query(query)
+	// Execute query, keeping no more rows than the server allows
+	columns, rows, capped, err := engine.QueryLimit(query, s.maxRows, args...)
 	if err != nil {
 		respondError(w, fmt.Sprintf("Query error: %v", err), http.StatusBadRequest)
 		return
@@ -305,100 +360,169 @@ func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("[WEB] SQL Query: %s\n", query)
 	fmt.Printf("[WEB] Result: %d rows returned in %dms\n", len(rows), elapsed)
 
-	// Return results
-	response := QueryResponse{
-		Status:  "success",
-		Columns: columns,
-		Rows:    rows,
-		TimeMs:  elapsed,
+	// Cache the full result and return the first page
+	id := s.results.put(columns, rows, capped)
+	response := newPageResponse(id, &cachedResult{columns: columns, rows: rows, capped: capped}, offset, limit)
+	response.TimeMs = elapsed
+	response.Warnings = form.warnings
+	if capped {
+		response.Warnings = append(response.Warnings, s.cappedWarning())
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
-// respondError writes an error response
-func respondError(w http.ResponseWriter, message string, statusCode int) {
-	w.WriteHeader(statusCode)
-	response := QueryResponse{
-		Status: "error",
-		Error:  message,
+// handleResults returns another page of a previously executed query
+func (s *Server) handleResults(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		respondError(w, "Result id is required", http.StatusBadRequest)
+		return
+	}
+
+	offset, limit, err := parsePagination(r.URL.Query().Get("offset"), r.URL.Query().Get("limit"))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := s.results.get(id)
+	if result == nil {
+		respondError(w, "Result has expired, please run the query again", http.StatusNotFound)
+		return
 	}
+
+	response := newPageResponse(id, result, offset, limit)
+	response.TimeMs = time.Since(startTime).Milliseconds()
+
+	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
-// getWebDir returns the path to the web directory
-func getWebDir() string {
-	// Try to find the web directory relative to the current working directory
-	if _, err := os.Stat("web"); err == nil {
-		return "web"
+// handleDownload streams a cached query result as a file attachment
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
-	// Fallback for when running from a different directory
-	return filepath.Join(".", "web")
-}
 
-// getSourceFromFile detects the file type and returns the appropriate parser
-func getSourceFromFile(filePath string) (parsers.Source, error) {
-	ext := strings.ToLower(filepath.Ext(filePath))
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		respondError(w, "Result id is required", http.StatusBadRequest)
+		return
+	}
 
-	switch ext {
-	case ".csv":
-		file, err := os.Open(filePath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open CSV file: %w", err)
-		}
-		source, err := parsers.NewCSVSource(file)
-		if err != nil {
-			file.Close()
-			return nil, err
-		}
-		return source, nil
+	format, err := writers.Lookup(r.URL.Query().Get("format"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	case ".json":
-		file, err := os.Open(filePath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open JSON file: %w", err)
-		}
-		source, err := parsers.NewJSONSource(file)
-		if err != nil {
-			file.Close()
-			return nil, err
-		}
-		return source, nil
+	result := s.results.get(id)
+	if result == nil {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		respondError(w, "Result has expired, please run the query again", http.StatusNotFound)
+		return
+	}
 
-	case ".xlsx":
-		xlsxFile, err := excelize.OpenFile(filePath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open XLSX file: %w", err)
-		}
-		source, err := parsers.NewXLSXSource(xlsxFile)
-		if err != nil {
-			xlsxFile.Close()
-			return nil, err
-		}
-		return source, nil
+	writer, err := format.New(w)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		respondError(w, fmt.Sprintf("Failed to create %s writer: %v", format.Name, err), http.StatusInternalServerError)
+		return
+	}
 
-	default:
-		return nil, fmt.Errorf("unsupported file type: %s", ext)
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export%s"`, format.Extension))
+
+	// Headers are already sent at this point, so errors can only be logged
+	if err := writers.WriteAll(writer, result.columns, result.rows); err != nil {
+		fmt.Printf("[WEB] Download failed: %v\n", err)
+		return
+	}
+	fmt.Printf("[WEB] Downloaded %d rows as %s\n", len(result.rows), format.Name)
+}
+
+// newTableSchema converts table metadata from the engine into its JSON form
+func newTableSchema(table core.Table) TableSchema {
+	schema := TableSchema{Name: table.Name, RowCount: table.RowCount}
+	for i, col := range table.Columns {
+		stats := table.Stats[i]
+		schema.Columns = append(schema.Columns, ColumnSchema{
+			Name:           col,
+			Type:           table.Types[i],
+			Nullable:       stats.Nullable,
+			Distinct:       stats.Distinct,
+			DistinctApprox: stats.DistinctApprox,
+			Min:            stats.Min,
+			Max:            stats.Max,
+			Samples:        stats.Samples,
+		})
+	}
+	return schema
+}
+
+// newPageResponse builds a success response holding one page of a result
+func newPageResponse(id string, result *cachedResult, offset, limit int) QueryResponse {
+	rows := result.page(offset, limit)
+	return QueryResponse{
+		Status:    "success",
+		ResultID:  id,
+		Columns:   result.columns,
+		Rows:      rows,
+		Offset:    offset,
+		Limit:     limit,
+		TotalRows: len(result.rows),
+		Truncated: offset+len(rows) < len(result.rows),
+		Capped:    result.capped,
 	}
 }
 
-// getTableNameFromPath derives a table name from a file path
-func getTableNameFromPath(path string) string {
-	base := filepath.Base(path)
-	ext := filepath.Ext(base)
-	name := strings.TrimSuffix(base, ext)
-	return sanitizeTableName(name)
+// cappedWarning tells that a result has more rows than the server keeps
+func (s *Server) cappedWarning() string {
+	return fmt.Sprintf("The result has more than %d rows; only the first %d are shown", s.maxRows, s.maxRows)
 }
 
-func sanitizeTableName(name string) string {
-	var sb strings.Builder
-	for _, r := range name {
-		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
-			sb.WriteRune(r)
-		} else {
-			sb.WriteRune('_')
+// parsePagination parses the offset and limit parameters, applying the default and maximum page size
+func parsePagination(offsetStr, limitStr string) (int, int, error) {
+	offset, limit := 0, DefaultPageSize
+
+	if offsetStr != "" {
+		v, err := strconv.Atoi(offsetStr)
+		if err != nil || v < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %s", offsetStr)
+		}
+		offset = v
+	}
+
+	if limitStr != "" {
+		v, err := strconv.Atoi(limitStr)
+		if err != nil || v <= 0 {
+			return 0, 0, fmt.Errorf("invalid limit: %s", limitStr)
 		}
+		limit = min(v, MaxPageSize)
 	}
-	return sb.String()
+
+	return offset, limit, nil
+}
+
+// respondError writes an error response
+func respondError(w http.ResponseWriter, message string, statusCode int) {
+	w.WriteHeader(statusCode)
+	response := QueryResponse{
+		Status: "error",
+		Error:  message,
+	}
+	json.NewEncoder(w).Encode(response)
 }
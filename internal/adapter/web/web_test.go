@@ -0,0 +1,748 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// testFile is a file attached to a test upload
+type testFile struct {
+	name    string
+	content string
+	table   string // Sent as a "table" field before the file, if set
+	format  string // Sent as a "file_format" field before the file, if set
+}
+
+// postQuery uploads files to /query with the given SQL and decodes the response
+func postQuery(t *testing.T, url, query string, files ...testFile) QueryResponse {
+	t.Helper()
+	_, result := postQueryStatus(t, url, query, files...)
+	return result
+}
+
+// postQueryStatus is like postQuery but also returns the HTTP status code
+func postQueryStatus(t *testing.T, url, query string, files ...testFile) (int, QueryResponse) {
+	t.Helper()
+	return postForm(t, url, map[string]string{"query": query}, files...)
+}
+
+// postForm uploads files to /query along with arbitrary form fields
+func postForm(t *testing.T, url string, fields map[string]string, files ...testFile) (int, QueryResponse) {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, f := range files {
+		if f.table != "" {
+			mw.WriteField("table", f.table)
+		}
+		if f.format != "" {
+			mw.WriteField("file_format", f.format)
+		}
+		// Set the header by hand so the filename is sent exactly as given
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, f.name))
+		h.Set("Content-Type", "application/octet-stream")
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(f.content))
+	}
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	mw.Close()
+
+	resp, err := http.Post(url+"/query", mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("POST /query failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result QueryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestServeEmbeddedIndex(t *testing.T) {
+	// Run from a directory without a web/ folder, like a downloaded release binary
+	t.Chdir(t.TempDir())
+
+	ts := httptest.NewServer(NewServer(ServerConfig{}).Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GET / failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Unexpected Content-Type: %s", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "<title>RunSQL") {
+		t.Errorf("Index page not served, got:\n%s", body)
+	}
+
+	for _, name := range []string{"/style.css", "/script.js"} {
+		resp, err := http.Get(ts.URL + name)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", name, resp.StatusCode)
+		}
+	}
+}
+
+func TestServeAssetETag(t *testing.T) {
+	ts := httptest.NewServer(NewServer(ServerConfig{}).Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/script.js")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag header")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/script.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Conditional GET failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d", resp.StatusCode)
+	}
+}
+
+func TestServeWebDirOverride(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("dev index"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(NewServer(ServerConfig{WebDir: dir}).Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GET / failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "dev index" {
+		t.Errorf("Expected file from web dir, got %q", body)
+	}
+}
+
+func TestUploadPathTraversal(t *testing.T) {
+	base := t.TempDir()
+	tmp := filepath.Join(base, "tmp")
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TMPDIR", tmp)
+
+	ts := httptest.NewServer(NewServer(ServerConfig{}).Handler())
+	defer ts.Close()
+
+	result := postQuery(t, ts.URL, "SELECT * FROM escaped JOIN win",
+		testFile{name: "../escaped.csv", content: "id\n1"},
+		testFile{name: `..\..\win.csv`, content: "name\nx"},
+	)
+	if result.Status != "success" {
+		t.Fatalf("Query failed: %s", result.Error)
+	}
+
+	if _, err := os.Stat(filepath.Join(base, "escaped.csv")); err == nil {
+		t.Error("Upload was written outside the temp directory")
+	}
+
+	// The per-request upload directory must be cleaned up
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected temp directory to be empty, found %d entries", len(entries))
+	}
+}
+
+func TestConcurrentSameNameUploads(t *testing.T) {
+	ts := httptest.NewServer(NewServer(ServerConfig{}).Handler())
+	defer ts.Close()
+
+	const uploads = 10
+	var wg sync.WaitGroup
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			result := postQuery(t, ts.URL, "SELECT id FROM data",
+				testFile{name: "data.csv", content: fmt.Sprintf("id\n%d", i)},
+			)
+			if result.Status != "success" {
+				t.Errorf("Upload %d failed: %s", i, result.Error)
+				return
+			}
+			if len(result.Rows) != 1 || result.Rows[0][0] != float64(i) {
+				t.Errorf("Upload %d got another request's data: %v", i, result.Rows)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSafeExt(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"data.csv", ".csv"},
+		{"REPORT.XLSX", ".xlsx"},
+		{"../../etc/passwd", ""},
+		{`C:\Users\me\data.json`, ".json"},
+		{"weird.c$v", ".cv"},
+		{"noext", ""},
+	}
+
+	for _, tt := range tests {
+		if got := safeExt(tt.input); got != tt.expected {
+			t.Errorf("safeExt(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestUploadTooLarge(t *testing.T) {
+	ts := httptest.NewServer(NewServer(ServerConfig{MaxUpload: 1024}).Handler())
+	defer ts.Close()
+
+	content := "id,name\n" + strings.Repeat("1,some fairly long name\n", 1000)
+	status, result := postQueryStatus(t, ts.URL, "SELECT * FROM big", testFile{name: "big.csv", content: content})
+
+	if status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413, got %d (%s)", status, result.Error)
+	}
+	if !strings.Contains(result.Error, "1KB") {
+		t.Errorf("Expected the limit in the error message, got %q", result.Error)
+	}
+}
+
+func TestUploadXLSX(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A1", "id")
+	f.SetCellValue("Sheet1", "A2", 7)
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(NewServer(ServerConfig{MaxUpload: DefaultMaxUpload}).Handler())
+	defer ts.Close()
+
+	result := postQuery(t, ts.URL, "SELECT id FROM sheet", testFile{name: "sheet.xlsx", content: buf.String()})
+	if result.Status != "success" {
+		t.Fatalf("Query failed: %s", result.Error)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != float64(7) {
+		t.Errorf("Unexpected rows: %v", result.Rows)
+	}
+}
+
+func TestQueryScript(t *testing.T) {
+	ts := httptest.NewServer(NewServer(ServerConfig{MaxUpload: DefaultMaxUpload}).Handler())
+	defer ts.Close()
+
+	data := testFile{name: "nums.csv", content: "n\n1\n2\n3\n"}
+	script := "CREATE TEMP TABLE big AS SELECT n FROM nums WHERE n > 1;\nDELETE FROM big WHERE n = 3;\nSELECT * FROM big;"
+
+	status, result := postForm(t, ts.URL, map[string]string{"query": script, "mode": "script"}, data)
+	if status != http.StatusOK || result.Status != "success" {
+		t.Fatalf("Script failed: %d %s", status, result.Error)
+	}
+	if len(result.Statements) != 3 || result.Statements[1].RowsAffected != 1 {
+		t.Fatalf("Unexpected statements: %+v", result.Statements)
+	}
+	if result.ResultID == "" || result.ResultID != result.Statements[2].ResultID {
+		t.Errorf("Expected the last result set to be returned, got %q", result.ResultID)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != float64(2) {
+		t.Errorf("Unexpected rows: %v", result.Rows)
+	}
+
+	status, result = postForm(t, ts.URL, map[string]string{"query": "SELECT 1;\nSELECT * FROM missing;", "mode": "script"}, data)
+	if status != http.StatusBadRequest || len(result.Statements) != 1 {
+		t.Fatalf("Expected failure after 1 statement, got %d with %d statements", status, len(result.Statements))
+	}
+	if !strings.Contains(result.Error, "statement 2 (line 2)") {
+		t.Errorf("Error should name the failing statement: %s", result.Error)
+	}
+
+	// The warnings of the upload outlive the result sets of the script
+	status, result = postForm(t, ts.URL, map[string]string{"query": "SELECT 1;\nSELECT * FROM nums_2;", "mode": "script"},
+		data, testFile{name: "nums.csv", content: "m\n4\n"})
+	if status != http.StatusOK || result.Status != "success" {
+		t.Fatalf("Script failed: %d %s", status, result.Error)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "nums_2") {
+		t.Errorf("Expected a warning about nums_2, got %v", result.Warnings)
+	}
+}
+
+func TestQueryMaxRows(t *testing.T) {
+	ts := httptest.NewServer(NewServer(ServerConfig{MaxUpload: DefaultMaxUpload, MaxRows: 5}).Handler())
+	defer ts.Close()
+
+	// The recursive query never ends, so it must stop at the limit
+	data := testFile{name: "nums.csv", content: "n\n1\n"}
+	endless := "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT i FROM n"
+	tests := []struct {
+		name   string
+		fields map[string]string
+		rows   int
+		capped bool
+	}{
+		{"under the limit", map[string]string{"query": "SELECT 1 UNION ALL SELECT 2"}, 2, false},
+		{"at the limit", map[string]string{"query": "SELECT i FROM (" + endless + ") LIMIT 5"}, 5, false},
+		{"endless", map[string]string{"query": endless}, 5, true},
+		{"endless script", map[string]string{"query": "SELECT 1;\n" + endless, "mode": "script"}, 5, true},
+		{"paged", map[string]string{"query": endless, "limit": "2"}, 2, true},
+	}
+	for _, tt := range tests {
+		status, result := postForm(t, ts.URL, tt.fields, data)
+		if status != http.StatusOK {
+			t.Fatalf("%s: %d %s", tt.name, status, result.Error)
+		}
+		if len(result.Rows) != tt.rows || result.Capped != tt.capped {
+			t.Errorf("%s: got %d rows, capped %v", tt.name, len(result.Rows), result.Capped)
+		}
+		if tt.capped && (result.TotalRows != 5 || len(result.Warnings) != 1) {
+			t.Errorf("%s: expected 5 rows in total and a warning, got %d and %v", tt.name, result.TotalRows, result.Warnings)
+		}
+		if result.Truncated != (result.Offset+len(result.Rows) < result.TotalRows) {
+			t.Errorf("%s: truncated %v with %d of %d rows", tt.name, result.Truncated, len(result.Rows), result.TotalRows)
+		}
+	}
+}
+
+func TestQueryParams(t *testing.T) {
+	ts := httptest.NewServer(NewServer(ServerConfig{MaxUpload: DefaultMaxUpload}).Handler())
+	defer ts.Close()
+
+	data := testFile{name: "people.csv", content: "name,age\nAnn,30\nBob,17\n"}
+	fields := map[string]string{
+		"query":  "SELECT name FROM people WHERE age >= :min OR name = :name",
+		"params": `{"min": 18, "name": "x' OR '1'='1"}`,
+	}
+
+	status, result := postForm(t, ts.URL, fields, data)
+	if status != http.StatusOK {
+		t.Fatalf("Query failed: %d %s", status, result.Error)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != "Ann" {
+		t.Errorf("Unexpected rows: %v", result.Rows)
+	}
+
+	fields["params"] = "[1, 2"
+	if status, _ := postForm(t, ts.URL, fields, data); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid params, got %d", status)
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	ts := httptest.NewServer(NewServer(ServerConfig{MaxUpload: DefaultMaxUpload}).Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/functions")
+	if err != nil {
+		t.Fatalf("GET /functions failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var listing struct {
+		Functions []struct {
+			Name      string `json:"name"`
+			Signature string `json:"signature"`
+		} `json:"functions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	names := make(map[string]bool)
+	for _, f := range listing.Functions {
+		names[f.Name] = true
+	}
+	if !names["regexp_extract"] || !names["levenshtein"] {
+		t.Errorf("Unexpected function listing: %+v", listing.Functions)
+	}
+
+	data := testFile{name: "emails.csv", content: "email\nann@example.com\nbob@test.org\n"}
+	result := postQuery(t, ts.URL, "SELECT split_part(email, '@', 1) FROM emails WHERE email REGEXP 'example'", data)
+	if result.Status != "success" || len(result.Rows) != 1 || result.Rows[0][0] != "ann" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+}
+
+func TestUploadTableNames(t *testing.T) {
+	ts := httptest.NewServer(NewServer(ServerConfig{MaxUpload: DefaultMaxUpload}).Handler())
+	defer ts.Close()
+
+	// A second data.csv is renamed, unless the first one is given another name
+	result := postQuery(t, ts.URL, "SELECT * FROM data JOIN data_2 JOIN t_2025_sales",
+		testFile{name: "data.csv", content: "a\n1"},
+		testFile{name: "data.csv", content: "b\n2"},
+		testFile{name: "2025 sales.csv", content: "c\n3"},
+	)
+	if result.Status != "success" {
+		t.Fatalf("Query failed: %s", result.Error)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "data_2") {
+		t.Errorf("Expected a warning about data_2, got %v", result.Warnings)
+	}
+
+	result = postQuery(t, ts.URL, "SELECT a, b FROM old JOIN data",
+		testFile{name: "data.csv", content: "a\n1", table: "old"},
+		testFile{name: "data.csv", content: "b\n2"},
+	)
+	if result.Status != "success" || len(result.Warnings) != 0 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	for _, files := range [][]testFile{
+		{{name: "a.csv", content: "a\n1", table: "x"}, {name: "b.csv", content: "b\n1", table: "X"}},
+		{{name: "a.csv", content: "a\n1", table: "select"}},
+		{{name: "a.csv", content: "a\n1", table: "my table"}},
+	} {
+		status, result := postQueryStatus(t, ts.URL, "SELECT 1", files...)
+		if status != http.StatusBadRequest {
+			t.Errorf("Expected 400 for table names %q and %q, got %d: %s", files[0].table, files[len(files)-1].table, status, result.Error)
+		}
+	}
+}
+
+func TestUploadFormatDetection(t *testing.T) {
+	ts := httptest.NewServer(NewServer(ServerConfig{MaxUpload: DefaultMaxUpload}).Handler())
+	defer ts.Close()
+
+	// Files without a known extension are recognized by their content
+	result := postQuery(t, ts.URL, "SELECT export.name, report.total FROM export JOIN report ON export.id = report.id",
+		testFile{name: "export.txt", content: "id;name\n1;Apple\n"},
+		testFile{name: "report.dat", content: `[{"id": 1, "total": 5}]`},
+	)
+	if result.Status != "success" {
+		t.Fatalf("Query failed: %s", result.Error)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != "Apple" || result.Rows[0][1] != float64(5) {
+		t.Errorf("Unexpected rows: %v", result.Rows)
+	}
+
+	// A single column can't be told apart from plain text, unless the format is named
+	status, result := postQueryStatus(t, ts.URL, "SELECT * FROM ids", testFile{name: "ids", content: "id\n1\n"})
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an undetectable file, got %d", status)
+	}
+	result = postQuery(t, ts.URL, "SELECT * FROM ids", testFile{name: "ids", content: "id\n1\n", format: "csv"})
+	if result.Status != "success" || len(result.Rows) != 1 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+}
+
+func TestQuerySkipsUnusedFiles(t *testing.T) {
+	ts := httptest.NewServer(NewServer(ServerConfig{MaxUpload: DefaultMaxUpload}).Handler())
+	defer ts.Close()
+
+	// post sends the query before the files, as the web UI does
+	post := func(query string) QueryResponse {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("query", query)
+		for _, f := range []testFile{
+			{name: "users.csv", content: "id,name\n1,Ada\n"},
+			{name: "broken.json", content: `[{"id": `},
+			{name: "notes.bin", content: "\x00\x01"},
+		} {
+			part, err := mw.CreateFormFile("file", f.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write([]byte(f.content))
+		}
+		mw.Close()
+
+		resp, err := http.Post(ts.URL+"/query", mw.FormDataContentType(), &body)
+		if err != nil {
+			t.Fatalf("POST /query failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var result QueryResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return result
+	}
+
+	// Neither the broken file nor the unknown one is parsed
+	result := post("SELECT name FROM users")
+	if result.Status != "success" || len(result.Rows) != 1 || result.Rows[0][0] != "Ada" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	result = post("SELECT 1")
+	if result.Status != "success" {
+		t.Errorf("Expected a query using no table to succeed, got %s", result.Error)
+	}
+
+	// A file the query uses is still parsed
+	result = post("SELECT * FROM users JOIN broken USING (id)")
+	if result.Status == "success" || !strings.Contains(result.Error, "broken.json") {
+		t.Errorf("Expected broken.json to fail, got %+v", result)
+	}
+
+	// So is every file of a query listing the tables
+	result = post("SELECT name FROM sqlite_master")
+	if result.Status == "success" || !strings.Contains(result.Error, "broken.json") {
+		t.Errorf("Expected listing the tables to parse broken.json, got %+v", result)
+	}
+}
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		offset, limit string
+		wantOffset    int
+		wantLimit     int
+		wantErr       bool
+	}{
+		{"", "", 0, DefaultPageSize, false},
+		{"0", "1", 0, 1, false},
+		{"250", "50", 250, 50, false},
+		{"", fmt.Sprint(MaxPageSize), 0, MaxPageSize, false},
+		{"", fmt.Sprint(MaxPageSize + 1), 0, MaxPageSize, false},
+		{"", "999999999", 0, MaxPageSize, false},
+		{"-1", "", 0, 0, true},
+		{"", "0", 0, 0, true},
+		{"", "-5", 0, 0, true},
+		{"ten", "", 0, 0, true},
+		{"", "1.5", 0, 0, true},
+		{"99999999999999999999", "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		offset, limit, err := parsePagination(tt.offset, tt.limit)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePagination(%q, %q) error = %v, want error %v", tt.offset, tt.limit, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (offset != tt.wantOffset || limit != tt.wantLimit) {
+			t.Errorf("parsePagination(%q, %q) = %d, %d, want %d, %d", tt.offset, tt.limit, offset, limit, tt.wantOffset, tt.wantLimit)
+		}
+	}
+}
+
+func TestResults(t *testing.T) {
+	server := NewServer(ServerConfig{MaxUpload: DefaultMaxUpload})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	get := func(query string) (int, QueryResponse) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/results?" + query)
+		if err != nil {
+			t.Fatalf("GET /results failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var result QueryResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp.StatusCode, result
+	}
+
+	rows := make([][]interface{}, 25)
+	for i := range rows {
+		rows[i] = []interface{}{i}
+	}
+	ids := make([]string, resultCacheSize+1)
+	for i := range ids {
+		ids[i] = server.results.put([]string{"n"}, rows, false)
+	}
+	last := ids[len(ids)-1]
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantRows   int
+		wantFirst  float64
+		truncated  bool
+	}{
+		{"first page", "id=" + last + "&limit=10", http.StatusOK, 10, 0, true},
+		{"middle page", "id=" + last + "&offset=10&limit=10", http.StatusOK, 10, 10, true},
+		{"last page", "id=" + last + "&offset=20&limit=10", http.StatusOK, 5, 20, false},
+		{"past the end", "id=" + last + "&offset=100", http.StatusOK, 0, 0, false},
+		{"default limit", "id=" + last, http.StatusOK, 25, 0, false},
+		{"oldest kept", "id=" + ids[1], http.StatusOK, 25, 0, false},
+		{"evicted", "id=" + ids[0], http.StatusNotFound, 0, 0, false},
+		{"unknown id", "id=nope", http.StatusNotFound, 0, 0, false},
+		{"missing id", "", http.StatusBadRequest, 0, 0, false},
+		{"invalid offset", "id=" + last + "&offset=-1", http.StatusBadRequest, 0, 0, false},
+		{"invalid limit", "id=" + last + "&limit=x", http.StatusBadRequest, 0, 0, false},
+	}
+	for _, tt := range tests {
+		status, result := get(tt.query)
+		if status != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, status, tt.wantStatus, result.Error)
+			continue
+		}
+		if status != http.StatusOK {
+			if result.Status != "error" || result.Error == "" {
+				t.Errorf("%s: expected an error response, got %+v", tt.name, result)
+			}
+			continue
+		}
+		if len(result.Rows) != tt.wantRows || result.TotalRows != len(rows) || result.Truncated != tt.truncated {
+			t.Errorf("%s: got %d of %d rows, truncated %v", tt.name, len(result.Rows), result.TotalRows, result.Truncated)
+		}
+		if tt.wantRows > 0 && result.Rows[0][0] != tt.wantFirst {
+			t.Errorf("%s: first row = %v, want %v", tt.name, result.Rows[0][0], tt.wantFirst)
+		}
+	}
+
+	// Results expire after the TTL, even when the cache isn't full
+	server.results.mu.Lock()
+	server.results.entries[ids[1]].created = time.Now().Add(-resultCacheTTL)
+	server.results.mu.Unlock()
+	if status, _ := get("id=" + ids[1]); status != http.StatusNotFound {
+		t.Errorf("Expected an expired result to be gone, got status %d", status)
+	}
+	if status, _ := get("id=" + last); status != http.StatusOK {
+		t.Errorf("Expected a recent result to be kept, got status %d", status)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	server := NewServer(ServerConfig{MaxUpload: DefaultMaxUpload})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	get := func(query string) (*http.Response, []byte) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/download?" + query)
+		if err != nil {
+			t.Fatalf("GET /download failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, body
+	}
+
+	// More rows than a page, all of which are downloaded
+	rows := make([][]interface{}, DefaultPageSize+500)
+	for i := range rows {
+		rows[i] = []interface{}{int64(i), fmt.Sprintf("row %d", i)}
+	}
+	id := server.results.put([]string{"id", "label"}, rows, false)
+
+	tests := []struct {
+		format      string
+		contentType string
+		filename    string
+		count       func(body []byte) (int, error) // Rows in the body, without the header
+	}{
+		{"csv", "text/csv; charset=utf-8", "export.csv", func(body []byte) (int, error) {
+			return strings.Count(string(body), "\n") - 1, nil
+		}},
+		{"json", "application/json; charset=utf-8", "export.json", func(body []byte) (int, error) {
+			var decoded []map[string]interface{}
+			err := json.Unmarshal(body, &decoded)
+			return len(decoded), err
+		}},
+		{"ndjson", "application/x-ndjson", "export.ndjson", func(body []byte) (int, error) {
+			return strings.Count(string(body), "\n"), nil
+		}},
+		{"XLSX", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "export.xlsx", func(body []byte) (int, error) {
+			f, err := excelize.OpenReader(bytes.NewReader(body))
+			if err != nil {
+				return 0, err
+			}
+			defer f.Close()
+			sheetRows, err := f.GetRows(f.GetSheetName(0))
+			return len(sheetRows) - 1, err
+		}},
+	}
+	for _, tt := range tests {
+		resp, body := get("id=" + id + "&format=" + tt.format)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status = %d: %s", tt.format, resp.StatusCode, body)
+			continue
+		}
+		if got := resp.Header.Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.format, got, tt.contentType)
+		}
+		if got, want := resp.Header.Get("Content-Disposition"), `attachment; filename="`+tt.filename+`"`; got != want {
+			t.Errorf("%s: Content-Disposition = %q, want %q", tt.format, got, want)
+		}
+		if n, err := tt.count(body); err != nil || n != len(rows) {
+			t.Errorf("%s: got %d rows, %v, want %d", tt.format, n, err, len(rows))
+		}
+	}
+
+	// Errors are JSON, not attachments
+	expired := server.results.put([]string{"id"}, [][]interface{}{{1}}, false)
+	server.results.mu.Lock()
+	for _, e := range server.results.entries {
+		e.created = time.Now().Add(-resultCacheTTL)
+	}
+	server.results.mu.Unlock()
+	for _, tt := range []struct {
+		query  string
+		status int
+	}{
+		{"id=" + id + "&format=yaml", http.StatusBadRequest},
+		{"id=" + id, http.StatusBadRequest},
+		{"format=csv", http.StatusBadRequest},
+		{"id=nope&format=csv", http.StatusNotFound},
+		{"id=" + expired + "&format=csv", http.StatusNotFound},
+	} {
+		resp, body := get(tt.query)
+		var result QueryResponse
+		if resp.StatusCode != tt.status || json.Unmarshal(body, &result) != nil || result.Status != "error" {
+			t.Errorf("%s: got %d %s, want a %d error", tt.query, resp.StatusCode, body, tt.status)
+		}
+		if got := resp.Header.Get("Content-Disposition"); got != "" {
+			t.Errorf("%s: expected no attachment, got %q", tt.query, got)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+package core
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	"modernc.org/sqlite"
+)
+
+// aggregateFunctions is the library of aggregate functions registered on every engine.
+// They can also be used as window functions, e.g. median(x) OVER (PARTITION BY y).
+var aggregateFunctions = []Function{
+	{
+		Name:        "median",
+		Signature:   "median(value)",
+		Description: "The middle value, interpolated between the two middle values if there is an even number of them",
+		Aggregate:   true,
+		minArgs:     1, maxArgs: 1, deterministic: true,
+		newAggregate: func() aggregator { return &percentileAgg{name: "median", fraction: 0.5} },
+	},
+	{
+		Name:        "percentile_cont",
+		Signature:   "percentile_cont(value, fraction)",
+		Description: "The value at a fraction between 0 and 1 of the sorted values, interpolated between the nearest two",
+		Aggregate:   true,
+		minArgs:     2, maxArgs: 2, deterministic: true,
+		newAggregate: func() aggregator { return &percentileAgg{name: "percentile_cont"} },
+	},
+	{
+		Name:        "percentile_disc",
+		Signature:   "percentile_disc(value, fraction)",
+		Description: "The first of the sorted values whose position is at or above a fraction between 0 and 1; works for any type",
+		Aggregate:   true,
+		minArgs:     2, maxArgs: 2, deterministic: true,
+		newAggregate: func() aggregator { return &percentileDiscAgg{} },
+	},
+	{
+		Name:        "mode",
+		Signature:   "mode(value)",
+		Description: "The most frequent value; the smallest one if several are equally frequent",
+		Aggregate:   true,
+		minArgs:     1, maxArgs: 1, deterministic: true,
+		newAggregate: func() aggregator { return &modeAgg{counts: make(map[valueKey]int)} },
+	},
+	{
+		Name:        "stddev_samp",
+		Signature:   "stddev_samp(value)",
+		Description: "Sample standard deviation; NULL for fewer than 2 values",
+		Aggregate:   true,
+		minArgs:     1, maxArgs: 1, deterministic: true,
+		newAggregate: func() aggregator {
+			return &varianceAgg{name: "stddev_samp", sample: true, sqrt: true}
+		},
+	},
+	{
+		Name:        "stddev_pop",
+		Signature:   "stddev_pop(value)",
+		Description: "Population standard deviation",
+		Aggregate:   true,
+		minArgs:     1, maxArgs: 1, deterministic: true,
+		newAggregate: func() aggregator { return &varianceAgg{name: "stddev_pop", sqrt: true} },
+	},
+	{
+		Name:        "variance",
+		Signature:   "variance(value)",
+		Description: "Sample variance; NULL for fewer than 2 values",
+		Aggregate:   true,
+		minArgs:     1, maxArgs: 1, deterministic: true,
+		newAggregate: func() aggregator { return &varianceAgg{name: "variance", sample: true} },
+	},
+	{
+		Name:        "var_pop",
+		Signature:   "var_pop(value)",
+		Description: "Population variance",
+		Aggregate:   true,
+		minArgs:     1, maxArgs: 1, deterministic: true,
+		newAggregate: func() aggregator { return &varianceAgg{name: "var_pop"} },
+	},
+	{
+		Name:        "corr",
+		Signature:   "corr(y, x)",
+		Description: "Pearson correlation coefficient of the rows where both values are set, between -1 and 1",
+		Aggregate:   true,
+		minArgs:     2, maxArgs: 2, deterministic: true,
+		newAggregate: func() aggregator { return &corrAgg{} },
+	},
+	{
+		Name:        "approx_count_distinct",
+		Signature:   "approx_count_distinct(value)",
+		Description: "Estimated number of distinct values (HyperLogLog, typically within 1%), using little memory on large tables",
+		Aggregate:   true,
+		minArgs:     1, maxArgs: 1, deterministic: true,
+		newAggregate: func() aggregator { return newHyperLogLog() },
+	},
+}
+
+// aggregator accumulates the rows of one group, or window frame, of an aggregate function
+type aggregator interface {
+	step(args []driver.Value) error
+	inverse(args []driver.Value) error // Removes a row that left a sliding window frame
+	value() (driver.Value, error)
+}
+
+// aggregateFunction adapts an aggregator to the SQLite driver
+type aggregateFunction struct {
+	fn  Function
+	agg aggregator
+}
+
+func (f Function) makeAggregate(sqlite.FunctionContext) (sqlite.AggregateFunction, error) {
+	return &aggregateFunction{fn: f, agg: f.newAggregate()}, nil
+}
+
+func (a *aggregateFunction) Step(_ *sqlite.FunctionContext, args []driver.Value) error {
+	if err := a.fn.checkArgs(args); err != nil {
+		return err
+	}
+	return a.agg.step(args)
+}
+
+func (a *aggregateFunction) WindowInverse(_ *sqlite.FunctionContext, args []driver.Value) error {
+	return a.agg.inverse(args)
+}
+
+func (a *aggregateFunction) WindowValue(*sqlite.FunctionContext) (driver.Value, error) {
+	return a.agg.value()
+}
+
+func (a *aggregateFunction) Final(*sqlite.FunctionContext) {}
+
+// numberArg converts a SQL value to a number; ok is false for NULL
+func numberArg(name string, v driver.Value) (n float64, ok bool, err error) {
+	switch val := v.(type) {
+	case nil:
+		return 0, false, nil
+	case int64:
+		return float64(val), true, nil
+	case float64:
+		return val, true, nil
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+			return f, true, nil
+		}
+		return 0, false, fmt.Errorf("%s: %q is not a number", name, val)
+	default:
+		return 0, false, fmt.Errorf("%s: %v is not a number", name, v)
+	}
+}
+
+// fractionArg reads the fraction argument of a percentile function
+func fractionArg(name string, v driver.Value) (float64, error) {
+	f, ok, err := numberArg(name, v)
+	if err != nil || !ok || f < 0 || f > 1 {
+		return 0, fmt.Errorf("%s: fraction must be a number between 0 and 1", name)
+	}
+	return f, nil
+}
+
+// ownValue copies a blob, since the driver reuses argument memory after a call returns
+func ownValue(v driver.Value) driver.Value {
+	if b, ok := v.([]byte); ok {
+		return append([]byte(nil), b...)
+	}
+	return v
+}
+
+// compareValues orders SQL values like SQLite: numbers, then text, then blobs
+func compareValues(a, b driver.Value) int {
+	rank := func(v driver.Value) int {
+		switch v.(type) {
+		case int64, float64:
+			return 0
+		case string:
+			return 1
+		default:
+			return 2
+		}
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra - rb
+	}
+
+	switch x := a.(type) {
+	case int64:
+		if y, ok := b.(int64); ok {
+			return cmpOrdered(x, y)
+		}
+		return cmpOrdered(float64(x), b.(float64))
+	case float64:
+		if y, ok := b.(int64); ok {
+			return cmpOrdered(x, float64(y))
+		}
+		return cmpOrdered(x, b.(float64))
+	case string:
+		return strings.Compare(x, b.(string))
+	default:
+		return strings.Compare(textArg(a), textArg(b))
+	}
+}
+
+func cmpOrdered[T int64 | float64](x, y T) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// percentileAgg computes a continuous percentile. Values are kept sorted so that
+// the result can be read for every row when used as a window function.
+type percentileAgg struct {
+	name     string
+	fraction float64 // Fixed for median, otherwise taken from the second argument
+	values   []float64
+}
+
+func (p *percentileAgg) step(args []driver.Value) error {
+	if len(args) == 2 {
+		f, err := fractionArg(p.name, args[1])
+		if err != nil {
+			return err
+		}
+		p.fraction = f
+	}
+	x, ok, err := numberArg(p.name, args[0])
+	if !ok {
+		return err
+	}
+	i := sort.SearchFloat64s(p.values, x)
+	p.values = append(p.values, 0)
+	copy(p.values[i+1:], p.values[i:])
+	p.values[i] = x
+	return nil
+}
+
+func (p *percentileAgg) inverse(args []driver.Value) error {
+	x, ok, err := numberArg(p.name, args[0])
+	if !ok {
+		return err
+	}
+	if i := sort.SearchFloat64s(p.values, x); i < len(p.values) && p.values[i] == x {
+		p.values = append(p.values[:i], p.values[i+1:]...)
+	}
+	return nil
+}
+
+func (p *percentileAgg) value() (driver.Value, error) {
+	if len(p.values) == 0 {
+		return nil, nil
+	}
+	pos := p.fraction * float64(len(p.values)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return p.values[lo] + (p.values[hi]-p.values[lo])*(pos-float64(lo)), nil
+}
+
+// percentileDiscAgg computes a discrete percentile, which is always one of the values
+type percentileDiscAgg struct {
+	fraction float64
+	values   []driver.Value // Sorted with compareValues
+}
+
+func (p *percentileDiscAgg) step(args []driver.Value) error {
+	f, err := fractionArg("percentile_disc", args[1])
+	if err != nil {
+		return err
+	}
+	p.fraction = f
+	if args[0] == nil {
+		return nil
+	}
+
+	v := ownValue(args[0])
+	i := sort.Search(len(p.values), func(i int) bool { return compareValues(p.values[i], v) >= 0 })
+	p.values = append(p.values, nil)
+	copy(p.values[i+1:], p.values[i:])
+	p.values[i] = v
+	return nil
+}
+
+func (p *percentileDiscAgg) inverse(args []driver.Value) error {
+	if args[0] == nil {
+		return nil
+	}
+	v := args[0]
+	i := sort.Search(len(p.values), func(i int) bool { return compareValues(p.values[i], v) >= 0 })
+	if i < len(p.values) && compareValues(p.values[i], v) == 0 {
+		p.values = append(p.values[:i], p.values[i+1:]...)
+	}
+	return nil
+}
+
+func (p *percentileDiscAgg) value() (driver.Value, error) {
+	if len(p.values) == 0 {
+		return nil, nil
+	}
+	i := int(math.Ceil(p.fraction*float64(len(p.values)))) - 1
+	return p.values[max(i, 0)], nil
+}
+
+// valueKey identifies equal SQL values: integers and whole floats compare equal, like in SQLite
+type valueKey struct {
+	kind byte // 'n' number, 's' text, 'b' blob
+	num  float64
+	text string
+}
+
+func keyOf(v driver.Value) valueKey {
+	switch val := v.(type) {
+	case int64:
+		return valueKey{kind: 'n', num: float64(val)}
+	case float64:
+		return valueKey{kind: 'n', num: val}
+	case string:
+		return valueKey{kind: 's', text: val}
+	default:
+		return valueKey{kind: 'b', text: textArg(v)}
+	}
+}
+
+// modeAgg counts every distinct value
+type modeAgg struct {
+	counts map[valueKey]int
+	values map[valueKey]driver.Value
+}
+
+func (m *modeAgg) step(args []driver.Value) error {
+	if args[0] == nil {
+		return nil
+	}
+	key := keyOf(args[0])
+	if m.counts[key] == 0 {
+		if m.values == nil {
+			m.values = make(map[valueKey]driver.Value)
+		}
+		m.values[key] = ownValue(args[0])
+	}
+	m.counts[key]++
+	return nil
+}
+
+func (m *modeAgg) inverse(args []driver.Value) error {
+	if args[0] == nil {
+		return nil
+	}
+	key := keyOf(args[0])
+	if m.counts[key]--; m.counts[key] <= 0 {
+		delete(m.counts, key)
+		delete(m.values, key)
+	}
+	return nil
+}
+
+func (m *modeAgg) value() (driver.Value, error) {
+	var best driver.Value
+	bestCount := 0
+	for key, count := range m.counts {
+		v := m.values[key]
+		if count > bestCount || (count == bestCount && compareValues(v, best) < 0) {
+			best, bestCount = v, count
+		}
+	}
+	return best, nil
+}
+
+// moments keeps the running means and (co-)moments of two variables with Welford's
+// method, which stays accurate where sums of squares would lose precision
+type moments struct {
+	n            float64
+	meanX, meanY float64
+	m2X, m2Y     float64 // Sums of squared deviations from the mean
+	cXY          float64 // Sum of the products of the deviations of x and y
+}
+
+func (m *moments) add(x, y float64) {
+	m.n++
+	dx, dy := x-m.meanX, y-m.meanY
+	m.meanX += dx / m.n
+	m.meanY += dy / m.n
+	m.m2X += dx * (x - m.meanX)
+	m.m2Y += dy * (y - m.meanY)
+	m.cXY += dx * (y - m.meanY)
+}
+
+func (m *moments) remove(x, y float64) {
+	if m.n <= 1 {
+		*m = moments{}
+		return
+	}
+	n := m.n - 1
+	prevX := (m.n*m.meanX - x) / n
+	prevY := (m.n*m.meanY - y) / n
+	m.m2X = max(m.m2X-(x-prevX)*(x-m.meanX), 0)
+	m.m2Y = max(m.m2Y-(y-prevY)*(y-m.meanY), 0)
+	m.cXY -= (x - prevX) * (y - m.meanY)
+	m.n, m.meanX, m.meanY = n, prevX, prevY
+}
+
+// varianceAgg computes the variance or standard deviation of a sample or population
+type varianceAgg struct {
+	name   string
+	sample bool // Divide by n-1 instead of n
+	sqrt   bool // Standard deviation instead of variance
+	m      moments
+}
+
+func (v *varianceAgg) step(args []driver.Value) error {
+	x, ok, err := numberArg(v.name, args[0])
+	if ok {
+		v.m.add(x, x)
+	}
+	return err
+}
+
+func (v *varianceAgg) inverse(args []driver.Value) error {
+	x, ok, err := numberArg(v.name, args[0])
+	if ok {
+		v.m.remove(x, x)
+	}
+	return err
+}
+
+func (v *varianceAgg) value() (driver.Value, error) {
+	n := v.m.n
+	if v.sample {
+		n--
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	variance := v.m.m2X / n
+	if v.sqrt {
+		return math.Sqrt(variance), nil
+	}
+	return variance, nil
+}
+
+// corrAgg computes the Pearson correlation coefficient of pairs where neither value is NULL
+type corrAgg struct {
+	m moments
+}
+
+func (c *corrAgg) pair(args []driver.Value) (float64, float64, bool, error) {
+	y, okY, err := numberArg("corr", args[0])
+	if err != nil {
+		return 0, 0, false, err
+	}
+	x, okX, err := numberArg("corr", args[1])
+	return x, y, okX && okY, err
+}
+
+func (c *corrAgg) step(args []driver.Value) error {
+	x, y, ok, err := c.pair(args)
+	if ok {
+		c.m.add(x, y)
+	}
+	return err
+}
+
+func (c *corrAgg) inverse(args []driver.Value) error {
+	x, y, ok, err := c.pair(args)
+	if ok {
+		c.m.remove(x, y)
+	}
+	return err
+}
+
+func (c *corrAgg) value() (driver.Value, error) {
+	denominator := math.Sqrt(c.m.m2X * c.m.m2Y)
+	if c.m.n < 2 || denominator == 0 {
+		return nil, nil
+	}
+	return c.m.cXY / denominator, nil
+}
+
+// hllPrecision is the number of hash bits that pick a HyperLogLog register. 2^14
+// registers use 16KB per group and give a standard error of about 0.8%.
+const hllPrecision = 14
+
+// hyperLogLog estimates the number of distinct values from the longest runs of
+// leading zero bits seen in their hashes
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+func (h *hyperLogLog) step(args []driver.Value) error {
+	if args[0] == nil {
+		return nil
+	}
+	hash := hashValue(args[0])
+	i := hash >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	h.registers[i] = max(h.registers[i], rank)
+	return nil
+}
+
+func (h *hyperLogLog) inverse([]driver.Value) error {
+	return fmt.Errorf("approx_count_distinct can't be used with a sliding window frame")
+}
+
+func (h *hyperLogLog) value() (driver.Value, error) {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate while many registers are still empty
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate)), nil
+}
+
+// hashValue hashes a SQL value so that values equal in SQLite hash the same
+func hashValue(v driver.Value) uint64 {
+	key := keyOf(v)
+	h := fnv.New64a()
+	h.Write([]byte{key.kind})
+	if key.kind == 'n' {
+		h.Write([]byte(strconv.FormatFloat(key.num, 'g', -1, 64)))
+	} else {
+		h.Write([]byte(key.text))
+	}
+
+	// FNV alone doesn't spread similar inputs over the high bits; finish with the MurmurHash3 mixer
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
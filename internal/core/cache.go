@@ -0,0 +1,386 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/runsql/internal/parsers"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DefaultCacheSize is the default limit on the total size of a load cache
+const DefaultCacheSize = 5 << 30
+
+// cacheFormat is part of every cache key; bump it when the way tables are loaded changes
+// so that entries written by older versions are no longer used
+const cacheFormat = "2"
+
+// CacheKey identifies the input of a cached table. The table is reused only while the
+// file has the same path, size and modification time, and is read with the same options.
+type CacheKey struct {
+	Path    string    // Absolute path of the file
+	Size    int64     // Size of the file in bytes
+	ModTime time.Time // Modification time of the file
+	Options string    // Anything else that affects how the file is read, e.g. its format
+}
+
+// FileCacheKey returns the cache key of a file as it currently is on disk
+func FileCacheKey(path, options string) (CacheKey, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return CacheKey{}, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return CacheKey{}, err
+	}
+	return CacheKey{Path: abs, Size: info.Size(), ModTime: info.ModTime(), Options: options}, nil
+}
+
+// CacheableSource is a Source that can tell which file it reads. When the engine has a
+// load cache, Load asks for the key first and only reads the source on a cache miss.
+type CacheableSource interface {
+	parsers.Source
+	CacheKey() (CacheKey, error)
+}
+
+// LoadCache keeps loaded tables in SQLite files, so that loading an unchanged file
+// again copies the table instead of parsing the file. When the cache grows past its
+// maximum size, the least recently used entries are removed.
+type LoadCache struct {
+	dir     string
+	maxSize int64
+}
+
+// CacheEntry describes a table in the load cache
+type CacheEntry struct {
+	File       string    `json:"file"`        // Path of the cache entry
+	Source     string    `json:"source"`      // Path of the file the table was loaded from
+	SourceSize int64     `json:"source_size"` // Size of that file when it was loaded
+	ModTime    time.Time `json:"mod_time"`    // Modification time of that file when it was loaded
+	Options    string    `json:"options"`
+	Rows       int64     `json:"rows"`
+	Size       int64     `json:"size"`      // Size of the cache entry in bytes
+	LastUsed   time.Time `json:"last_used"` // When the entry was last written or reused
+}
+
+// DefaultCacheDir returns the directory of the load cache in the user's cache directory
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "runsql", "tables"), nil
+}
+
+// NewLoadCache returns a load cache stored in dir, which is created when the first
+// entry is written. A maxSize of 0 or less means DefaultCacheSize.
+func NewLoadCache(dir string, maxSize int64) *LoadCache {
+	if maxSize <= 0 {
+		maxSize = DefaultCacheSize
+	}
+	return &LoadCache{dir: dir, maxSize: maxSize}
+}
+
+// Dir returns the directory of the cache
+func (c *LoadCache) Dir() string {
+	return c.dir
+}
+
+// MaxSize returns the size limit of the cache in bytes
+func (c *LoadCache) MaxSize() int64 {
+	return c.maxSize
+}
+
+// UseCache makes Load reuse and fill the given cache for sources that implement
+// CacheableSource. A nil cache turns caching off.
+func (e *Engine) UseCache(c *LoadCache) {
+	e.cache = c
+}
+
+// entryPath returns the file of a cache entry. Entries of the same file and options share
+// a prefix, so that an entry can replace the ones made before the file changed.
+func (c *LoadCache) entryPath(key CacheKey) (path, prefix string) {
+	source := sha256.Sum256([]byte(cacheFormat + "\x00" + key.Path + "\x00" + key.Options))
+	version := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%d", key.Size, key.ModTime.UnixNano())))
+	prefix = hex.EncodeToString(source[:8])
+	return filepath.Join(c.dir, prefix+"-"+hex.EncodeToString(version[:8])+".sqlite"), prefix
+}
+
+// loadFromCache copies a cached table into the engine and returns its row count. It
+// reports false if there is no valid entry for the key.
+func (e *Engine) loadFromCache(tableName string, key CacheKey) (int64, bool) {
+	path, _ := e.cache.entryPath(key)
+	if _, err := os.Stat(path); err != nil {
+		return 0, false
+	}
+
+	var rows int64
+	err := e.withAttached(path, "cache", func(conn *sql.Conn) error {
+		ctx := context.Background()
+		columns, types, err := tableColumns(ctx, conn, "cache", "data")
+		if err != nil {
+			return err
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec("DROP TABLE IF EXISTS main." + quoteIdentifier(tableName)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(buildCreateTableSQL(tableName, columns, types)); err != nil {
+			return err
+		}
+		res, err := tx.Exec(fmt.Sprintf(`INSERT INTO main.%s SELECT * FROM cache."data"`, quoteIdentifier(tableName)))
+		if err != nil {
+			return err
+		}
+		rows, _ = res.RowsAffected()
+		return tx.Commit()
+	})
+	if err != nil {
+		// Either way the file is loaded again, but only a damaged entry is dropped: one
+		// that is busy or can't be attached right now may still be good
+		if damagedCacheEntry(err) {
+			os.Remove(path)
+		}
+		return 0, false
+	}
+
+	// Reading an entry counts as using it for the LRU policy
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return rows, true
+}
+
+// storeInCache writes a loaded table to the cache, replacing older entries of the same
+// file, and then trims the cache to its maximum size. Caching is best effort: a table
+// that can't be cached is still loaded.
+func (e *Engine) storeInCache(tableName string, key CacheKey) error {
+	if err := os.MkdirAll(e.cache.dir, 0o755); err != nil {
+		return err
+	}
+	path, prefix := e.cache.entryPath(key)
+
+	// Write next to the entry and rename, so that readers never see a partial entry
+	tmp, err := os.CreateTemp(e.cache.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	err = e.withAttached(tmpPath, "cache", func(conn *sql.Conn) error {
+		ctx := context.Background()
+		columns, types, err := tableColumns(ctx, conn, "main", tableName)
+		if err != nil {
+			return err
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		stmts := []string{
+			fmt.Sprintf(`CREATE TABLE cache."data" (%s)`, columnDefinitions(columns, types)),
+			fmt.Sprintf(`INSERT INTO cache."data" SELECT * FROM main.%s`, quoteIdentifier(tableName)),
+			`CREATE TABLE cache.meta (source TEXT, source_size INTEGER, mod_time TEXT, options TEXT, rows INTEGER)`,
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(`INSERT INTO cache.meta SELECT ?, ?, ?, ?, count(*) FROM cache."data"`,
+			key.Path, key.Size, key.ModTime.Format(time.RFC3339Nano), key.Options)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return err
+	}
+
+	// Entries of earlier versions of the file can never be used again
+	stale, _ := filepath.Glob(filepath.Join(e.cache.dir, prefix+"-*.sqlite"))
+	for _, old := range stale {
+		os.Remove(old)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return e.cache.trim()
+}
+
+// tableColumns returns the column names and declared types of a table
+func tableColumns(ctx context.Context, q queryer, schema, table string) ([]string, []string, error) {
+	_, info, _, err := queryRows(ctx, q, fmt.Sprintf("PRAGMA %s.table_info(%s)", schema, quoteIdentifier(table)), 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(info) == 0 {
+		return nil, nil, fmt.Errorf("%w: %s.%s", errTableNotFound, schema, table)
+	}
+
+	columns := make([]string, len(info))
+	types := make([]string, len(info))
+	for i, col := range info {
+		columns[i] = fmt.Sprintf("%v", col[1])
+		types[i] = fmt.Sprintf("%v", col[2])
+	}
+	return columns, types, nil
+}
+
+// errTableNotFound is returned by tableColumns for a table that doesn't exist
+var errTableNotFound = errors.New("table not found")
+
+// damagedCacheEntry reports whether an error reading a cache entry means the entry is
+// unusable: its file is not a database or is corrupt, or it has no data table
+func damagedCacheEntry(err error) bool {
+	if errors.Is(err, errTableNotFound) {
+		return true
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff { // The primary result code
+		case sqlite3.SQLITE_CORRUPT, sqlite3.SQLITE_NOTADB:
+			return true
+		}
+	}
+	return false
+}
+
+// withAttached attaches a database file to a dedicated connection for the duration of fn
+func (e *Engine) withAttached(path, schema string, fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("ATTACH DATABASE ? AS %s", schema), path); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE "+schema)
+
+	return fn(conn)
+}
+
+// trim removes the least recently used entries until the cache fits its maximum size
+func (c *LoadCache) trim() error {
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, f := range files {
+		total += f.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, f := range files {
+		if total <= c.maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, f.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= f.Size()
+	}
+	return nil
+}
+
+// files returns the entries of the cache directory
+func (c *LoadCache) files() ([]os.FileInfo, error) {
+	dirEntries, err := os.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []os.FileInfo
+	for _, d := range dirEntries {
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") || filepath.Ext(d.Name()) != ".sqlite" {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// Entries returns the entries of the cache, most recently used first
+func (c *LoadCache) Entries() ([]CacheEntry, error) {
+	files, err := c.files()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().After(files[j].ModTime()) })
+
+	entries := make([]CacheEntry, 0, len(files))
+	for _, f := range files {
+		entry := CacheEntry{File: filepath.Join(c.dir, f.Name()), Size: f.Size(), LastUsed: f.ModTime()}
+		if err := readCacheMeta(&entry); err != nil {
+			entry.Source = "(unreadable: " + err.Error() + ")"
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// readCacheMeta fills in an entry from the metadata stored in its file
+func readCacheMeta(entry *CacheEntry) error {
+	db, err := sql.Open("sqlite", fileURI(entry.File, "mode=ro"))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var modTime string
+	err = db.QueryRow("SELECT source, source_size, mod_time, options, rows FROM meta").
+		Scan(&entry.Source, &entry.SourceSize, &modTime, &entry.Options, &entry.Rows)
+	if err != nil {
+		return err
+	}
+	entry.ModTime, _ = time.Parse(time.RFC3339Nano, modTime)
+	return nil
+}
+
+// Clear removes every entry of the cache and returns how many there were
+func (c *LoadCache) Clear() (int, error) {
+	files, err := c.files()
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range files {
+		if err := os.Remove(filepath.Join(c.dir, f.Name())); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+	}
+	return len(files), nil
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// sampleValueCount is the number of sample values collected per column.
+	sampleValueCount = 3
+
+	// sampleScanRows is the number of rows searched for sample values, so that a column
+	// with fewer distinct values than sampleValueCount doesn't cost a full scan.
+	sampleScanRows = 10000
+)
+
+// exactDistinctRows is the largest table whose distinct counts are exact. Counting
+// distinct values exactly keeps every one of them in memory, for every column, so the
+// columns of larger tables get estimates from approx_count_distinct instead.
+var exactDistinctRows int64 = 100000
+
+// Catalog returns the metadata of every table in the database, in creation order,
+// including row counts and per-column statistics.
+func (e *Engine) Catalog() ([]Table, error) {
+	names, err := e.Tables()
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]Table, 0, len(names))
+	for _, name := range names {
+		table, err := e.DescribeTable(name)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// Tables returns the names of the tables in the database, in creation order.
+func (e *Engine) Tables() ([]string, error) {
+	_, rows, err := e.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	names := make([]string, len(rows))
+	for i, row := range rows {
+		names[i] = fmt.Sprintf("%v", row[0])
+	}
+	return names, nil
+}
+
+// DescribeTable returns the metadata of a single table, including its row count
+// and per-column statistics. The distinct counts of tables of more than 100,000 rows
+// are estimates, within about 1%.
+func (e *Engine) DescribeTable(name string) (Table, error) {
+	table := Table{Name: name}
+
+	// Column names and declared types
+	_, info, err := e.Query(fmt.Sprintf("PRAGMA table_info(%s)", quoteIdentifier(name)))
+	if err != nil {
+		return table, fmt.Errorf("failed to describe table %s: %w", name, err)
+	}
+	if len(info) == 0 {
+		return table, fmt.Errorf("no such table: %s", name)
+	}
+	for _, col := range info {
+		// table_info rows: cid, name, type, notnull, dflt_value, pk
+		table.Columns = append(table.Columns, fmt.Sprintf("%v", col[1]))
+		table.Types = append(table.Types, fmt.Sprintf("%v", col[2]))
+	}
+
+	_, countRows, err := e.Query(fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdentifier(name)))
+	if err != nil {
+		return table, fmt.Errorf("failed to count the rows of %s: %w", name, err)
+	}
+	table.RowCount = toInt64(countRows[0][0])
+	approx := table.RowCount > exactDistinctRows
+	distinct := "COUNT(DISTINCT %s)"
+	if approx {
+		distinct = "approx_count_distinct(%s)"
+	}
+
+	// Per-column aggregates in a single scan
+	var exprs []string
+	for _, col := range table.Columns {
+		value := fmt.Sprintf("NULLIF(%s, '')", quoteIdentifier(col))
+		exprs = append(exprs,
+			fmt.Sprintf("COUNT(%s)", value),
+			fmt.Sprintf(distinct, value),
+			fmt.Sprintf("MIN(%s)", value),
+			fmt.Sprintf("MAX(%s)", value),
+		)
+	}
+	_, aggRows, err := e.Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(exprs, ", "), quoteIdentifier(name)))
+	if err != nil {
+		return table, fmt.Errorf("failed to compute statistics for %s: %w", name, err)
+	}
+	agg := aggRows[0]
+
+	table.Stats = make([]ColumnStats, len(table.Columns))
+	for i, col := range table.Columns {
+		base := i * 4
+		stats := ColumnStats{
+			Nullable:       toInt64(agg[base]) < table.RowCount,
+			Distinct:       toInt64(agg[base+1]),
+			DistinctApprox: approx,
+			Min:            agg[base+2],
+			Max:            agg[base+3],
+		}
+
+		_, samples, err := e.Query(fmt.Sprintf(
+			"SELECT DISTINCT %[1]s FROM (SELECT %[1]s FROM %[2]s LIMIT %[4]d) WHERE NULLIF(%[1]s, '') IS NOT NULL LIMIT %[3]d",
+			quoteIdentifier(col), quoteIdentifier(name), sampleValueCount, sampleScanRows))
+		if err != nil {
+			return table, fmt.Errorf("failed to sample column %s: %w", col, err)
+		}
+		stats.Samples = make([]interface{}, len(samples))
+		for j, sample := range samples {
+			stats.Samples[j] = sample[0]
+		}
+
+		table.Stats[i] = stats
+	}
+
+	return table, nil
+}
+
+// toInt64 converts an integer result of an aggregate query.
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,227 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/zulfikawr/runsql/internal/parsers"
+)
+
+// RowWriter receives the rows produced by Convert. writers.Writer satisfies it.
+type RowWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(row []interface{}) error
+}
+
+// ColumnSelection picks a source column and the name it is written under.
+type ColumnSelection struct {
+	Name  string // Column of the source, as it would be named in a loaded table
+	Alias string // Output column name; Name if empty
+}
+
+// ConvertOptions controls how Convert transforms rows on their way to the writer.
+type ConvertOptions struct {
+	Columns []ColumnSelection // Columns to write, in order; every column if empty
+	Where   string            // SQL expression a row must satisfy to be written; every row if empty
+}
+
+// Convert streams rows from a source to a writer without loading them into a table.
+// Values are typed the same way Load types them, so the output matches a
+// "SELECT * FROM table" over the loaded file. The filter, if any, is evaluated by
+// SQLite one row at a time and may use any column of the source, including ones
+// that are not selected. It returns the number of rows written.
+func Convert(source parsers.Source, w RowWriter, opts ConvertOptions) (int64, error) {
+	sourceHeaders, err := source.GetHeaders()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get headers: %w", err)
+	}
+	headers := make([]string, len(sourceHeaders))
+	for i, h := range sourceHeaders {
+		headers[i] = sanitizeHeader(h)
+	}
+
+	indexes, names, err := projectColumns(headers, opts.Columns)
+	if err != nil {
+		return 0, err
+	}
+
+	var filter *rowFilter
+	if strings.TrimSpace(opts.Where) != "" {
+		filter, err = newRowFilter(headers, opts.Where)
+		if err != nil {
+			return 0, err
+		}
+		defer filter.Close()
+	}
+
+	rowCh, err := source.Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start reading: %w", err)
+	}
+
+	// If we return early, keep draining the channel so the source's goroutine can exit
+	drained := false
+	defer func() {
+		if !drained {
+			go func() {
+				for range rowCh {
+				}
+			}()
+		}
+	}()
+
+	// Infer the column types from the first rows, as Load does
+	var sample [][]interface{}
+	for len(sample) < inferenceSampleSize {
+		row, ok := <-rowCh
+		if !ok {
+			break
+		}
+		sample = append(sample, row)
+	}
+	columnTypes := sourceColumnTypes(source, len(headers), sample)
+
+	if err := w.WriteHeader(names); err != nil {
+		return 0, err
+	}
+
+	var written int64
+	writeRow := func(row []interface{}) error {
+		row = normalizeRow(row, len(headers))
+		typed := make([]interface{}, len(row))
+		for i, v := range row {
+			typed[i] = coerceValue(v, columnTypes[i])
+		}
+
+		if filter != nil {
+			match, err := filter.Match(typed)
+			if err != nil {
+				return err
+			}
+			if !match {
+				return nil
+			}
+		}
+
+		out := make([]interface{}, len(indexes))
+		for i, idx := range indexes {
+			out[i] = typed[idx]
+		}
+		written++
+		return w.WriteRow(out)
+	}
+
+	for _, row := range sample {
+		if err := writeRow(row); err != nil {
+			return written, err
+		}
+	}
+	for row := range rowCh {
+		if err := writeRow(row); err != nil {
+			return written, err
+		}
+	}
+	drained = true
+
+	return written, nil
+}
+
+// projectColumns resolves the selected columns to source indexes and output names.
+// Names are sanitized like headers, then matched exactly first and
+// case-insensitively like SQL identifiers second.
+func projectColumns(headers []string, columns []ColumnSelection) ([]int, []string, error) {
+	if len(columns) == 0 {
+		indexes := make([]int, len(headers))
+		for i := range headers {
+			indexes[i] = i
+		}
+		return indexes, headers, nil
+	}
+
+	indexes := make([]int, len(columns))
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		name := sanitizeHeader(col.Name)
+		idx := -1
+		for j, h := range headers {
+			if h == name {
+				idx = j
+				break
+			}
+			if idx < 0 && strings.EqualFold(h, name) {
+				idx = j
+			}
+		}
+		if idx < 0 {
+			return nil, nil, fmt.Errorf("no such column: %s (available: %s)", col.Name, strings.Join(headers, ", "))
+		}
+
+		indexes[i] = idx
+		names[i] = col.Alias
+		if names[i] == "" {
+			names[i] = headers[idx]
+		}
+	}
+	return indexes, names, nil
+}
+
+// rowFilter evaluates a SQL expression against one row at a time, binding the row's
+// values as the columns of a single-row CTE
+type rowFilter struct {
+	engine *Engine
+	stmt   *sql.Stmt
+}
+
+func newRowFilter(headers []string, where string) (*rowFilter, error) {
+	engine, err := NewEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	quoted := make([]string, len(headers))
+	placeholders := make([]string, len(headers))
+	for i, h := range headers {
+		quoted[i] = quoteIdentifier(h)
+		placeholders[i] = "?"
+	}
+	query := fmt.Sprintf("WITH input(%s) AS (VALUES (%s)) SELECT 1 FROM input WHERE %s",
+		strings.Join(quoted, ", "), strings.Join(placeholders, ", "), where)
+
+	stmt, err := engine.db.Prepare(query)
+	if err == nil {
+		// The statement is only compiled when it first runs, so try it on a row of NULLs
+		// to report syntax errors and unknown columns before any output is written
+		var one int
+		err = stmt.QueryRow(make([]interface{}, len(headers))...).Scan(&one)
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+		if err != nil {
+			stmt.Close()
+		}
+	}
+	if err != nil {
+		engine.Close()
+		return nil, fmt.Errorf("invalid filter %q: %w", where, err)
+	}
+	return &rowFilter{engine: engine, stmt: stmt}, nil
+}
+
+// Match reports whether the row satisfies the filter
+func (f *rowFilter) Match(row []interface{}) (bool, error) {
+	var one int
+	err := f.stmt.QueryRow(row...).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate filter: %w", err)
+	}
+	return true, nil
+}
+
+func (f *rowFilter) Close() error {
+	f.stmt.Close()
+	return f.engine.Close()
+}
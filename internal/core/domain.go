@@ -2,7 +2,66 @@ package core
 
 // Table represents the metadata of a loaded table.
 type Table struct {
-	Name    string
-	Columns []string
-	Types   []string // e.g., "TEXT", "INTEGER", "REAL"
+	Name     string
+	Columns  []string
+	Types    []string // e.g., "TEXT", "INTEGER", "REAL"
+	RowCount int64
+	Stats    []ColumnStats // Per-column statistics, in the same order as Columns
+}
+
+// ColumnStats summarizes the values of a single column.
+// Empty strings are treated like NULL, since that is how blank cells are loaded.
+type ColumnStats struct {
+	Nullable       bool          // The column contains NULL or empty values
+	Distinct       int64         // Number of distinct non-empty values
+	DistinctApprox bool          // Distinct is an estimate, as for large tables
+	Min            interface{}   // Smallest non-empty value, nil if there is none
+	Max            interface{}   // Largest non-empty value, nil if there is none
+	Samples        []interface{} // A few distinct non-empty values, from the first rows
+}
+
+// TableProfile holds the profile of every column of a table.
+type TableProfile struct {
+	Table    string          `json:"table"`
+	RowCount int64           `json:"row_count"`
+	Columns  []ColumnProfile `json:"columns"`
+}
+
+// ColumnProfile holds descriptive statistics of a column.
+// As with ColumnStats, empty strings are counted as NULL.
+type ColumnProfile struct {
+	Name        string             `json:"name"`
+	Type        string             `json:"type"`
+	Nulls       int64              `json:"nulls"`
+	NullPercent float64            `json:"null_percent"`
+	Distinct    int64              `json:"distinct"`
+	Min         interface{}        `json:"min"`
+	Max         interface{}        `json:"max"`
+	Mean        *float64           `json:"mean,omitempty"`   // Numeric columns only
+	StdDev      *float64           `json:"stddev,omitempty"` // Numeric columns only, sample standard deviation
+	TopValues   []ValueCount       `json:"top_values"`
+	Lengths     LengthDistribution `json:"lengths"`
+	Patterns    []PatternCount     `json:"patterns"`
+}
+
+// ValueCount is a value and the number of rows holding it.
+type ValueCount struct {
+	Value interface{} `json:"value"`
+	Count int64       `json:"count"`
+}
+
+// LengthDistribution summarizes the lengths of the non-empty values of a column.
+type LengthDistribution struct {
+	Min  int     `json:"min"`
+	P50  int     `json:"p50"`
+	P90  int     `json:"p90"`
+	Max  int     `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+// PatternCount is a value shape (e.g. `\d{5}`) and how many non-empty values match it.
+type PatternCount struct {
+	Pattern string  `json:"pattern"`
+	Count   int64   `json:"count"`
+	Percent float64 `json:"percent"`
 }
@@ -1,24 +1,40 @@
 package core
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	_ "modernc.org/sqlite" // Pure Go SQLite driver
-	"runsql/internal/parsers"
 )
 
 // Engine wraps the SQLite database and handles data loading and querying.
 type Engine struct {
-	db *sql.DB
+	db      *sql.DB
+	cache   *LoadCache  // Set by UseCache
+	loader  *LazyLoader // Set by UseLoader
+	writeMu sync.Mutex  // Serializes the writes of concurrent loads
+	file    bool        // Backed by a database file rather than memory
 }
 
+// engineSeq numbers the in-memory databases so that every engine gets its own.
+var engineSeq atomic.Int64
+
 // NewEngine creates a new in-memory SQLite engine.
 func NewEngine() (*Engine, error) {
-	// Connect to in-memory SQLite database
-	// "cache=shared" allows multiple connections to the same in-memory DB (useful if we add concurrency later)
-	db, err := sql.Open("sqlite", "file::memory:?cache=shared")
+	if err := registerFunctions(); err != nil {
+		return nil, err
+	}
+
+	// Connect to a named in-memory SQLite database
+	// "cache=shared" allows multiple connections to the same in-memory DB, and the unique
+	// name keeps engines created concurrently (e.g. by parallel web requests) isolated
+	dsn := fmt.Sprintf("file:runsql-%d?mode=memory&cache=shared", engineSeq.Add(1))
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
 	}
@@ -31,172 +47,175 @@ func NewEngine() (*Engine, error) {
 	return &Engine{db: db}, nil
 }
 
-// Load reads data from a source and loads it into a table.
-func (e *Engine) Load(tableName string, source parsers.Source) error {
-	// 1. Get Headers
-	headers, err := source.GetHeaders()
-	if err != nil {
-		return fmt.Errorf("failed to get headers: %w", err)
-	}
-
-	// Sanitize headers: replace spaces with underscores, remove non-alphanumeric chars
-	sanitizedHeaders := make([]string, len(headers))
-	for i, h := range headers {
-		sanitizedHeaders[i] = sanitizeHeader(h)
+// OpenEngine creates an engine backed by a SQLite database file, creating the file if it
+// doesn't exist. Tables loaded into it are kept after the engine is closed, so the file
+// can be reopened later or by any other SQLite tool.
+func OpenEngine(path string) (*Engine, error) {
+	if err := registerFunctions(); err != nil {
+		return nil, err
 	}
 
-	// 2. Read first batch to infer types
-	// Since Read() returns a channel, we can't "peek" easily without consuming.
-	// We'll read all data into a buffer first? NO, that defeats streaming.
-	// Strategy:
-	// - Read the first N rows into a buffer.
-	// - Infer types from the buffer.
-	// - Create Table.
-	// - Insert buffered rows.
-	// - Continue streaming the rest.
-
-	const inferenceSampleSize = 100
-	var bufferedRows [][]interface{}
-
-	rowCh, err := source.Read()
+	// Wait instead of failing when another process is writing to the same file
+	db, err := sql.Open("sqlite", fileURI(path, "_pragma=busy_timeout(5000)"))
 	if err != nil {
-		return fmt.Errorf("failed to start reading: %w", err)
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
 	}
 
-	columnTypes := make([]string, len(headers))
-	// Initialize with "TEXT" as fallback
-	for i := range columnTypes {
-		columnTypes[i] = "TEXT"
+	// Verify connection, and that the file is a SQLite database
+	if _, err := db.Exec("SELECT count(*) FROM sqlite_master"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
 	}
 
-	// Read up to sample size
-	for i := 0; i < inferenceSampleSize; i++ {
-		row, ok := <-rowCh
-		if !ok {
-			break
-		}
-		bufferedRows = append(bufferedRows, row)
-	}
-
-	// Infer types based on buffered rows
-	// If a column has ANY non-integer value (that isn't empty/null), it downgrades to Real or Text.
-	// Hierarchy: INTEGER -> REAL -> TEXT
-	for colIdx := range headers {
-		isInt := true
-		isReal := true
-
-		for _, row := range bufferedRows {
-			if colIdx >= len(row) {
-				continue
-			}
-			val := fmt.Sprintf("%v", row[colIdx]) // Convert to string for regex check
-
-			if val == "" {
-				continue // Skip empty values
-			}
-
-			typeStr := InferType(val)
-			if typeStr == "TEXT" {
-				isInt = false
-				isReal = false
-				break
-			}
-			if typeStr == "REAL" {
-				isInt = false
-			}
-		}
+	return &Engine{db: db, file: true}, nil
+}
 
-		if isInt {
-			columnTypes[colIdx] = "INTEGER"
-		} else if isReal {
-			columnTypes[colIdx] = "REAL"
-		} else {
-			columnTypes[colIdx] = "TEXT"
-		}
-	}
+// fileURI returns the SQLite URI of a database file with the given query parameters. The
+// path is escaped, so that a ? or # in it isn't taken as the start of the query.
+func fileURI(path, query string) string {
+	return "file:" + (&url.URL{Path: path}).EscapedPath() + "?" + query
+}
 
-	// 3. Create Table
-	createSQL := buildCreateTableSQL(tableName, sanitizedHeaders, columnTypes)
-	_, err = e.db.Exec(createSQL)
-	if err != nil {
-		return fmt.Errorf("failed to create table: %w", err)
-	}
+// Query executes a SQL query and returns the results.
+// The arguments are bound to the query's placeholders, see BindArgs.
+func (e *Engine) Query(query string, args ...interface{}) ([]string, [][]interface{}, error) {
+	columns, rows, _, err := e.QueryLimit(query, 0, args...)
+	return columns, rows, err
+}
 
-	// 4. Insert Data (Buffered + Remaining)
-	tx, err := e.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback() // Rollback if not committed
+// QueryLimit is Query returning at most maxRows rows, or every row if maxRows is 0. It
+// stops reading at the limit, and reports whether the result had more rows.
+func (e *Engine) QueryLimit(query string, maxRows int, args ...interface{}) ([]string, [][]interface{}, bool, error) {
+	var columns []string
+	var rows [][]interface{}
+	var truncated bool
+	err := e.lazily(func() error {
+		var err error
+		columns, rows, truncated, err = queryRows(context.Background(), e.db, query, maxRows, args...)
+		return err
+	})
+	return columns, rows, truncated, err
+}
 
-	insertSQL := buildInsertSQL(tableName, sanitizedHeaders)
-	stmt, err := tx.Prepare(insertSQL)
+// queryer is implemented by *sql.DB and *sql.Conn
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryRows runs a query and reads its rows, up to maxRows if it isn't 0. It reports
+// whether rows were left unread.
+func queryRows(ctx context.Context, q queryer, query string, maxRows int, args ...interface{}) ([]string, [][]interface{}, bool, error) {
+	rows, err := streamRows(ctx, q, query, args...)
 	if err != nil {
-		return fmt.Errorf("failed to prepare insert statement: %w", err)
+		return nil, nil, false, err
 	}
-	defer stmt.Close()
+	defer rows.Close()
 
-	// Insert buffered rows
-	for _, row := range bufferedRows {
-		if _, err := stmt.Exec(normalizeRow(row, len(headers))...); err != nil {
-			return fmt.Errorf("failed to insert buffered row: %w", err)
+	var results [][]interface{}
+	for rows.Next() {
+		if maxRows > 0 && len(results) == maxRows {
+			return rows.Columns(), results, true, nil
 		}
+		results = append(results, rows.Values())
 	}
-
-	// Insert remaining rows
-	for row := range rowCh {
-		if _, err := stmt.Exec(normalizeRow(row, len(headers))...); err != nil {
-			return fmt.Errorf("failed to insert row: %w", err)
-		}
+	if err := rows.Err(); err != nil {
+		return nil, nil, false, err
 	}
 
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
+	return rows.Columns(), results, false, nil
+}
 
-	return nil
+// Rows streams the result of a query one row at a time, see Engine.Stream
+type Rows struct {
+	rows    *sql.Rows
+	columns []string
+	values  []interface{}
+	err     error
 }
 
-// Query executes a SQL query and returns the results.
-func (e *Engine) Query(query string) ([]string, [][]interface{}, error) {
-	rows, err := e.db.Query(query)
+// Stream executes a SQL query and returns its rows as they are read, instead of all at
+// once like Query. The Rows must be closed.
+func (e *Engine) Stream(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	var rows *Rows
+	err := e.lazily(func() error {
+		var err error
+		rows, err = streamRows(ctx, e.db, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func streamRows(ctx context.Context, q queryer, query string, args ...interface{}) (*Rows, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, nil, fmt.Errorf("query execution failed: %w", err)
+		return nil, fmt.Errorf("query execution failed: %w", err)
 	}
-	defer rows.Close()
 
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get columns: %w", err)
+		rows.Close()
+		return nil, fmt.Errorf("failed to get columns: %w", err)
 	}
+	return &Rows{rows: rows, columns: columns}, nil
+}
 
-	var results [][]interface{}
+// Columns returns the column names of the result
+func (r *Rows) Columns() []string {
+	return r.columns
+}
 
-	for rows.Next() {
-		// Scan needs pointers to interfaces
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
+// Next reads the next row, and reports false at the end of the result or on error
+func (r *Rows) Next() bool {
+	if r.err != nil || !r.rows.Next() {
+		return false
+	}
 
-		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, nil, fmt.Errorf("failed to scan row: %w", err)
-		}
+	// Scan needs pointers to interfaces
+	values := make([]interface{}, len(r.columns))
+	valuePtrs := make([]interface{}, len(r.columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	if err := r.rows.Scan(valuePtrs...); err != nil {
+		r.err = fmt.Errorf("failed to scan row: %w", err)
+		return false
+	}
 
-		// Prepare row for result, converting []byte to string if needed (SQLite often returns text as bytes)
-		finalRow := make([]interface{}, len(columns))
-		for i, v := range values {
-			if b, ok := v.([]byte); ok {
-				finalRow[i] = string(b)
-			} else {
-				finalRow[i] = v
-			}
+	// SQLite often returns text as bytes
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			values[i] = string(b)
 		}
-		results = append(results, finalRow)
 	}
+	r.values = values
+	return true
+}
+
+// Values returns the row read by Next. Each row gets a new slice, which the caller may keep.
+func (r *Rows) Values() []interface{} {
+	return r.values
+}
+
+// Err returns the error that ended the result early, if any
+func (r *Rows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	if err := r.rows.Err(); err != nil {
+		return fmt.Errorf("query execution failed: %w", err)
+	}
+	return nil
+}
 
-	return columns, results, nil
+// Close releases the result; it may be called before every row has been read
+func (r *Rows) Close() error {
+	return r.rows.Close()
+}
+
+// Conn returns a single connection to the database, e.g. for settings that apply to one
+// connection such as PRAGMA query_only. It must be closed to return it to the pool.
+func (e *Engine) Conn(ctx context.Context) (*sql.Conn, error) {
+	return e.db.Conn(ctx)
 }
 
 // Close closes the database connection.
@@ -215,27 +234,42 @@ func sanitizeHeader(h string) string {
 	return h
 }
 
+// quoteIdentifier quotes a table or column name for use in SQL.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
 func buildCreateTableSQL(tableName string, headers []string, types []string) string {
+	return fmt.Sprintf(`CREATE TABLE %s (%s);`, quoteIdentifier(tableName), columnDefinitions(headers, types))
+}
+
+func columnDefinitions(headers []string, types []string) string {
 	var cols []string
 	for i, h := range headers {
-		cols = append(cols, fmt.Sprintf(`"%s" %s`, h, types[i]))
+		cols = append(cols, quoteIdentifier(h)+" "+types[i])
 	}
-	return fmt.Sprintf(`CREATE TABLE "%s" (%s);`, tableName, strings.Join(cols, ", "))
+	return strings.Join(cols, ", ")
 }
 
-func buildInsertSQL(tableName string, headers []string) string {
+// buildInsertSQL returns an INSERT of the given number of rows, each with one
+// placeholder per column
+func buildInsertSQL(tableName string, headers []string, rows int) string {
 	placeholders := make([]string, len(headers))
 	for i := range placeholders {
 		placeholders[i] = "?"
 	}
 	quotedHeaders := make([]string, len(headers))
 	for i, h := range headers {
-		quotedHeaders[i] = fmt.Sprintf(`"%s"`, h)
+		quotedHeaders[i] = quoteIdentifier(h)
+	}
+	values := make([]string, rows)
+	for i := range values {
+		values[i] = "(" + strings.Join(placeholders, ", ") + ")"
 	}
-	return fmt.Sprintf(`INSERT INTO "%s" (%s) VALUES (%s);`,
-		tableName,
+	return fmt.Sprintf(`INSERT INTO %s (%s) VALUES %s;`,
+		quoteIdentifier(tableName),
 		strings.Join(quotedHeaders, ", "),
-		strings.Join(placeholders, ", "))
+		strings.Join(values, ", "))
 }
 
 func normalizeRow(row []interface{}, length int) []interface{} {
@@ -1,7 +1,20 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/zulfikawr/runsql/internal/parsers"
+	"modernc.org/sqlite"
 )
 
 // MockSource for testing
@@ -67,6 +80,448 @@ func TestEngine(t *testing.T) {
 	if rows[0][1].(string) != "A" {
 		t.Errorf("Expected data A, got %v", rows[0][1])
 	}
+
+	// QueryLimit stops at the limit and tells whether rows were left
+	_, limited, truncated, err := engine.QueryLimit("SELECT * FROM test_table", 2)
+	if err != nil || len(limited) != 2 || !truncated {
+		t.Errorf("QueryLimit = %d rows, truncated %v, %v", len(limited), truncated, err)
+	}
+	if _, limited, truncated, _ = engine.QueryLimit("SELECT * FROM test_table", 3); len(limited) != 3 || truncated {
+		t.Errorf("QueryLimit at the row count = %d rows, truncated %v", len(limited), truncated)
+	}
+
+	// Quotes in names are escaped rather than ending the identifier
+	quoted := &MockSource{headers: []string{`"hi"`}, rows: [][]interface{}{{"hello"}}}
+	if err := engine.Load(`a"b`, quoted); err != nil {
+		t.Fatalf("Failed to load a table with quotes in its names: %v", err)
+	}
+	cols, rows, err = engine.Query(`SELECT * FROM "a""b"`)
+	if err != nil || len(rows) != 1 || cols[0] != `"hi"` {
+		t.Errorf("Unexpected result %v %v: %v", cols, rows, err)
+	}
+}
+
+func TestEnginesAreIsolated(t *testing.T) {
+	first, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer first.Close()
+
+	second, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer second.Close()
+
+	// Both engines load a table with the same name
+	for _, engine := range []*Engine{first, second} {
+		source := &MockSource{headers: []string{"id"}, rows: [][]interface{}{{1}}}
+		if err := engine.Load("data", source); err != nil {
+			t.Fatalf("Failed to load data: %v", err)
+		}
+	}
+
+	_, rows, err := first.Query("SELECT * FROM data")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("Expected 1 row, got %d", len(rows))
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	users := &MockSource{
+		headers: []string{"id", "name", "score"},
+		rows: [][]interface{}{
+			{"1", "Alice", "9.5"},
+			{"2", "Bob", ""},
+			{"3", "Alice", "7.25"},
+		},
+	}
+	orders := &MockSource{headers: []string{"user_id"}, rows: [][]interface{}{{"1"}}}
+
+	if err := engine.Load("users", users); err != nil {
+		t.Fatalf("Failed to load users: %v", err)
+	}
+	if err := engine.Load("orders", orders); err != nil {
+		t.Fatalf("Failed to load orders: %v", err)
+	}
+
+	tables, err := engine.Catalog()
+	if err != nil {
+		t.Fatalf("Catalog failed: %v", err)
+	}
+	if len(tables) != 2 || tables[0].Name != "users" || tables[1].Name != "orders" {
+		t.Fatalf("Unexpected tables: %+v", tables)
+	}
+
+	table := tables[0]
+	if table.RowCount != 3 {
+		t.Errorf("Expected 3 rows, got %d", table.RowCount)
+	}
+	expectedTypes := []string{"INTEGER", "TEXT", "REAL"}
+	for i, typ := range expectedTypes {
+		if table.Types[i] != typ {
+			t.Errorf("Column %s: expected type %s, got %s", table.Columns[i], typ, table.Types[i])
+		}
+	}
+
+	id := table.Stats[0]
+	if id.Nullable || id.Distinct != 3 || id.Min != int64(1) || id.Max != int64(3) {
+		t.Errorf("Unexpected id stats: %+v", id)
+	}
+
+	name := table.Stats[1]
+	if name.Distinct != 2 || len(name.Samples) != 2 {
+		t.Errorf("Unexpected name stats: %+v", name)
+	}
+
+	score := table.Stats[2]
+	if !score.Nullable || score.Min != 7.25 || score.Max != 9.5 {
+		t.Errorf("Unexpected score stats: %+v", score)
+	}
+
+	if _, err := engine.DescribeTable("missing"); err == nil {
+		t.Error("Expected error for missing table")
+	}
+	if id.DistinctApprox || name.DistinctApprox {
+		t.Error("Expected exact distinct counts for a small table")
+	}
+
+	// Larger tables get estimates
+	defer func(limit int64) { exactDistinctRows = limit }(exactDistinctRows)
+	exactDistinctRows = 2
+	table, err = engine.DescribeTable("users")
+	if err != nil {
+		t.Fatalf("DescribeTable failed: %v", err)
+	}
+	for i, stats := range table.Stats {
+		if !stats.DistinctApprox || stats.Distinct != tables[0].Stats[i].Distinct {
+			t.Errorf("Column %s: expected an estimate of %d, got %+v", table.Columns[i], tables[0].Stats[i].Distinct, stats)
+		}
+	}
+	if len(table.Stats[1].Samples) != 2 {
+		t.Errorf("Unexpected samples: %v", table.Stats[1].Samples)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	source := &MockSource{
+		headers: []string{"zip", "amount"},
+		rows: [][]interface{}{
+			{"10115", "2"},
+			{"10115", "4"},
+			{"80331", "4"},
+			{"", "6"},
+			{"SW1A", ""},
+		},
+	}
+	if err := engine.Load("addresses", source); err != nil {
+		t.Fatalf("Failed to load data: %v", err)
+	}
+
+	profile, err := engine.Profile("addresses", 2)
+	if err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	if profile.RowCount != 5 || len(profile.Columns) != 2 {
+		t.Fatalf("Unexpected profile: %+v", profile)
+	}
+
+	zip := profile.Columns[0]
+	if zip.Nulls != 1 || zip.NullPercent != 20 {
+		t.Errorf("Expected 1 null (20%%), got %d (%v%%)", zip.Nulls, zip.NullPercent)
+	}
+	if len(zip.TopValues) != 2 || zip.TopValues[0].Value != "10115" || zip.TopValues[0].Count != 2 {
+		t.Errorf("Unexpected top values: %+v", zip.TopValues)
+	}
+	if len(zip.Patterns) == 0 || zip.Patterns[0].Pattern != `\d{5}` || zip.Patterns[0].Percent != 75 {
+		t.Errorf("Unexpected patterns: %+v", zip.Patterns)
+	}
+	if zip.Lengths.Min != 4 || zip.Lengths.Max != 5 || zip.Lengths.P50 != 5 {
+		t.Errorf("Unexpected lengths: %+v", zip.Lengths)
+	}
+	if zip.Mean != nil {
+		t.Errorf("Text column should have no mean, got %v", *zip.Mean)
+	}
+
+	amount := profile.Columns[1]
+	if amount.Type != "INTEGER" || amount.Mean == nil || *amount.Mean != 4 {
+		t.Fatalf("Unexpected amount profile: %+v", amount)
+	}
+	if amount.StdDev == nil || math.Abs(*amount.StdDev-1.63299) > 1e-4 {
+		t.Errorf("Expected stddev 1.63299, got %v", amount.StdDev)
+	}
+
+	// Large integers with a small spread, such as epoch seconds, neither overflow the sum
+	// of squares nor lose the spread to rounding
+	timestamps := &MockSource{headers: []string{"ts", "big"}}
+	for i := range 5 {
+		timestamps.rows = append(timestamps.rows, []interface{}{
+			fmt.Sprint(1700000000 + i), fmt.Sprint(int64(4e18) + int64(i)*int64(1e15)),
+		})
+	}
+	if err := engine.Load("events", timestamps); err != nil {
+		t.Fatalf("Failed to load data: %v", err)
+	}
+	profile, err = engine.Profile("events", 2)
+	if err != nil {
+		t.Fatalf("Profile of large integers failed: %v", err)
+	}
+	for i, want := range []float64{1.58114, 1.58114e15} {
+		col := profile.Columns[i]
+		if col.StdDev == nil || math.Abs(*col.StdDev-want)/want > 1e-4 {
+			t.Errorf("Expected %s stddev %v, got %v", col.Name, want, col.StdDev)
+		}
+	}
+}
+
+// rowRecorder collects the rows written by Convert
+type rowRecorder struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+func (r *rowRecorder) WriteHeader(columns []string) error {
+	r.columns = columns
+	return nil
+}
+
+func (r *rowRecorder) WriteRow(row []interface{}) error {
+	r.rows = append(r.rows, row)
+	return nil
+}
+
+func TestConvert(t *testing.T) {
+	source := &MockSource{
+		headers: []string{"id", "first name", "age"},
+		rows: [][]interface{}{
+			{"1", "Ann", "30"},
+			{"2", "Bob", "17"},
+			{"3", "Cy", nil},
+			{"4", "Di", "45"},
+		},
+	}
+
+	var out rowRecorder
+	n, err := Convert(source, &out, ConvertOptions{
+		Columns: []ColumnSelection{{Name: "First Name", Alias: "name"}, {Name: "id"}},
+		Where:   "age >= 18",
+	})
+	if err != nil {
+		t.Fatalf("Convert failed: %v", err)
+	}
+
+	if n != 2 || len(out.rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d: %v", n, out.rows)
+	}
+	if len(out.columns) != 2 || out.columns[0] != "name" || out.columns[1] != "id" {
+		t.Errorf("Unexpected columns: %v", out.columns)
+	}
+	if out.rows[0][0] != "Ann" || out.rows[0][1] != int64(1) || out.rows[1][0] != "Di" {
+		t.Errorf("Unexpected rows: %v", out.rows)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	newSource := func() *MockSource {
+		return &MockSource{headers: []string{"id"}, rows: [][]interface{}{{"1"}}}
+	}
+
+	if _, err := Convert(newSource(), &rowRecorder{}, ConvertOptions{Columns: []ColumnSelection{{Name: "missing"}}}); err == nil {
+		t.Error("Expected error for unknown column")
+	}
+	if _, err := Convert(newSource(), &rowRecorder{}, ConvertOptions{Where: "missing > 1"}); err == nil {
+		t.Error("Expected error for filter on unknown column")
+	}
+	if _, err := Convert(newSource(), &rowRecorder{}, ConvertOptions{Where: "id >"}); err == nil {
+		t.Error("Expected error for invalid filter")
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- setup
+CREATE TEMP TABLE t (a TEXT);
+INSERT INTO t VALUES ('x;y'), ("z"";"); /* a ; comment */
+;
+CREATE TRIGGER trg AFTER INSERT ON t BEGIN
+  UPDATE t SET a = CASE WHEN a = '' THEN 'empty' ELSE a END;
+END;
+
+SELECT * FROM t`
+
+	statements := SplitStatements(script)
+	if len(statements) != 4 {
+		t.Fatalf("Expected 4 statements, got %d: %+v", len(statements), statements)
+	}
+
+	expectedLines := []int{2, 3, 5, 9}
+	for i, stmt := range statements {
+		if stmt.Index != i+1 || stmt.Line != expectedLines[i] {
+			t.Errorf("Statement %d: expected index %d line %d, got %d line %d", i, i+1, expectedLines[i], stmt.Index, stmt.Line)
+		}
+	}
+	if statements[1].SQL != `INSERT INTO t VALUES ('x;y'), ("z"";")` {
+		t.Errorf("Unexpected second statement: %q", statements[1].SQL)
+	}
+	if !strings.HasSuffix(statements[2].SQL, "ELSE a END;\nEND") {
+		t.Errorf("Trigger body was split: %q", statements[2].SQL)
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	results, err := engine.RunScript(`
+CREATE TEMP TABLE nums (n INTEGER);
+INSERT INTO nums VALUES (1), (2), (3);
+UPDATE nums SET n = n * 10 WHERE n > 1;
+SELECT SUM(n) FROM nums;`)
+	if err != nil {
+		t.Fatalf("RunScript failed: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(results))
+	}
+	if results[1].RowsAffected != 3 || results[2].RowsAffected != 2 {
+		t.Errorf("Unexpected rows affected: %d, %d", results[1].RowsAffected, results[2].RowsAffected)
+	}
+	if len(results[0].Columns) != 0 || len(results[3].Columns) != 1 || results[3].Rows[0][0] != int64(51) {
+		t.Errorf("Unexpected SELECT result: %v %v", results[3].Columns, results[3].Rows)
+	}
+
+	results, err = engine.RunScript("SELECT 1;\n\nSELECT * FROM missing;\nSELECT 2;")
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) {
+		t.Fatalf("Expected ScriptError, got %v", err)
+	}
+	if scriptErr.Index != 2 || scriptErr.Line != 3 || len(results) != 1 {
+		t.Errorf("Expected failure at statement 2 line 3 after 1 result, got %d line %d after %d", scriptErr.Index, scriptErr.Line, len(results))
+	}
+}
+
+func TestParseParam(t *testing.T) {
+	tests := []struct {
+		spec     string
+		name     string
+		expected interface{}
+	}{
+		{"city=Berlin", "city", "Berlin"},
+		{"zip=01234", "zip", "01234"},
+		{"min:int=5", "min", int64(5)},
+		{":ratio:float=0.5", "ratio", 0.5},
+		{"active:bool=true", "active", true},
+		{"missing:null=", "missing", nil},
+		{"1=first", "1", "first"},
+		{"expr=a=b", "expr", "a=b"},
+	}
+	for _, tt := range tests {
+		param, err := ParseParam(tt.spec)
+		if err != nil {
+			t.Errorf("ParseParam(%q) failed: %v", tt.spec, err)
+			continue
+		}
+		if param.Name != tt.name || param.Value != tt.expected {
+			t.Errorf("ParseParam(%q) = %s=%#v, want %s=%#v", tt.spec, param.Name, param.Value, tt.name, tt.expected)
+		}
+	}
+
+	for _, spec := range []string{"novalue", "=5", "n:int=five", "n:date=2024-01-01"} {
+		if _, err := ParseParam(spec); err == nil {
+			t.Errorf("ParseParam(%q) should fail", spec)
+		}
+	}
+}
+
+func TestQueryParams(t *testing.T) {
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	params, err := ParamsFromJSON([]byte(`{"name": "O'Brien; DROP TABLE x", "min": 2}`))
+	if err != nil {
+		t.Fatalf("ParamsFromJSON failed: %v", err)
+	}
+	args, err := BindArgs(params)
+	if err != nil {
+		t.Fatalf("BindArgs failed: %v", err)
+	}
+
+	_, rows, err := engine.Query("SELECT :name, @min + 1", args...)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if rows[0][0] != "O'Brien; DROP TABLE x" || rows[0][1] != int64(3) {
+		t.Errorf("Unexpected named parameter values: %v", rows[0])
+	}
+
+	// Positional parameters are ordered by number, whatever order they are given in
+	second, _ := ParseParam("2:int=7")
+	positional, err := BindArgs([]Param{second, {Name: "1", Value: "first"}})
+	if err != nil {
+		t.Fatalf("BindArgs failed: %v", err)
+	}
+	_, rows, err = engine.Query("SELECT ?, ? * 2", positional...)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if rows[0][0] != "first" || rows[0][1] != int64(14) {
+		t.Errorf("Unexpected positional parameter values: %v", rows[0])
+	}
+
+	if _, _, err := engine.Query("SELECT :unknown", args...); err == nil {
+		t.Error("Expected error for a missing parameter")
+	}
+	if _, err := BindArgs([]Param{{Name: "a", Value: 1}, {Name: "a", Value: 2}}); err == nil {
+		t.Error("Expected error for a duplicate parameter")
+	}
+	if _, err := BindArgs([]Param{{Name: "1000000000", Value: 1}}); err == nil {
+		t.Error("Expected error for a position SQLite doesn't accept")
+	}
+	if args, err := BindArgs([]Param{{Name: "32766", Value: 1}}); err != nil || len(args) != 32766 {
+		t.Errorf("BindArgs of the highest position = %d args, %v", len(args), err)
+	}
+	if _, err := ParamsFromJSON([]byte(`{"a": {"nested": true}}`)); err == nil {
+		t.Error("Expected error for a nested value")
+	}
+}
+
+func TestValuePattern(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"12345", `\d{5}`},
+		{"AB-12", `[A-Z]{2}-\d{2}`},
+		{"john.doe@example.com", `[a-z]{4}\.[a-z]{3}@[a-z]{7}\.[a-z]{3}`},
+		{"New York", `[A-Z][a-z]{2}\s[A-Z][a-z]{3}`},
+	}
+
+	for _, tt := range tests {
+		if got := valuePattern(tt.input); got != tt.expected {
+			t.Errorf("valuePattern(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
 }
 
 func TestTypeInference(t *testing.T) {
@@ -96,3 +551,809 @@ func TestSanitizeHeader(t *testing.T) {
 		t.Errorf("Expected First_Name, got %s", h)
 	}
 }
+
+func TestFunctions(t *testing.T) {
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	tests := []struct {
+		query string
+		want  interface{}
+	}{
+		{"SELECT 'abc123' REGEXP '^[a-z]+[0-9]+$'", int64(1)},
+		{"SELECT regexp('^x', 'abc')", int64(0)},
+		{"SELECT regexp('a', NULL)", nil},
+		{"SELECT regexp_replace('2024-01-31', '(\\d+)-(\\d+)-(\\d+)', '$3/$2/$1')", "31/01/2024"},
+		{"SELECT regexp_extract('order #4521 shipped', '#(\\d+)', 1)", "4521"},
+		{"SELECT regexp_extract('order #4521 shipped', '\\d+')", "4521"},
+		{"SELECT regexp_extract('none', '\\d+')", nil},
+		{"SELECT levenshtein('kitten', 'sitting')", int64(3)},
+		{"SELECT levenshtein('café', 'cafe')", int64(1)},
+		{"SELECT round(jaro_winkler('MARTHA', 'MARHTA'), 4)", 0.9611},
+		{"SELECT jaro_winkler('abc', 'abc')", 1.0},
+		{"SELECT jaro_winkler('abc', 'xyz')", 0.0},
+		{"SELECT split_part('a,b,c', ',', 2)", "b"},
+		{"SELECT split_part('a,b,c', ',', -1)", "c"},
+		{"SELECT split_part('a,b,c', ',', 5)", ""},
+		{"SELECT to_date('31/01/2024', '%d/%m/%Y')", "2024-01-31"},
+		{"SELECT to_date('Jan 5, 2024 14:30', '%b %d, %Y %H:%M')", "2024-01-05 14:30:00"},
+		{"SELECT to_date('05.01.2024', '02.01.2006')", "2024-01-05"},
+		{"SELECT to_date('not a date', '%Y-%m-%d')", nil},
+		{"SELECT date_trunc('month', '2024-05-17')", "2024-05-01"},
+		{"SELECT date_trunc('quarter', '2024-05-17 10:11:12')", "2024-04-01 00:00:00"},
+		{"SELECT date_trunc('week', '2024-05-17')", "2024-05-13"},
+		{"SELECT date_trunc('hour', '2024-05-17T10:11:12')", "2024-05-17 10:00:00"},
+		{"SELECT md5('hello')", "5d41402abc4b2a76b9719d911017c592"},
+		{"SELECT sha256('hello')", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"SELECT length(uuid())", int64(36)},
+		{"SELECT uuid() = uuid()", int64(0)},
+	}
+
+	for _, tt := range tests {
+		_, rows, err := engine.Query(tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got := rows[0][0]; got != tt.want {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", tt.query, tt.want, tt.want, got, got)
+		}
+	}
+
+	for _, query := range []string{
+		"SELECT regexp('(', 'x')",
+		"SELECT regexp_extract('abc', 'b', 2)",
+		"SELECT regexp_extract('abc')",
+		"SELECT split_part('a,b', ',', 0)",
+		"SELECT date_trunc('fortnight', '2024-05-17')",
+		"SELECT to_date('2024', '%Q')",
+	} {
+		if _, _, err := engine.Query(query); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+
+	// A name the driver already has makes registration fail instead of panicking
+	var registered []string
+	err = registerLibrary(func(name string, impl *sqlite.FunctionImpl) error {
+		if name == "md5" {
+			return fmt.Errorf("function already registered")
+		}
+		if (impl.Scalar == nil) == (impl.MakeAggregate == nil) {
+			t.Errorf("%s: expected either a scalar or an aggregate", name)
+		}
+		registered = append(registered, name)
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "md5") {
+		t.Errorf("Expected an error naming md5, got %v", err)
+	}
+	if len(registered) == 0 || registered[len(registered)-1] != "levenshtein" {
+		t.Errorf("Unexpected functions registered before md5: %v", registered)
+	}
+}
+
+func TestAggregateFunctions(t *testing.T) {
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	// Anscombe's first dataset: mean of y 7.50, sample variance of y 4.127, corr 0.816
+	x := []interface{}{10, 8, 13, 9, 11, 14, 6, 4, 12, 7, 5}
+	y := []interface{}{8.04, 6.95, 7.58, 8.81, 8.33, 9.96, 7.24, 4.26, 10.84, 4.82, 5.68}
+	rows := make([][]interface{}, len(x))
+	for i := range x {
+		rows[i] = []interface{}{x[i], y[i], []string{"a", "b", "a", "c", "b", "a", "c", "c", "b", "a", "d"}[i]}
+	}
+	if err := engine.Load("anscombe", &MockSource{headers: []string{"x", "y", "g"}, rows: rows}); err != nil {
+		t.Fatalf("Failed to load data: %v", err)
+	}
+
+	round := func(v interface{}) interface{} {
+		if f, ok := v.(float64); ok {
+			return math.Round(f*1000) / 1000
+		}
+		return v
+	}
+
+	tests := []struct {
+		query string
+		want  interface{}
+	}{
+		{"SELECT median(x) FROM anscombe", 9.0},
+		{"SELECT median(x) FROM anscombe WHERE x <= 11", 7.5},
+		{"SELECT median(x) FROM anscombe WHERE x < 11", 7.0},
+		{"SELECT percentile_cont(x, 0.25) FROM anscombe", 6.5},
+		{"SELECT percentile_cont(x, 1) FROM anscombe", 14.0},
+		{"SELECT percentile_disc(x, 0.25) FROM anscombe", int64(6)},
+		{"SELECT percentile_disc(g, 0.5) FROM anscombe", "b"},
+		{"SELECT mode(g) FROM anscombe", "a"},
+		{"SELECT mode(g) FROM anscombe WHERE g != 'a'", "b"},
+		{"SELECT variance(x) FROM anscombe", 11.0},
+		{"SELECT var_pop(x) FROM anscombe", 10.0},
+		{"SELECT stddev_samp(y) FROM anscombe", 2.032},
+		{"SELECT stddev_pop(y) FROM anscombe", 1.937},
+		{"SELECT corr(y, x) FROM anscombe", 0.816},
+		{"SELECT stddev_samp(x) FROM anscombe WHERE x = 10", nil},
+		{"SELECT median(x) FROM anscombe WHERE x > 100", nil},
+		{"SELECT string_agg(g, '' ORDER BY x) FROM anscombe", "cdcabcabbaa"},
+		{"SELECT approx_count_distinct(g) FROM anscombe", int64(4)},
+		// Window functions over a sliding frame exercise the inverse step
+		{"SELECT group_concat(m, ',' ORDER BY x) FROM (SELECT x, median(x) OVER (ORDER BY x ROWS BETWEEN 1 PRECEDING AND 1 FOLLOWING) AS m FROM anscombe)", "4.5,5.0,6.0,7.0,8.0,9.0,10.0,11.0,12.0,13.0,13.5"},
+		{"SELECT max(s) FROM (SELECT variance(x) OVER (ORDER BY x ROWS BETWEEN 2 PRECEDING AND CURRENT ROW) AS s FROM anscombe)", 1.0},
+		{"SELECT group_concat(m, '' ORDER BY x) FROM (SELECT x, mode(g) OVER (ORDER BY x ROWS 1 PRECEDING) AS m FROM anscombe)", "cccaabaabaa"},
+	}
+
+	for _, tt := range tests {
+		_, rows, err := engine.Query(tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got := round(rows[0][0]); got != tt.want {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", tt.query, tt.want, tt.want, got, got)
+		}
+	}
+
+	for _, query := range []string{
+		"SELECT percentile_cont(x, 1.5) FROM anscombe",
+		"SELECT median(g) FROM anscombe",
+		"SELECT approx_count_distinct(x) OVER (ORDER BY x ROWS 1 PRECEDING) FROM anscombe",
+	} {
+		if _, _, err := engine.Query(query); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
+
+func TestApproxCountDistinct(t *testing.T) {
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_, rows, err := engine.Query(`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 200000)
+		SELECT approx_count_distinct(i % 100000), approx_count_distinct('user-' || (i % 500)) FROM n`)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if got := rows[0][0].(int64); math.Abs(float64(got)-100000)/100000 > 0.03 {
+		t.Errorf("Expected about 100000 distinct values, got %d", got)
+	}
+	if got := rows[0][1].(int64); math.Abs(float64(got)-500) > 5 {
+		t.Errorf("Expected about 500 distinct values, got %d", got)
+	}
+}
+
+// memory returns an in-memory engine closed at the end of the test
+func memory(t *testing.T) *Engine {
+	t.Helper()
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+	return engine
+}
+
+func TestOpenEngine(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "data.sqlite")
+
+	engine, err := OpenEngine(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open engine: %v", err)
+	}
+	source := &MockSource{headers: []string{"id", "name"}, rows: [][]interface{}{{"1", "Ann"}, {"2", "Bob"}}}
+	if err := engine.Load("users", source); err != nil {
+		t.Fatalf("Failed to load data: %v", err)
+	}
+	// Loading a table again replaces it
+	source = &MockSource{headers: []string{"id", "name"}, rows: [][]interface{}{{"1", "Ann"}, {"2", "Bob"}, {"3", "Cy"}}}
+	if err := engine.Load("users", source); err != nil {
+		t.Fatalf("Failed to reload data: %v", err)
+	}
+	if err := engine.SaveQuery("first", "SELECT * FROM users WHERE id <= ?", 2); err != nil {
+		t.Fatalf("SaveQuery failed: %v", err)
+	}
+	engine.Close()
+
+	// The data is still there after reopening the file
+	engine, err = OpenEngine(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+
+	// Batches written to a file keep its rollback journal and syncs, unlike in memory
+	for _, e := range []*Engine{engine, memory(t)} {
+		var mode, sync string
+		err := e.writeBulk(func(tx *sql.Tx) error {
+			if err := tx.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+				return err
+			}
+			return tx.QueryRow("PRAGMA synchronous").Scan(&sync)
+		})
+		want := map[bool]string{true: "delete 2", false: "off 0"}[e.file]
+		if err != nil || mode+" "+sync != want {
+			t.Errorf("Expected journal mode and synchronous %q while loading (file %v), got %q %v", want, e.file, mode+" "+sync, err)
+		}
+	}
+
+	tables, err := engine.Tables()
+	if err != nil || strings.Join(tables, ",") != "users,first" {
+		t.Fatalf("Unexpected tables: %v %v", tables, err)
+	}
+	_, rows, err := engine.Query("SELECT count(*), sum(id) FROM users")
+	if err != nil || rows[0][0] != int64(3) || rows[0][1] != int64(6) {
+		t.Errorf("Unexpected reopened data: %v %v", rows, err)
+	}
+
+	// Export writes a standalone copy, overwriting an existing file
+	exportPath := filepath.Join(dir, "export.sqlite")
+	if err := os.WriteFile(exportPath, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Export(exportPath); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	exported, err := OpenEngine(exportPath)
+	if err != nil {
+		t.Fatalf("Failed to open export: %v", err)
+	}
+	defer exported.Close()
+	_, rows, err = exported.Query("SELECT group_concat(name, ',') FROM first")
+	if err != nil || rows[0][0] != "Ann,Bob" {
+		t.Errorf("Unexpected exported data: %v %v", rows, err)
+	}
+
+	notDB := filepath.Join(dir, "notes.txt")
+	os.WriteFile(notDB, []byte("this is not a database, just some text that is long enough"), 0o644)
+	if _, err := OpenEngine(notDB); err == nil {
+		t.Error("Expected an error opening a file that isn't a database")
+	}
+
+	// Characters with a meaning in a URI are part of the file name
+	t.Chdir(dir)
+	for _, name := range []string{filepath.Join(dir, "a?mode=ro.sqlite"), filepath.Join(dir, "b#c.sqlite"), filepath.Join(dir, "50% off.sqlite"), "rel?x.sqlite"} {
+		e, err := OpenEngine(name)
+		if err != nil {
+			t.Errorf("Failed to open %s: %v", name, err)
+			continue
+		}
+		err = e.Load("t", &MockSource{headers: []string{"id"}, rows: [][]interface{}{{"1"}}})
+		e.Close()
+		if err != nil {
+			t.Errorf("Failed to load into %s: %v", name, err)
+		}
+		if info, err := os.Stat(name); err != nil || info.Size() == 0 {
+			t.Errorf("Expected the database in %s: %v", name, err)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if name := entry.Name(); name == "a" || name == "b" || name == "50" || name == "rel" {
+			t.Errorf("Unexpected file %s", name)
+		}
+	}
+}
+
+// cachedFileSource is a CSV-like source keyed by a real file, counting how often it is read
+type cachedFileSource struct {
+	MockSource
+	path  string
+	reads *int
+}
+
+func (s *cachedFileSource) Read() (chan []interface{}, error) {
+	*s.reads++
+	return s.MockSource.Read()
+}
+
+func (s *cachedFileSource) CacheKey() (CacheKey, error) {
+	return FileCacheKey(s.path, "mock")
+}
+
+func TestLoadCache(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.csv")
+	os.WriteFile(input, []byte("v1"), 0o644)
+	cache := NewLoadCache(filepath.Join(dir, "cache?#1"), 0) // Entries are opened by URI, in which ? and # must be escaped
+
+	reads := 0
+	load := func(rows ...[]interface{}) *Engine {
+		t.Helper()
+		engine, err := NewEngine()
+		if err != nil {
+			t.Fatalf("Failed to create engine: %v", err)
+		}
+		engine.UseCache(cache)
+		source := &cachedFileSource{MockSource: MockSource{headers: []string{"id", "name"}, rows: rows}, path: input, reads: &reads}
+		if err := engine.Load("people", source); err != nil {
+			t.Fatalf("Failed to load data: %v", err)
+		}
+		return engine
+	}
+
+	engine := load([]interface{}{"1", "Ann"}, []interface{}{"2", "Bob"})
+	engine.Close()
+
+	// The second load is served from the cache, with the same column types
+	engine = load([]interface{}{"9", "Not read"})
+	_, rows, err := engine.Query("SELECT sum(id), typeof(id) FROM people")
+	engine.Close()
+	if err != nil || reads != 1 || rows[0][0] != int64(3) || rows[0][1] != "integer" {
+		t.Fatalf("Expected a cache hit (reads %d): %v %v", reads, rows, err)
+	}
+
+	entries, err := cache.Entries()
+	if err != nil || len(entries) != 1 || entries[0].Rows != 2 || entries[0].Source != input {
+		t.Fatalf("Unexpected entries: %+v %v", entries, err)
+	}
+
+	// A changed file is read again and replaces the old entry
+	os.WriteFile(input, []byte("v2 is longer"), 0o644)
+	engine = load([]interface{}{"5", "Cy"})
+	_, rows, _ = engine.Query("SELECT sum(id) FROM people")
+	engine.Close()
+	if reads != 2 || rows[0][0] != int64(5) {
+		t.Errorf("Expected the changed file to be read again (reads %d): %v", reads, rows)
+	}
+	if entries, _ := cache.Entries(); len(entries) != 1 || entries[0].SourceSize != 12 {
+		t.Errorf("Expected the stale entry to be replaced: %+v", entries)
+	}
+
+	if n, err := cache.Clear(); err != nil || n != 1 {
+		t.Errorf("Clear removed %d entries: %v", n, err)
+	}
+	if entries, _ := cache.Entries(); len(entries) != 0 {
+		t.Errorf("Expected an empty cache, got %+v", entries)
+	}
+}
+
+func TestDamagedCacheEntry(t *testing.T) {
+	dir := t.TempDir()
+	engine := memory(t)
+
+	attach := func(path string, fn func(conn *sql.Conn) error) error {
+		return engine.withAttached(path, "cache", fn)
+	}
+	readData := func(conn *sql.Conn) error {
+		_, _, err := tableColumns(context.Background(), conn, "cache", "data")
+		return err
+	}
+
+	notDB := filepath.Join(dir, "text.sqlite")
+	os.WriteFile(notDB, bytes.Repeat([]byte("not a database "), 100), 0o644)
+	if err := attach(notDB, readData); !damagedCacheEntry(err) {
+		t.Errorf("Expected a file that isn't a database to be damaged, got %v", err)
+	}
+
+	noData := filepath.Join(dir, "empty.sqlite")
+	if err := attach(noData, readData); !damagedCacheEntry(err) {
+		t.Errorf("Expected an entry without a data table to be damaged, got %v", err)
+	}
+
+	// Errors that may not happen next time keep the entry
+	busy := filepath.Join(dir, "busy.sqlite")
+	other, err := sql.Open("sqlite", busy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	other.SetMaxOpenConns(1)
+	if _, err := other.Exec(`CREATE TABLE "data" (x); BEGIN EXCLUSIVE`); err != nil {
+		t.Fatal(err)
+	}
+	if err := attach(busy, readData); err == nil || damagedCacheEntry(err) {
+		t.Errorf("Expected a locked entry to fail without being damaged, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = attach(noData, func(conn *sql.Conn) error {
+		_, _, err := tableColumns(ctx, conn, "cache", "data")
+		return err
+	})
+	if err == nil || damagedCacheEntry(err) {
+		t.Errorf("Expected a cancelled read not to be damaged, got %v", err)
+	}
+	if err := attach(dir, readData); err == nil || damagedCacheEntry(err) {
+		t.Errorf("Expected an entry that can't be attached not to be damaged, got %v", err)
+	}
+}
+
+func TestLoadCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewLoadCache(filepath.Join(dir, "cache"), 0)
+
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	engine.UseCache(cache)
+
+	reads := 0
+	load := func(name string) {
+		t.Helper()
+		path := filepath.Join(dir, name+".csv")
+		if _, err := os.Stat(path); err != nil {
+			os.WriteFile(path, []byte(name), 0o644)
+		}
+		source := &cachedFileSource{MockSource: MockSource{headers: []string{"x"}, rows: [][]interface{}{{"1"}}}, path: path, reads: &reads}
+		if err := engine.Load(name, source); err != nil {
+			t.Fatalf("Failed to load %s: %v", name, err)
+		}
+	}
+
+	load("a")
+	load("b")
+	entries, _ := cache.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+
+	// Make room for only two entries, then use a again so that b is the least recently used
+	cache.maxSize = entries[0].Size + entries[1].Size
+	load("a")
+	load("c")
+	if reads != 3 {
+		t.Errorf("Expected a to be loaded from the cache, got %d reads", reads)
+	}
+
+	entries, _ = cache.Entries()
+	var sources []string
+	for _, e := range entries {
+		sources = append(sources, filepath.Base(e.Source))
+	}
+	if strings.Join(sources, ",") != "c.csv,a.csv" {
+		t.Errorf("Expected b to be evicted, got %v", sources)
+	}
+}
+
+// failingSource is a source whose file can't be read
+type failingSource struct{}
+
+func (failingSource) GetHeaders() ([]string, error) {
+	return nil, errors.New("broken file")
+}
+
+func (failingSource) Read() (chan []interface{}, error) {
+	return nil, errors.New("broken file")
+}
+
+func TestLoadAll(t *testing.T) {
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	// A failed load must leave the previous table in place
+	if err := engine.Load("broken", &MockSource{headers: []string{"id"}, rows: [][]interface{}{{"1"}}}); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var big [][]interface{}
+	for i := range 2*loadBatchSize + 10 {
+		big = append(big, []interface{}{i, "x"})
+	}
+	jobs := []LoadJob{
+		{Table: "big", Source: &MockSource{headers: []string{"n", "s"}, rows: big}},
+		{Table: "broken", Source: failingSource{}},
+		{Table: "small", Source: &MockSource{headers: []string{"id"}, rows: [][]interface{}{{"1"}, {"2"}}}},
+		{Table: "small", Source: &MockSource{headers: []string{"id"}, rows: [][]interface{}{{"3"}}}},
+	}
+
+	done := make(map[int]LoadProgress)
+	batches := 0
+	err = engine.LoadAll(jobs, LoadOptions{Workers: 2, Progress: func(p LoadProgress) {
+		if p.Done {
+			if _, ok := done[p.Index]; ok {
+				t.Errorf("Job %d reported done twice", p.Index)
+			}
+			done[p.Index] = p
+		} else if p.Index == 0 {
+			batches++
+		}
+	}})
+
+	var loadErrs []*LoadError
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var loadErr *LoadError
+		if !errors.As(e, &loadErr) {
+			t.Fatalf("Expected a *LoadError, got %T", e)
+		}
+		loadErrs = append(loadErrs, loadErr)
+	}
+	if len(loadErrs) != 2 || loadErrs[0].Index != 1 || loadErrs[1].Index != 3 {
+		t.Fatalf("Expected errors for jobs 1 and 3 in order, got %v", err)
+	}
+	if !strings.Contains(loadErrs[0].Error(), "broken file") || !strings.Contains(loadErrs[1].Error(), "more than once") {
+		t.Errorf("Unexpected errors: %v", err)
+	}
+
+	if len(done) != len(jobs) {
+		t.Errorf("Expected every job to report done, got %d", len(done))
+	}
+	if p := done[0]; p.Err != nil || p.Rows != int64(len(big)) {
+		t.Errorf("Unexpected progress of big: %+v", p)
+	}
+	if batches < 2 {
+		t.Errorf("Expected progress after each batch of big, got %d", batches)
+	}
+
+	for table, want := range map[string]int64{"big": int64(len(big)), "broken": 1, "small": 2} {
+		_, rows, err := engine.Query("SELECT count(*) FROM " + table)
+		if err != nil || rows[0][0] != want {
+			t.Errorf("Expected %d rows in %s, got %v %v", want, table, rows, err)
+		}
+	}
+
+	// No staging table is left behind
+	tables, _ := engine.Tables()
+	if len(tables) != 3 {
+		t.Errorf("Expected 3 tables, got %v", tables)
+	}
+}
+
+func TestPartitionFilter(t *testing.T) {
+	keys := []string{"year", "month", "region"}
+	partitions := PartitionColumns([][]string{
+		{"2024", "01", "eu"},
+		{"2024", "11", "us"},
+		{"2025", "03", "eu"},
+		{"2025", "11", ""},
+		{HiveDefaultPartition, "01", "us"},
+	})
+	if partitions[0][0] != int64(2024) || partitions[0][1] != int64(1) || partitions[3][2] != nil || partitions[4][0] != nil {
+		t.Fatalf("Unexpected partition columns: %v", partitions)
+	}
+
+	// Partitions as a table, to check the filter against SQLite itself
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	if err := engine.Load("parts", &MockSource{headers: keys, rows: partitions}); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  string // Partitions kept, or "all" if the query can't skip any
+	}{
+		{"SELECT * FROM parts WHERE year = 2025", "2,3"},
+		{"SELECT * FROM parts p WHERE p.year = 2025 AND month >= 3 ORDER BY 1", "2,3"},
+		{"select * from parts where 2024 = year and region = 'eu'", "0"},
+		{"SELECT * FROM parts WHERE month IN (1, '11') AND year BETWEEN 2024 AND 2024", "0,1"},
+		{"SELECT * FROM parts WHERE region != 'eu' AND year < '2025'", "1"},
+		{"SELECT * FROM parts WHERE year > -1 AND amount > 5", "0,1,2,3"},
+		{"SELECT * FROM parts WHERE year = 2025 OR month = 1", "all"},
+		{"SELECT * FROM parts WHERE (year = 2025)", "all"},
+		{"SELECT * FROM parts JOIN other ON 1 WHERE year = 2025", "all"},
+		{"SELECT * FROM parts WHERE year = 2025 UNION SELECT * FROM parts", "all"},
+		{"SELECT * FROM parts WHERE year = :year", "all"},
+		{"SELECT year, (SELECT count(*) FROM parts) AS total FROM parts WHERE year = 2025", "all"},
+		{"SELECT * FROM parts WHERE year = 2025 AND month NOT IN (SELECT month FROM parts WHERE year = 2024)", "all"},
+		{"SELECT * FROM parts WHERE year = 2025 AND EXISTS (SELECT 1 FROM \"PARTS\" x WHERE x.month = 1)", "all"},
+		{"SELECT * FROM parts WHERE year = 2025 AND month IN (SELECT 3)", "2,3"},
+	}
+	for _, tt := range tests {
+		filter := NewPartitionFilter(tt.query, "parts", keys)
+		var kept []string
+		for i, values := range partitions {
+			if filter == nil || filter.Match(values) {
+				kept = append(kept, fmt.Sprint(i))
+			}
+		}
+		got := strings.Join(kept, ",")
+		if filter == nil {
+			got = "all"
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected partitions %s, got %s", tt.query, tt.want, got)
+		}
+
+		// Every partition with a matching row must be kept
+		where := tt.query[strings.Index(strings.ToUpper(tt.query), "WHERE"):]
+		if filter == nil || strings.Contains(where, "amount") {
+			continue
+		}
+		_, rows, err := engine.Query("SELECT rowid - 1 FROM parts " + strings.Replace(where, "p.", "", 1))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		for _, row := range rows {
+			if i := row[0].(int64); !filter.Match(partitions[i]) {
+				t.Errorf("%s: partition %d matches but was skipped", tt.query, i)
+			}
+		}
+	}
+}
+
+// typedSource is a MockSource that gives the types of its columns
+type typedSource struct {
+	MockSource
+	types []string
+}
+
+func (s *typedSource) ColumnTypes() []string {
+	return s.types
+}
+
+func TestTypedSource(t *testing.T) {
+	// The partition code=007 has more rows than the type is inferred from, so only the
+	// type given by the source keeps its values as text
+	source := &typedSource{MockSource: MockSource{headers: []string{"code", "v"}}, types: []string{"TEXT", ""}}
+	for i := 0; i < 150; i++ {
+		source.rows = append(source.rows, []interface{}{"007", fmt.Sprint(i)})
+	}
+	source.rows = append(source.rows, []interface{}{"abc", "1"})
+
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	if err := engine.Load("parts", source); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	_, rows, err := engine.Query("SELECT typeof(code), typeof(v), count(*) FROM parts WHERE code IN (7, 'abc') GROUP BY 1, 2")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if got := fmt.Sprint(rows); got != "[[text integer 1]]" {
+		t.Errorf("Unexpected rows: %s", got)
+	}
+
+	// The partition filter agrees with SQLite
+	filter := NewPartitionFilter("SELECT * FROM parts WHERE code IN (7, 'abc')", "parts", []string{"code"})
+	if filter == nil || filter.Match([]interface{}{"007"}) || !filter.Match([]interface{}{"abc"}) {
+		t.Error("Expected the filter to keep only code=abc")
+	}
+}
+
+func TestTableName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"sales", "sales"},
+		{"2025 Q1 sales (final)", "t_2025_Q1_sales_final"},
+		{"sales--final__v2", "sales_final__v2"},
+		{"__data__", "data"},
+		{"données", "donn_es"},
+		{"???", "t"},
+		{"order", "order_t"},
+		{"first", "first"},
+	}
+	for _, tt := range tests {
+		got := TableName(tt.name)
+		if got != tt.want {
+			t.Errorf("TableName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if err := ValidTableName(got); err != nil {
+			t.Errorf("TableName(%q) = %q is not valid: %v", tt.name, got, err)
+		}
+	}
+
+	for _, name := range []string{"", "2025", "my-table", "Select"} {
+		if ValidTableName(name) == nil {
+			t.Errorf("Expected %q to be an invalid table name", name)
+		}
+	}
+
+	namer := NewTableNamer()
+	if !namer.Claim("Orders") || namer.Claim("orders") {
+		t.Error("Expected a name to be claimed once, whatever its case")
+	}
+	got := []string{namer.Unique("data"), namer.Unique("data"), namer.Unique("orders"), namer.Unique("DATA")}
+	if want := "data,data_2,orders_2,DATA_3"; strings.Join(got, ",") != want {
+		t.Errorf("Expected unique names %s, got %s", want, strings.Join(got, ","))
+	}
+}
+
+func TestFindTableRefs(t *testing.T) {
+	refs := FindTableRefs(`SELECT u.name FROM Users u JOIN "order items" ON 1 -- events
+		WHERE u.id IN (SELECT id FROM [Archive]) AND x IN pragma_table_info('logs') /* sales */`)
+	for _, table := range []string{"users", "USERS", "order items", "archive", "logs"} {
+		if !refs.Has(table) {
+			t.Errorf("Expected %s to be referenced", table)
+		}
+	}
+	for _, table := range []string{"events", "sales", "order"} {
+		if refs.Has(table) {
+			t.Errorf("Expected %s not to be referenced", table)
+		}
+	}
+
+	// Listing the tables references every one of them
+	for _, sql := range []string{
+		"SELECT name FROM sqlite_master WHERE type = 'table'",
+		"SELECT name FROM SQLITE_SCHEMA",
+		"SELECT * FROM pragma_table_list",
+		"PRAGMA table_list",
+	} {
+		if !FindTableRefs(sql).Has("events") {
+			t.Errorf("%s: expected every table to be referenced", sql)
+		}
+	}
+}
+
+func TestLazyLoader(t *testing.T) {
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	opened := make(map[string]int)
+	loader := NewLazyLoader(engine)
+	for _, name := range []string{"a", "b"} {
+		loader.Add(name, func() (parsers.Source, io.Closer, error) {
+			opened[name]++
+			return &MockSource{headers: []string{"id"}, rows: [][]interface{}{{name}}}, nil, nil
+		})
+	}
+
+	var rows [][]interface{}
+	query := func() (err error) {
+		_, rows, err = engine.Query("SELECT * FROM A UNION ALL SELECT * FROM main.b ORDER BY 1")
+		return err
+	}
+	if err := loader.Do(query); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(rows) != 2 || opened["a"] != 1 || opened["b"] != 1 {
+		t.Errorf("Expected both tables to be loaded once, got rows %v and opens %v", rows, opened)
+	}
+	if err := loader.Do(query); err != nil || opened["a"] != 1 {
+		t.Errorf("Expected loaded tables to be reused, got %v and opens %v", err, opened)
+	}
+
+	err = loader.Do(func() error {
+		_, _, err := engine.Query("SELECT * FROM c")
+		return err
+	})
+	if name, ok := MissingTable(err); !ok || name != "c" {
+		t.Errorf("Expected a missing table c, got %v", err)
+	}
+
+	// With UseLoader, queries and scripts load tables themselves, even ones they only
+	// reference through a view
+	loader.Add("c", func() (parsers.Source, io.Closer, error) {
+		opened["c"]++
+		return &MockSource{headers: []string{"id"}, rows: [][]interface{}{{"c"}}}, nil, nil
+	})
+	engine.UseLoader(loader)
+	results, err := engine.RunScript("CREATE TEMP VIEW v AS SELECT * FROM c; SELECT * FROM v")
+	if err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+	if len(results) != 2 || len(results[1].Rows) != 1 || opened["c"] != 1 {
+		t.Errorf("Expected the view to load c once, got %v and opens %v", results, opened)
+	}
+	if _, _, err := engine.Query("SELECT * FROM d"); err == nil {
+		t.Error("Expected a table that was never added to stay missing")
+	}
+	// Tables aren't loaded while a reader is open
+	loader.Add("e", func() (parsers.Source, io.Closer, error) {
+		return &MockSource{headers: []string{"id"}, rows: [][]interface{}{{"e"}}}, nil, nil
+	})
+	loader.Acquire()
+	if _, err := loader.Load("e"); !errors.Is(err, ErrTablesInUse) {
+		t.Errorf("Expected ErrTablesInUse, got %v", err)
+	}
+	loader.Release()
+	if loaded, err := loader.Load("e"); !loaded || err != nil {
+		t.Errorf("Expected e to load once the reader is released, got %v, %v", loaded, err)
+	}
+}
@@ -0,0 +1,528 @@
+package core
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// Function describes a SQL function that runsql adds to SQLite.
+type Function struct {
+	Name        string `json:"name"`
+	Signature   string `json:"signature"` // e.g. "split_part(text, delimiter, n)"
+	Description string `json:"description"`
+	Aggregate   bool   `json:"aggregate"` // Whether it aggregates rows (and can be used as a window function)
+
+	minArgs, maxArgs int // maxArgs < 0 means any number
+	deterministic    bool
+	scalar           func(args []driver.Value) (driver.Value, error)
+	newAggregate     func() aggregator // Set instead of scalar for aggregate functions
+}
+
+// scalarFunctions is the library of scalar functions registered on every engine
+var scalarFunctions = []Function{
+	{
+		Name:        "regexp",
+		Signature:   "regexp(pattern, text)",
+		Description: "1 if text matches the regular expression, else 0; also used by the REGEXP operator (text REGEXP pattern)",
+		minArgs:     2, maxArgs: 2, deterministic: true,
+		scalar: func(args []driver.Value) (driver.Value, error) {
+			if args[0] == nil || args[1] == nil {
+				return nil, nil
+			}
+			re, err := compileRegexp(textArg(args[0]))
+			if err != nil {
+				return nil, err
+			}
+			if re.MatchString(textArg(args[1])) {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		},
+	},
+	{
+		Name:        "regexp_replace",
+		Signature:   "regexp_replace(text, pattern, replacement)",
+		Description: "Replaces every match of the regular expression; $1, $2... in the replacement refer to capture groups",
+		minArgs:     3, maxArgs: 3, deterministic: true,
+		scalar: func(args []driver.Value) (driver.Value, error) {
+			if args[0] == nil || args[1] == nil {
+				return nil, nil
+			}
+			re, err := compileRegexp(textArg(args[1]))
+			if err != nil {
+				return nil, err
+			}
+			return re.ReplaceAllString(textArg(args[0]), textArg(args[2])), nil
+		},
+	},
+	{
+		Name:        "regexp_extract",
+		Signature:   "regexp_extract(text, pattern[, group])",
+		Description: "The first match of the regular expression, or of the given capture group; NULL if there is no match",
+		minArgs:     2, maxArgs: 3, deterministic: true,
+		scalar: func(args []driver.Value) (driver.Value, error) {
+			if args[0] == nil || args[1] == nil {
+				return nil, nil
+			}
+			re, err := compileRegexp(textArg(args[1]))
+			if err != nil {
+				return nil, err
+			}
+			group := int64(0)
+			if len(args) == 3 {
+				var ok bool
+				if group, ok = args[2].(int64); !ok || group < 0 || int(group) > re.NumSubexp() {
+					return nil, fmt.Errorf("regexp_extract: group must be between 0 and %d", re.NumSubexp())
+				}
+			}
+			match := re.FindStringSubmatch(textArg(args[0]))
+			if match == nil {
+				return nil, nil
+			}
+			return match[group], nil
+		},
+	},
+	{
+		Name:        "levenshtein",
+		Signature:   "levenshtein(a, b)",
+		Description: "Edit distance: the number of single-character insertions, deletions and substitutions turning a into b",
+		minArgs:     2, maxArgs: 2, deterministic: true,
+		scalar: func(args []driver.Value) (driver.Value, error) {
+			if args[0] == nil || args[1] == nil {
+				return nil, nil
+			}
+			return int64(levenshtein(textArg(args[0]), textArg(args[1]))), nil
+		},
+	},
+	{
+		Name:        "jaro_winkler",
+		Signature:   "jaro_winkler(a, b)",
+		Description: "Jaro-Winkler similarity between 0 (nothing in common) and 1 (identical), favoring a common prefix",
+		minArgs:     2, maxArgs: 2, deterministic: true,
+		scalar: func(args []driver.Value) (driver.Value, error) {
+			if args[0] == nil || args[1] == nil {
+				return nil, nil
+			}
+			return jaroWinkler(textArg(args[0]), textArg(args[1])), nil
+		},
+	},
+	{
+		Name:        "split_part",
+		Signature:   "split_part(text, delimiter, n)",
+		Description: "The n-th field of text split on delimiter, counting from 1, or from the end if n is negative; '' if out of range",
+		minArgs:     3, maxArgs: 3, deterministic: true,
+		scalar: func(args []driver.Value) (driver.Value, error) {
+			if args[0] == nil || args[1] == nil || args[2] == nil {
+				return nil, nil
+			}
+			n, ok := args[2].(int64)
+			if !ok || n == 0 {
+				return nil, fmt.Errorf("split_part: n must be a non-zero integer")
+			}
+			parts := strings.Split(textArg(args[0]), textArg(args[1]))
+			if n < 0 {
+				n += int64(len(parts)) + 1
+			}
+			if n < 1 || n > int64(len(parts)) {
+				return "", nil
+			}
+			return parts[n-1], nil
+		},
+	},
+	{
+		Name:        "to_date",
+		Signature:   "to_date(text, format)",
+		Description: "Parses text with a strftime-style format such as '%d/%m/%Y' (or a Go layout such as '02/01/2006') into 'YYYY-MM-DD', or 'YYYY-MM-DD HH:MM:SS' if the format has a time; NULL if it doesn't match",
+		minArgs:     2, maxArgs: 2, deterministic: true,
+		scalar: func(args []driver.Value) (driver.Value, error) {
+			if args[0] == nil || args[1] == nil {
+				return nil, nil
+			}
+			layout, hasTime, err := goLayout(textArg(args[1]))
+			if err != nil {
+				return nil, err
+			}
+			t, err := time.Parse(layout, strings.TrimSpace(textArg(args[0])))
+			if err != nil {
+				return nil, nil
+			}
+			if hasTime {
+				return t.Format(time.DateTime), nil
+			}
+			return t.Format(time.DateOnly), nil
+		},
+	},
+	{
+		Name:        "date_trunc",
+		Signature:   "date_trunc(unit, value)",
+		Description: "Truncates a date or datetime to the start of its year, quarter, month, week (Monday), day, hour, minute or second",
+		minArgs:     2, maxArgs: 2, deterministic: true,
+		scalar: func(args []driver.Value) (driver.Value, error) {
+			if args[0] == nil || args[1] == nil {
+				return nil, nil
+			}
+			t, hasTime, ok := parseDateTime(textArg(args[1]))
+			if !ok {
+				return nil, nil
+			}
+			t, err := truncateTime(t, strings.ToLower(textArg(args[0])))
+			if err != nil {
+				return nil, err
+			}
+			if hasTime {
+				return t.Format(time.DateTime), nil
+			}
+			return t.Format(time.DateOnly), nil
+		},
+	},
+	{
+		Name:        "md5",
+		Signature:   "md5(value)",
+		Description: "MD5 hash of the value, as lower-case hex",
+		minArgs:     1, maxArgs: 1, deterministic: true,
+		scalar: func(args []driver.Value) (driver.Value, error) {
+			if args[0] == nil {
+				return nil, nil
+			}
+			sum := md5.Sum(bytesArg(args[0]))
+			return hex.EncodeToString(sum[:]), nil
+		},
+	},
+	{
+		Name:        "sha256",
+		Signature:   "sha256(value)",
+		Description: "SHA-256 hash of the value, as lower-case hex",
+		minArgs:     1, maxArgs: 1, deterministic: true,
+		scalar: func(args []driver.Value) (driver.Value, error) {
+			if args[0] == nil {
+				return nil, nil
+			}
+			sum := sha256.Sum256(bytesArg(args[0]))
+			return hex.EncodeToString(sum[:]), nil
+		},
+	},
+	{
+		Name:        "uuid",
+		Signature:   "uuid()",
+		Description: "A random (version 4) UUID",
+		minArgs:     0, maxArgs: 0,
+		scalar: func(args []driver.Value) (driver.Value, error) {
+			return newUUID(), nil
+		},
+	},
+}
+
+var (
+	registerOnce sync.Once
+	registerErr  error
+)
+
+// registerFunctions adds the function library to the SQLite driver. The driver applies
+// it to every connection opened afterwards, so it must run before the first engine opens.
+func registerFunctions() error {
+	registerOnce.Do(func() {
+		registerErr = registerLibrary(sqlite.RegisterFunction)
+	})
+	return registerErr
+}
+
+// registerLibrary registers every function of the library. Functions are registered
+// with the driver rather than a connection, so a function of the same name registered
+// by the program embedding runsql makes it fail.
+func registerLibrary(register func(name string, impl *sqlite.FunctionImpl) error) error {
+	for _, f := range Functions() {
+		impl := &sqlite.FunctionImpl{NArgs: f.nArgs(), Deterministic: f.deterministic}
+		if f.newAggregate != nil {
+			impl.MakeAggregate = f.makeAggregate
+		} else {
+			impl.Scalar = f.call
+		}
+		if err := register(f.Name, impl); err != nil {
+			return fmt.Errorf("failed to register SQL function %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// Functions returns the SQL functions that runsql adds to SQLite, sorted by name.
+func Functions() []Function {
+	list := make([]Function, 0, len(scalarFunctions)+len(aggregateFunctions))
+	list = append(list, scalarFunctions...)
+	list = append(list, aggregateFunctions...)
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// nArgs is the argument count given to SQLite. A function name can only be
+// registered once, so functions with optional arguments are registered as variadic.
+func (f Function) nArgs() int32 {
+	if f.minArgs == f.maxArgs {
+		return int32(f.minArgs)
+	}
+	return -1
+}
+
+// checkArgs reports a call with the wrong number of arguments
+func (f Function) checkArgs(args []driver.Value) error {
+	if len(args) < f.minArgs || (f.maxArgs >= 0 && len(args) > f.maxArgs) {
+		return fmt.Errorf("wrong number of arguments to function %s", f.Signature)
+	}
+	return nil
+}
+
+func (f Function) call(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	if err := f.checkArgs(args); err != nil {
+		return nil, err
+	}
+	return f.scalar(args)
+}
+
+// textArg returns the text form of a SQL value
+func textArg(v driver.Value) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// bytesArg returns the bytes of a SQL value: blobs as they are, anything else as text
+func bytesArg(v driver.Value) []byte {
+	if b, ok := v.([]byte); ok {
+		return b
+	}
+	return []byte(textArg(v))
+}
+
+const regexpCacheSize = 256
+
+var regexpCache = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: make(map[string]*regexp.Regexp)}
+
+// compileRegexp compiles a pattern once, since functions are called once per row
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	regexpCache.Lock()
+	defer regexpCache.Unlock()
+
+	if re, ok := regexpCache.m[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+	if len(regexpCache.m) >= regexpCacheSize {
+		clear(regexpCache.m)
+	}
+	regexpCache.m[pattern] = re
+	return re, nil
+}
+
+// levenshtein computes the edit distance between two strings, by rune
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// jaroWinkler computes the Jaro-Winkler similarity of two strings, by rune
+func jaroWinkler(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	window := max(len(ra), len(rb))/2 - 1
+	window = max(window, 0)
+
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		lo, hi := max(0, i-window), min(len(rb), i+window+1)
+		for j := lo; j < hi; j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	// Count matched characters that are out of order
+	transpositions := 0
+	j := 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	// Boost for a common prefix of up to 4 characters
+	prefix := 0
+	for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// strftimeLayouts maps strftime directives to Go layout elements. Like strptime, days,
+// months and hours accept values with or without a leading zero.
+var strftimeLayouts = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "1", 'd': "2", 'e': "_2",
+	'b': "Jan", 'B': "January", 'a': "Mon", 'A': "Monday",
+	'H': "15", 'I': "3", 'M': "04", 'S': "05", 'p': "PM",
+	'f': "999999999", 'z': "-0700", 'Z': "MST", 'j': "002",
+}
+
+// goLayout converts a strftime-style format to a Go time layout, reporting whether it has a
+// time of day. A format without any % directive is taken to be a Go layout already.
+func goLayout(format string) (string, bool, error) {
+	if !strings.Contains(format, "%") {
+		hasTime := strings.Contains(format, "15") || strings.Contains(format, "04") || strings.Contains(format, "05")
+		return format, hasTime, nil
+	}
+
+	var sb strings.Builder
+	hasTime := false
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			sb.WriteByte(format[i])
+			continue
+		}
+		if i+1 >= len(format) {
+			return "", false, fmt.Errorf("to_date: format ends with %%")
+		}
+		i++
+		if format[i] == '%' {
+			sb.WriteByte('%')
+			continue
+		}
+		elem, ok := strftimeLayouts[format[i]]
+		if !ok {
+			return "", false, fmt.Errorf("to_date: unsupported directive %%%c", format[i])
+		}
+		if strings.ContainsRune("HIMSpf", rune(format[i])) {
+			hasTime = true
+		}
+		if format[i] == 'f' {
+			// Go needs the decimal point as part of the fractional seconds element
+			s := sb.String()
+			if strings.HasSuffix(s, ".") {
+				sb.Reset()
+				sb.WriteString(strings.TrimSuffix(s, "."))
+				elem = "." + elem
+			}
+		}
+		sb.WriteString(elem)
+	}
+	return sb.String(), hasTime, nil
+}
+
+// dateTimeLayouts are the date and time formats SQLite's date functions accept
+var dateTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	time.RFC3339Nano,
+}
+
+// parseDateTime parses a SQLite-style date or datetime, reporting whether it has a time of day
+func parseDateTime(s string) (time.Time, bool, bool) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, false, true
+	}
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+func truncateTime(t time.Time, unit string) (time.Time, error) {
+	y, mo, d := t.Date()
+	switch unit {
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, t.Location()), nil
+	case "quarter":
+		return time.Date(y, (mo-1)/3*3+1, 1, 0, 0, 0, 0, t.Location()), nil
+	case "month":
+		return time.Date(y, mo, 1, 0, 0, 0, 0, t.Location()), nil
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7 // days since Monday
+		return time.Date(y, mo, d-offset, 0, 0, 0, 0, t.Location()), nil
+	case "day":
+		return time.Date(y, mo, d, 0, 0, 0, 0, t.Location()), nil
+	case "hour":
+		return t.Truncate(time.Hour), nil
+	case "minute":
+		return t.Truncate(time.Minute), nil
+	case "second":
+		return t.Truncate(time.Second), nil
+	default:
+		return time.Time{}, fmt.Errorf("date_trunc: unknown unit %q (use year, quarter, month, week, day, hour, minute or second)", unit)
+	}
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
@@ -1,10 +1,18 @@
 package core
 
 import (
+	"fmt"
+	"math"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/zulfikawr/runsql/internal/parsers"
 )
 
+// inferenceSampleSize is the number of rows used to infer the column types of a source.
+const inferenceSampleSize = 100
+
 var (
 	intRegex   = regexp.MustCompile(`^-?\d+$`)
 	floatRegex = regexp.MustCompile(`^-?\d*\.\d+$`)
@@ -27,3 +35,102 @@ func InferType(value string) string {
 
 	return "TEXT"
 }
+
+// sourceColumnTypes returns the type of each column of a source: the type given by the
+// source if it is a parsers.TypedSource, or else the type inferred from a sample of rows
+func sourceColumnTypes(source parsers.Source, columnCount int, rows [][]interface{}) []string {
+	columnTypes := inferColumnTypes(columnCount, rows)
+	if typed, ok := source.(parsers.TypedSource); ok {
+		for i, t := range typed.ColumnTypes() {
+			if i < columnCount && t != "" {
+				columnTypes[i] = t
+			}
+		}
+	}
+	return columnTypes
+}
+
+// inferColumnTypes infers the type of each column from a sample of rows.
+// If a column has ANY non-integer value (that isn't empty/null), it downgrades to Real or Text.
+// Hierarchy: INTEGER -> REAL -> TEXT
+func inferColumnTypes(columnCount int, rows [][]interface{}) []string {
+	columnTypes := make([]string, columnCount)
+	for colIdx := range columnTypes {
+		isInt := true
+		isReal := true
+
+		for _, row := range rows {
+			if colIdx >= len(row) || row[colIdx] == nil {
+				continue // Skip missing and NULL values
+			}
+			val := fmt.Sprintf("%v", row[colIdx]) // Convert to string for regex check
+
+			if val == "" {
+				continue // Skip empty values
+			}
+
+			typeStr := InferType(val)
+			if typeStr == "TEXT" {
+				isInt = false
+				isReal = false
+				break
+			}
+			if typeStr == "REAL" {
+				isInt = false
+			}
+		}
+
+		if isInt {
+			columnTypes[colIdx] = "INTEGER"
+		} else if isReal {
+			columnTypes[colIdx] = "REAL"
+		} else {
+			columnTypes[colIdx] = "TEXT"
+		}
+	}
+	return columnTypes
+}
+
+// coerceValue converts a value the way SQLite's column affinity would when it is
+// inserted into a column of the given type, so that streamed rows match loaded ones.
+func coerceValue(v interface{}, columnType string) interface{} {
+	switch columnType {
+	case "INTEGER", "REAL":
+		var f float64
+		switch val := v.(type) {
+		case string:
+			s := strings.TrimSpace(val)
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i
+			}
+			parsed, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return v
+			}
+			f = parsed
+		case float64:
+			f = val
+		default:
+			return v
+		}
+		if columnType == "INTEGER" && f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+			return int64(f)
+		}
+		return f
+
+	default:
+		switch val := v.(type) {
+		case nil, string:
+			return v
+		case []byte:
+			return string(val)
+		case bool:
+			if val {
+				return "1"
+			}
+			return "0"
+		default:
+			return fmt.Sprintf("%v", val)
+		}
+	}
+}
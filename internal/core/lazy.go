@@ -0,0 +1,241 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/zulfikawr/runsql/internal/parsers"
+)
+
+// OpenFunc opens the source of a table when it is first needed. The io.Closer, if not
+// nil, is closed once the source has been loaded.
+type OpenFunc func() (parsers.Source, io.Closer, error)
+
+// LazyLoader loads tables into an engine when a query first references them, instead
+// of before any query runs. It is safe for concurrent use; a table is loaded once.
+//
+// Loading a table changes the schema, which SQLite doesn't allow while another
+// connection to an in-memory database is reading it: it waits, forever if that
+// reader is the one waiting for the load. Readers that stay open, such as the rows of a
+// query or a transaction, are marked with Acquire and Release: Load fails with
+// ErrTablesInUse while there are any, instead of waiting.
+type LazyLoader struct {
+	engine  *Engine
+	mu      sync.Mutex
+	pending map[string]lazyTable // Tables not loaded yet, by lowercase name
+	loaded  map[string]bool      // Lowercase names of the tables loaded so far
+
+	gate    sync.Mutex
+	idle    *sync.Cond // Signalled on gate when a load ends
+	readers int        // Open readers, see Acquire
+	loading int        // Loads in progress
+}
+
+// ErrTablesInUse is returned by Load for a table that can't be loaded because the
+// rows of a query or a transaction are open.
+var ErrTablesInUse = errors.New("tables can't be loaded while query rows or a transaction are open")
+
+type lazyTable struct {
+	name string
+	open OpenFunc
+}
+
+// NewLazyLoader returns a loader of tables into the engine, with no tables yet.
+func NewLazyLoader(engine *Engine) *LazyLoader {
+	l := &LazyLoader{
+		engine:  engine,
+		pending: make(map[string]lazyTable),
+		loaded:  make(map[string]bool),
+	}
+	l.idle = sync.NewCond(&l.gate)
+	return l
+}
+
+// Acquire marks a reader of the engine as open, waiting for the loads in progress to
+// end first. Each call must be followed by a call to Release.
+func (l *LazyLoader) Acquire() {
+	l.gate.Lock()
+	defer l.gate.Unlock()
+	for l.loading > 0 {
+		l.idle.Wait()
+	}
+	l.readers++
+}
+
+// Release marks a reader marked with Acquire as closed.
+func (l *LazyLoader) Release() {
+	l.gate.Lock()
+	defer l.gate.Unlock()
+	l.readers--
+}
+
+// Add registers a table to load on first reference, replacing any pending table of the
+// same name.
+func (l *LazyLoader) Add(name string, open OpenFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := strings.ToLower(name)
+	l.pending[key] = lazyTable{name: name, open: open}
+	delete(l.loaded, key)
+}
+
+// Pending returns the names of the tables not loaded yet.
+func (l *LazyLoader) Pending() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	names := make([]string, 0, len(l.pending))
+	for _, t := range l.pending {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+// Load loads a pending table, and reports whether the table is loaded, by this call or
+// an earlier one. A table that was never added is not an error: Load reports false.
+// If loading fails, the table stays pending.
+func (l *LazyLoader) Load(name string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := strings.ToLower(name)
+	if l.loaded[key] {
+		return true, nil
+	}
+	t, ok := l.pending[key]
+	if !ok {
+		return false, nil
+	}
+
+	l.gate.Lock()
+	if l.readers > 0 {
+		l.gate.Unlock()
+		return false, fmt.Errorf("failed to load table %s: %w", t.name, ErrTablesInUse)
+	}
+	l.loading++
+	l.gate.Unlock()
+	defer func() {
+		l.gate.Lock()
+		l.loading--
+		l.idle.Broadcast()
+		l.gate.Unlock()
+	}()
+
+	source, closer, err := t.open()
+	if err != nil {
+		return false, fmt.Errorf("failed to load table %s: %w", t.name, err)
+	}
+	err = l.engine.Load(t.name, source)
+	if closer != nil {
+		closer.Close()
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load table %s: %w", t.name, err)
+	}
+	delete(l.pending, key)
+	l.loaded[key] = true
+	return true, nil
+}
+
+// LoadAll loads every pending table, e.g. before listing the tables of the engine.
+func (l *LazyLoader) LoadAll() error {
+	for _, name := range l.Pending() {
+		if _, err := l.Load(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseLoader makes Query, Stream and RunScript load the tables of the loader that a
+// statement references when SQLite reports them missing, e.g. through a view created by
+// an earlier statement. A nil loader turns it off.
+func (e *Engine) UseLoader(l *LazyLoader) {
+	e.loader = l
+}
+
+// lazily runs fn through the engine's loader, if it has one
+func (e *Engine) lazily(fn func() error) error {
+	if e.loader == nil {
+		return fn()
+	}
+	return e.loader.Do(fn)
+}
+
+// Do runs fn, and while it fails because of a table that is pending, loads that table
+// and runs fn again. SQLite reports a missing table when preparing a statement, before
+// running it, so fn must fail without side effects in that case, as queries do.
+func (l *LazyLoader) Do(fn func() error) error {
+	tried := make(map[string]bool)
+	for {
+		err := fn()
+		name, ok := MissingTable(err)
+		if !ok || tried[strings.ToLower(name)] {
+			return err
+		}
+		tried[strings.ToLower(name)] = true
+
+		loaded, loadErr := l.Load(name)
+		if loadErr != nil {
+			return loadErr
+		}
+		if !loaded {
+			return err
+		}
+	}
+}
+
+// missingTablePattern matches the table named by SQLite's "no such table" error, with
+// its schema if the query gave one
+var missingTablePattern = regexp.MustCompile(`no such table: (?:\w+\.)?(\w+)`)
+
+// MissingTable returns the name of the table an error reports as missing, if it is a
+// "no such table" error.
+func MissingTable(err error) (string, bool) {
+	if err == nil {
+		return "", false
+	}
+	m := missingTablePattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// catalogNames are the tables and pragmas that list the tables of a database: SQL using
+// any of them references every table
+var catalogNames = wordSet("sqlite_master sqlite_schema sqlite_temp_master sqlite_temp_schema pragma_table_list table_list")
+
+// TableRefs holds the names a query or script may reference tables by.
+type TableRefs struct {
+	names map[string]bool // Lowercase
+	all   bool            // Whether the SQL lists the tables, e.g. from sqlite_master
+}
+
+// FindTableRefs finds the tables a query or script may reference without parsing it:
+// every word, quoted identifier and string of the SQL outside comments is taken as a
+// possible table name. That errs on the side of loading, e.g. a column with the name
+// of a table counts as a reference to it, but never misses a table the SQL names, even
+// in a string as in pragma_table_info('users'). SQL reading the list of tables from
+// sqlite_master, sqlite_schema or pragma_table_list references every table.
+func FindTableRefs(sql string) TableRefs {
+	refs := TableRefs{names: make(map[string]bool)}
+	for _, t := range tokenizeSQL(sql) {
+		if t.kind == tokenWord || t.kind == tokenQuoted || t.kind == tokenString {
+			name := strings.ToLower(t.text)
+			refs.names[name] = true
+			if catalogNames[name] {
+				refs.all = true
+			}
+		}
+	}
+	return refs
+}
+
+// Has reports whether the table may be referenced. SQLite compares names without regard
+// to case, and so does Has.
+func (r TableRefs) Has(table string) bool {
+	return r.all || r.names[strings.ToLower(table)]
+}
@@ -0,0 +1,396 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zulfikawr/runsql/internal/parsers"
+)
+
+// loadBatchSize is the number of rows inserted per write transaction. Between batches
+// the write lock is released, so that several loads can take turns.
+const loadBatchSize = 5000
+
+// insertParams is about the number of values bound to one multi-row INSERT statement.
+// The driver binds parameters in time quadratic in their number, so inserting a few
+// dozen rows at once is faster than inserting either one or thousands.
+const insertParams = 200
+
+// loadPragmas tune the connection that inserts a batch of rows into an in-memory
+// database. Batches go to a staging table that is dropped if the load fails, so they
+// need no rollback journal.
+var loadPragmas = []struct{ name, value string }{
+	{"journal_mode", "OFF"},
+	{"synchronous", "OFF"},
+	{"cache_size", "-65536"}, // 64MB
+}
+
+// fileLoadPragmas are the loadPragmas of a database file. It keeps its journal and syncs:
+// without them, a crash in the middle of a batch could corrupt the whole file, tables
+// loaded before included.
+var fileLoadPragmas = []struct{ name, value string }{
+	{"cache_size", "-65536"},
+}
+
+// stagingSeq numbers the staging tables that loads write to before they are renamed.
+var stagingSeq atomic.Int64
+
+// LoadJob is a table to load with LoadAll
+type LoadJob struct {
+	Table  string
+	Source parsers.Source
+}
+
+// LoadProgress reports the progress of one job of LoadAll
+type LoadProgress struct {
+	Index    int    // Position of the job in the list given to LoadAll
+	Table    string // Table being loaded
+	Rows     int64  // Rows loaded so far
+	Done     bool   // Whether the job has finished, successfully or not
+	Cached   bool   // Whether the table was copied from the load cache
+	Err      error  // Why the job failed, once Done
+	Duration time.Duration
+}
+
+// LoadOptions controls LoadAll
+type LoadOptions struct {
+	// Workers is the number of files loaded at the same time (default: the number of CPUs)
+	Workers int
+	// Progress, if set, is called after every batch of rows and when a job is done.
+	// Calls are never concurrent.
+	Progress func(LoadProgress)
+}
+
+// LoadError is the error of one failed job of LoadAll
+type LoadError struct {
+	Index int
+	Table string
+	Err   error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("table %s: %v", e.Table, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// Load reads data from a source and loads it into a table, replacing any existing
+// table with the same name. If the engine has a load cache and the source is a
+// CacheableSource, an unchanged file is copied from the cache instead of being read.
+func (e *Engine) Load(tableName string, source parsers.Source) error {
+	return e.loadJob(0, LoadJob{Table: tableName, Source: source}, func(LoadProgress) {})
+}
+
+// LoadAll loads several sources at once. Sources are parsed concurrently by a bounded
+// pool of workers, while their rows are written to SQLite one batch at a time. Every
+// job is attempted; the errors of the failed ones are joined in the order of the jobs,
+// each as a *LoadError.
+func (e *Engine) LoadAll(jobs []LoadJob, opts LoadOptions) error {
+	errs := make([]error, len(jobs))
+
+	// Loading the same table twice at once would make the result depend on timing
+	seen := make(map[string]bool)
+	for i, job := range jobs {
+		if seen[job.Table] {
+			errs[i] = fmt.Errorf("table %s is loaded more than once", job.Table)
+		}
+		seen[job.Table] = true
+	}
+
+	var progressMu sync.Mutex
+	report := func(p LoadProgress) {
+		if opts.Progress != nil {
+			progressMu.Lock()
+			defer progressMu.Unlock()
+			opts.Progress(p)
+		}
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(jobs))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for i := range indexes {
+				errs[i] = e.loadJob(i, jobs[i], report)
+			}
+		})
+	}
+	for i := range jobs {
+		if errs[i] == nil {
+			indexes <- i
+		} else {
+			report(LoadProgress{Index: i, Table: jobs[i].Table, Done: true, Err: errs[i]})
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	var failed []error
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, &LoadError{Index: i, Table: jobs[i].Table, Err: err})
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// loadJob loads one table, through the load cache if possible, and reports its progress
+func (e *Engine) loadJob(index int, job LoadJob, report func(LoadProgress)) error {
+	start := time.Now()
+	progress := LoadProgress{Index: index, Table: job.Table}
+
+	var key CacheKey
+	cacheable, ok := job.Source.(CacheableSource)
+	useCache := e.cache != nil && ok
+	if useCache {
+		var err error
+		if key, err = cacheable.CacheKey(); err != nil {
+			useCache = false
+		}
+	}
+
+	if useCache {
+		e.writeMu.Lock()
+		rows, hit := e.loadFromCache(job.Table, key)
+		e.writeMu.Unlock()
+		if hit {
+			progress.Rows = rows
+			progress.Done, progress.Cached, progress.Duration = true, true, time.Since(start)
+			report(progress)
+			return nil
+		}
+	}
+
+	err := e.load(job.Table, job.Source, func(rows int64) {
+		progress.Rows = rows
+		progress.Duration = time.Since(start)
+		report(progress)
+	})
+	if err == nil && useCache {
+		e.writeMu.Lock()
+		e.storeInCache(job.Table, key) // Best effort: the table is loaded either way
+		e.writeMu.Unlock()
+	}
+
+	progress.Done, progress.Err, progress.Duration = true, err, time.Since(start)
+	report(progress)
+	return err
+}
+
+// load reads a source into a staging table, one batch of rows at a time, and then
+// renames it to the table name, replacing any previous table of that name. A failed
+// load leaves a previous table untouched.
+func (e *Engine) load(tableName string, source parsers.Source, onBatch func(rows int64)) error {
+	// 1. Get Headers
+	headers, err := source.GetHeaders()
+	if err != nil {
+		return fmt.Errorf("failed to get headers: %w", err)
+	}
+
+	// Sanitize headers: replace spaces with underscores, remove non-alphanumeric chars
+	sanitizedHeaders := make([]string, len(headers))
+	for i, h := range headers {
+		sanitizedHeaders[i] = sanitizeHeader(h)
+	}
+
+	// 2. Read first batch to infer types
+	// Since Read() returns a channel, we can't "peek" easily without consuming.
+	// Strategy:
+	// - Read the first N rows into a buffer.
+	// - Infer types from the buffer.
+	// - Create Table.
+	// - Insert buffered rows.
+	// - Continue streaming the rest.
+
+	rowCh, err := source.Read()
+	if err != nil {
+		return fmt.Errorf("failed to start reading: %w", err)
+	}
+
+	// If we return early, keep draining the channel so the source's goroutine can exit
+	drained := false
+	defer func() {
+		if !drained {
+			go func() {
+				for range rowCh {
+				}
+			}()
+		}
+	}()
+
+	// Read up to sample size
+	var batch [][]interface{}
+	for i := 0; i < inferenceSampleSize; i++ {
+		row, ok := <-rowCh
+		if !ok {
+			break
+		}
+		batch = append(batch, row)
+	}
+
+	// Infer types based on buffered rows
+	columnTypes := sourceColumnTypes(source, len(headers), batch)
+
+	// 3. Create the staging table
+	staging := fmt.Sprintf("%s__loading_%d", tableName, stagingSeq.Add(1))
+	if err := e.write(func(tx *sql.Tx) error {
+		_, err := tx.Exec(buildCreateTableSQL(staging, sanitizedHeaders, columnTypes))
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+	renamed := false
+	defer func() {
+		if !renamed {
+			e.write(func(tx *sql.Tx) error {
+				_, err := tx.Exec("DROP TABLE IF EXISTS " + quoteIdentifier(staging))
+				return err
+			})
+		}
+	}()
+
+	// 4. Insert Data (Buffered + Remaining), a batch per transaction, and several
+	// rows per statement
+	width := len(headers)
+	perInsert := max(1, insertParams/max(width, 1))
+	insertSQL := buildInsertSQL(staging, sanitizedHeaders, perInsert)
+	args := make([]interface{}, 0, perInsert*width)
+	var inserted int64
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := e.writeBulk(func(tx *sql.Tx) error {
+			stmt, err := tx.Prepare(insertSQL)
+			if err != nil {
+				return fmt.Errorf("failed to prepare insert statement: %w", err)
+			}
+			defer stmt.Close()
+
+			for start := 0; start < len(batch); start += perInsert {
+				rows := batch[start:min(start+perInsert, len(batch))]
+				args = args[:0]
+				for _, row := range rows {
+					args = append(args, normalizeRow(row, width)...)
+				}
+
+				// The last rows of a batch may need a shorter statement
+				if len(rows) < perInsert {
+					_, err = tx.Exec(buildInsertSQL(staging, sanitizedHeaders, len(rows)), args...)
+				} else {
+					_, err = stmt.Exec(args...)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to insert rows: %w", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		inserted += int64(len(batch))
+		batch = batch[:0]
+		onBatch(inserted)
+		return nil
+	}
+
+	if len(batch) < loadBatchSize {
+		batch = append(make([][]interface{}, 0, loadBatchSize), batch...)
+	}
+	for row := range rowCh {
+		batch = append(batch, row)
+		if len(batch) >= loadBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	drained = true
+	if err := flush(); err != nil {
+		return err
+	}
+
+	// 5. Replace the table with the staging table
+	err = e.write(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DROP TABLE IF EXISTS " + quoteIdentifier(tableName)); err != nil {
+			return err
+		}
+		_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quoteIdentifier(staging), quoteIdentifier(tableName)))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replace table: %w", err)
+	}
+	renamed = true
+	return nil
+}
+
+// write runs fn in a transaction while holding the engine's write lock. SQLite allows a
+// single writer at a time, so concurrent loads take turns through it.
+func (e *Engine) write(fn func(tx *sql.Tx) error) error {
+	return e.transact(nil, fn)
+}
+
+// writeBulk is write with loadPragmas, or fileLoadPragmas for a database file, set on
+// the connection for the transaction
+func (e *Engine) writeBulk(fn func(tx *sql.Tx) error) error {
+	if e.file {
+		return e.transact(fileLoadPragmas, fn)
+	}
+	return e.transact(loadPragmas, fn)
+}
+
+// transact runs fn in a transaction on a single connection, setting the given pragmas
+// before it and restoring their previous values afterwards
+func (e *Engine) transact(pragmas []struct{ name, value string }, fn func(tx *sql.Tx) error) error {
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+
+	ctx := context.Background()
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	// Pragmas only tune the insert, so one that can't be read or set is skipped
+	for _, p := range pragmas {
+		var previous string
+		if err := conn.QueryRowContext(ctx, "PRAGMA "+p.name).Scan(&previous); err != nil {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("PRAGMA %s = %s", p.name, p.value)); err != nil {
+			continue
+		}
+		defer conn.ExecContext(ctx, fmt.Sprintf("PRAGMA %s = %s", p.name, previous))
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
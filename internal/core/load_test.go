@@ -0,0 +1,174 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/runsql/internal/parsers"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestLoadInsertsInBatches(t *testing.T) {
+	engine, err := OpenEngine(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("Failed to open engine: %v", err)
+	}
+	defer engine.Close()
+
+	// Wider than insertParams, so every statement holds a single row, with a short row
+	// that must be padded with NULLs
+	headers := make([]string, insertParams+1)
+	full := make([]interface{}, len(headers))
+	for i := range headers {
+		headers[i] = fmt.Sprintf("c%d", i)
+		full[i] = i
+	}
+	rows := [][]interface{}{full, {"short"}, full}
+	if err := engine.Load("wide", &MockSource{headers: headers, rows: rows}); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	last := headers[len(headers)-1]
+	_, result, err := engine.Query(fmt.Sprintf("SELECT c0, %s FROM wide ORDER BY rowid", last))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	want := fmt.Sprint([][]interface{}{{int64(0), int64(insertParams)}, {"short", nil}, {int64(0), int64(insertParams)}})
+	if fmt.Sprint(result) != want {
+		t.Errorf("Expected %s, got %v", want, result)
+	}
+
+	// Many narrow rows, ending with a partial statement
+	var narrow [][]interface{}
+	for i := range insertParams + 7 {
+		narrow = append(narrow, []interface{}{i})
+	}
+	if err := engine.Load("narrow", &MockSource{headers: []string{"n"}, rows: narrow}); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	_, result, _ = engine.Query("SELECT count(*), sum(n) FROM narrow")
+	if fmt.Sprint(result) != fmt.Sprintf("[[%d %d]]", len(narrow), len(narrow)*(len(narrow)-1)/2) {
+		t.Errorf("Unexpected rows in narrow: %v", result)
+	}
+
+	// The load pragmas are only in effect while rows are inserted
+	_, result, _ = engine.Query("PRAGMA journal_mode")
+	if result[0][0] != "delete" {
+		t.Errorf("Expected journal_mode to be restored, got %v", result[0][0])
+	}
+	_, result, _ = engine.Query("PRAGMA synchronous")
+	if result[0][0] != int64(2) {
+		t.Errorf("Expected synchronous to be restored, got %v", result[0][0])
+	}
+}
+
+// benchmarkRow returns the i-th row of the benchmark data set: an integer, a name,
+// a price, a date and a flag, so that every inferred type is exercised
+func benchmarkRow(i int) []string {
+	return []string{
+		fmt.Sprint(i),
+		fmt.Sprintf("customer %d", i%1000),
+		fmt.Sprintf("%d.%02d", i%500, i%100),
+		fmt.Sprintf("2024-%02d-%02d", i%12+1, i%28+1),
+		fmt.Sprint(i%2 == 0),
+	}
+}
+
+var benchmarkHeaders = []string{"id", "name", "price", "date", "active"}
+
+// benchmarkLoad loads the source returned by open b.N times and reports rows per second
+func benchmarkLoad(b *testing.B, rows int, open func() (parsers.Source, error)) {
+	engine, err := NewEngine()
+	if err != nil {
+		b.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for b.Loop() {
+		b.StopTimer()
+		source, err := open()
+		if err != nil {
+			b.Fatalf("Failed to open source: %v", err)
+		}
+		b.StartTimer()
+
+		if err := engine.Load("bench", source); err != nil {
+			b.Fatalf("Load failed: %v", err)
+		}
+	}
+	b.ReportMetric(float64(rows*b.N)/b.Elapsed().Seconds(), "rows/s")
+}
+
+func BenchmarkLoadCSV(b *testing.B) {
+	const rows = 100_000
+	var buf bytes.Buffer
+	buf.WriteString(strings.Join(benchmarkHeaders, ",") + "\n")
+	for i := range rows {
+		buf.WriteString(strings.Join(benchmarkRow(i), ",") + "\n")
+	}
+
+	benchmarkLoad(b, rows, func() (parsers.Source, error) {
+		return parsers.NewCSVSource(bytes.NewReader(buf.Bytes()))
+	})
+}
+
+func BenchmarkLoadJSON(b *testing.B) {
+	const rows = 100_000
+	objects := make([]map[string]string, rows)
+	for i := range objects {
+		objects[i] = make(map[string]string)
+		for j, v := range benchmarkRow(i) {
+			objects[i][benchmarkHeaders[j]] = v
+		}
+	}
+	data, err := json.Marshal(objects)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	benchmarkLoad(b, rows, func() (parsers.Source, error) {
+		return parsers.NewJSONSource(bytes.NewReader(data))
+	})
+}
+
+func BenchmarkLoadXLSX(b *testing.B) {
+	const rows = 20_000
+	f := excelize.NewFile()
+	sw, err := f.NewStreamWriter("Sheet1")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := -1; i < rows; i++ {
+		values := benchmarkHeaders
+		if i >= 0 {
+			values = benchmarkRow(i)
+		}
+		cells := make([]interface{}, len(values))
+		for j, v := range values {
+			cells[j] = v
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := sw.SetRow(cell, cells); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		b.Fatal(err)
+	}
+	data, err := f.WriteToBuffer()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	benchmarkLoad(b, rows, func() (parsers.Source, error) {
+		xlsxFile, err := excelize.OpenReader(bytes.NewReader(data.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		return parsers.NewXLSXSource(xlsxFile)
+	})
+}
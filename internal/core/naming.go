@@ -0,0 +1,135 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sqlKeywords are the keywords SQLite doesn't accept as table names without quotes, and
+// the join operators, which would be read as such after a table name
+var sqlKeywords = wordSet(`ADD ALL ALTER AND AS AUTOINCREMENT BETWEEN CASE CHECK COLLATE
+	COMMIT CONSTRAINT CREATE CROSS DEFAULT DEFERRABLE DELETE DISTINCT DROP ELSE ESCAPE
+	EXCEPT EXISTS FOREIGN FROM FULL GROUP HAVING IF IN INDEX INNER INSERT INTERSECT INTO IS
+	ISNULL JOIN LEFT LIMIT NATURAL NOT NOTHING NOTNULL NULL ON OR ORDER OUTER PRIMARY
+	REFERENCES RETURNING RIGHT SELECT SET TABLE THEN TO TRANSACTION UNION UNIQUE UPDATE
+	USING VALUES WHEN WHERE`)
+
+// wordSet returns the set of the space-separated words of s
+func wordSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(s) {
+		set[word] = true
+	}
+	return set
+}
+
+// TableName turns a file name or any other text into a table name that can be used in
+// SQL without quoting. Every run of characters other than ASCII letters, digits and
+// underscores becomes a single underscore, and underscores are trimmed from both ends.
+// A name starting with a digit gets a "t_" prefix, a keyword gets a "_t" suffix, and a
+// name with nothing left is "t". For example, "2025 Q1 sales (final)" becomes
+// "t_2025_Q1_sales_final".
+func TableName(name string) string {
+	var sb strings.Builder
+	separated := false
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			sb.WriteRune(r)
+			separated = false
+		} else if !separated {
+			sb.WriteRune('_')
+			separated = true
+		}
+	}
+
+	table := strings.Trim(sb.String(), "_")
+	switch {
+	case table == "":
+		return "t"
+	case table[0] >= '0' && table[0] <= '9':
+		return "t_" + table
+	case sqlKeywords[strings.ToUpper(table)]:
+		return table + "_t"
+	}
+	return table
+}
+
+// FileTableName returns the table name of a file: the TableName of its base name
+// without the extension
+func FileTableName(path string) string {
+	base := filepath.Base(path)
+	return TableName(strings.TrimSuffix(base, filepath.Ext(base)))
+}
+
+// ValidTableName checks that a name given as a table name, e.g. as an alias, can be used
+// in SQL without quoting: it is made of ASCII letters, digits and underscores, doesn't
+// start with a digit and isn't a keyword.
+func ValidTableName(name string) error {
+	if name == "" {
+		return fmt.Errorf("table name is empty")
+	}
+	for i, r := range name {
+		letter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_'
+		if !letter && !(i > 0 && r >= '0' && r <= '9') {
+			return fmt.Errorf("table name %q must be made of letters, digits and underscores, and not start with a digit", name)
+		}
+	}
+	if sqlKeywords[strings.ToUpper(name)] {
+		return fmt.Errorf("table name %q is an SQL keyword", name)
+	}
+	return nil
+}
+
+// TableNamer hands out table names that don't collide with each other. SQLite compares
+// names without regard to case, so neither does the namer.
+type TableNamer struct {
+	taken map[string]bool
+}
+
+// NewTableNamer returns a namer with no names taken
+func NewTableNamer() *TableNamer {
+	return &TableNamer{taken: make(map[string]bool)}
+}
+
+// Claim takes a name chosen by the user, and reports false if it is already taken
+func (n *TableNamer) Claim(name string) bool {
+	key := strings.ToLower(name)
+	if n.taken[key] {
+		return false
+	}
+	n.taken[key] = true
+	return true
+}
+
+// Unique takes and returns the name, or if it is already taken, the first of name_2,
+// name_3, ... that isn't
+func (n *TableNamer) Unique(name string) string {
+	unique := name
+	for i := 2; !n.Claim(unique); i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	return unique
+}
+
+// SplitAlias splits an input written as alias=path, as given to -f or in a DSN. An input
+// that can't start with an alias, because the part before "=" has a path separator, a
+// dot or a wildcard, or that exists as a path, such as a year=2025 partition directory,
+// is taken as a path with no alias.
+func SplitAlias(entry string) (string, string, error) {
+	alias, path, ok := strings.Cut(entry, "=")
+	if !ok || strings.ContainsAny(alias, `/\.*?[`) {
+		return "", entry, nil
+	}
+	if _, err := os.Stat(entry); err == nil {
+		return "", entry, nil
+	}
+	if err := ValidTableName(alias); err != nil {
+		return "", "", fmt.Errorf("invalid alias in %s: %w", entry, err)
+	}
+	if path == "" {
+		return "", "", fmt.Errorf("no path given for table %s", alias)
+	}
+	return alias, path, nil
+}
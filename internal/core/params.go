@@ -0,0 +1,148 @@
+package core
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Param is a value bound to a query placeholder. Named parameters bind to :name,
+// @name and $name; parameters named by a number N bind to ?N, or to the N-th ?.
+type Param struct {
+	Name  string
+	Value interface{}
+}
+
+// ParseParam parses a parameter given as name=value or name:type=value.
+// The type is one of text (the default), int, float, bool or null.
+func ParseParam(spec string) (Param, error) {
+	key, value, ok := strings.Cut(spec, "=")
+	if !ok {
+		return Param{}, fmt.Errorf("invalid parameter %q: expected name=value", spec)
+	}
+
+	// The name may keep its placeholder prefix, e.g. ":city=Berlin"
+	name, typ, _ := strings.Cut(strings.TrimLeft(strings.TrimSpace(key), ":@$"), ":")
+	param := Param{Name: strings.TrimSpace(name)}
+	if param.Name == "" {
+		return Param{}, fmt.Errorf("invalid parameter %q: missing name", spec)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(typ)) {
+	case "", "text", "string":
+		param.Value = value
+	case "int", "integer":
+		v, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return Param{}, fmt.Errorf("invalid parameter %s: %q is not an integer", param.Name, value)
+		}
+		param.Value = v
+	case "float", "real":
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return Param{}, fmt.Errorf("invalid parameter %s: %q is not a number", param.Name, value)
+		}
+		param.Value = v
+	case "bool", "boolean":
+		v, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return Param{}, fmt.Errorf("invalid parameter %s: %q is not a boolean", param.Name, value)
+		}
+		param.Value = v
+	case "null":
+		param.Value = nil
+	default:
+		return Param{}, fmt.Errorf("invalid parameter %s: unknown type %q (use text, int, float, bool or null)", param.Name, typ)
+	}
+	return param, nil
+}
+
+// ParamsFromJSON parses parameters from a JSON object of named values, or from a
+// JSON array of positional values. Whole numbers become integers.
+func ParamsFromJSON(data []byte) ([]Param, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	var params []Param
+	switch v := raw.(type) {
+	case map[string]interface{}:
+		for name, value := range v {
+			params = append(params, Param{Name: strings.TrimLeft(name, ":@$"), Value: value})
+		}
+		// Map order is random; keep errors and binding deterministic
+		sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	case []interface{}:
+		for i, value := range v {
+			params = append(params, Param{Name: strconv.Itoa(i + 1), Value: value})
+		}
+	default:
+		return nil, fmt.Errorf("invalid parameters: expected a JSON object or array")
+	}
+
+	for i, p := range params {
+		switch value := p.Value.(type) {
+		case json.Number:
+			if n, err := value.Int64(); err == nil {
+				params[i].Value = n
+			} else if f, err := value.Float64(); err == nil {
+				params[i].Value = f
+			} else {
+				return nil, fmt.Errorf("invalid parameter %s: %s is out of range", p.Name, value)
+			}
+		case nil, string, bool:
+		default:
+			return nil, fmt.Errorf("invalid parameter %s: only strings, numbers, booleans and null are supported", p.Name)
+		}
+	}
+	return params, nil
+}
+
+// maxParamPosition is the highest placeholder number SQLite accepts (SQLITE_MAX_VARIABLE_NUMBER)
+const maxParamPosition = 32766
+
+// BindArgs converts parameters to query arguments. Positional parameters come first,
+// ordered by number with gaps bound to NULL, followed by the named ones.
+func BindArgs(params []Param) ([]interface{}, error) {
+	var positional []interface{}
+	var named []interface{}
+	seen := make(map[string]bool)
+
+	for _, p := range params {
+		if seen[p.Name] {
+			return nil, fmt.Errorf("parameter %s is given more than once", p.Name)
+		}
+		seen[p.Name] = true
+
+		if n, err := strconv.Atoi(p.Name); err == nil {
+			if n < 1 {
+				return nil, fmt.Errorf("invalid parameter %s: positions start at 1", p.Name)
+			}
+			if n > maxParamPosition {
+				return nil, fmt.Errorf("invalid parameter %s: positions go up to %d", p.Name, maxParamPosition)
+			}
+			for len(positional) < n {
+				positional = append(positional, nil)
+			}
+			positional[n-1] = p.Value
+			continue
+		}
+
+		if r, _ := utf8.DecodeRuneInString(p.Name); !unicode.IsLetter(r) {
+			return nil, fmt.Errorf("invalid parameter %s: names must start with a letter", p.Name)
+		}
+		named = append(named, sql.Named(p.Name, p.Value))
+	}
+
+	return append(positional, named...), nil
+}
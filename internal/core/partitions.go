@@ -0,0 +1,465 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// HiveDefaultPartition is the value Hive writes for a partition key that is NULL
+const HiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// PartitionColumns turns the raw values of partition keys, one row of values per
+// partition and one value per key, into column values. A key whose values are all
+// integers gets int64 values, one whose values are all numbers float64 values, and any
+// other key keeps its strings. Empty values and HiveDefaultPartition are NULL.
+func PartitionColumns(values [][]string) [][]interface{} {
+	columns := make([][]interface{}, len(values))
+	for i := range values {
+		columns[i] = make([]interface{}, len(values[i]))
+	}
+	if len(values) == 0 {
+		return columns
+	}
+
+	for key := range values[0] {
+		isInt, isReal := true, true
+		for _, row := range values {
+			if v := row[key]; !isNullPartition(v) {
+				switch InferType(v) {
+				case "REAL":
+					isInt = false
+				case "TEXT":
+					isInt, isReal = false, false
+				}
+			}
+		}
+
+		for i, row := range values {
+			v := row[key]
+			switch {
+			case isNullPartition(v):
+				columns[i][key] = nil
+			case isInt:
+				n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+				if err != nil {
+					columns[i][key] = v // Too large for an integer
+				} else {
+					columns[i][key] = n
+				}
+			case isReal:
+				f, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				columns[i][key] = f
+			default:
+				columns[i][key] = v
+			}
+		}
+	}
+	return columns
+}
+
+func isNullPartition(v string) bool {
+	return v == "" || v == HiveDefaultPartition
+}
+
+// PartitionFilter tells from the WHERE clause of a query which partitions of a table
+// can't hold any matching row, so that their files don't need to be loaded. It only
+// understands simple queries on the table alone, naming it only in their FROM clause
+// and not in subqueries, and conditions on partition keys of
+// the form key = literal (or !=, <, <=, >, >=), key IN (literals) and key BETWEEN
+// literal AND literal, combined with AND. Other conditions never exclude a partition.
+type PartitionFilter struct {
+	conditions []partitionCondition
+}
+
+// partitionCondition is a condition on one partition key
+type partitionCondition struct {
+	key    int // Index of the key
+	op     string
+	values []sqlToken // Literals
+}
+
+// NewPartitionFilter returns the filter of a query for a table partitioned by keys, or
+// nil if the query has no condition that can exclude a partition.
+func NewPartitionFilter(query, table string, keys []string) *PartitionFilter {
+	tokens := tokenizeSQL(query)
+	if n := len(tokens); n > 0 && tokens[n-1].is(";") {
+		tokens = tokens[:n-1]
+	}
+	if len(tokens) == 0 || !tokens[0].isKeyword("SELECT") {
+		return nil
+	}
+
+	// Find the FROM and WHERE clauses of the outer query
+	from, where, end := -1, -1, len(tokens)
+	depth := 0
+	for i, t := range tokens {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case depth > 0:
+		case t.is(";"), t.isKeyword("UNION"), t.isKeyword("INTERSECT"), t.isKeyword("EXCEPT"):
+			return nil
+		case t.isKeyword("FROM") && from < 0:
+			from = i
+		case t.isKeyword("WHERE") && where < 0:
+			where = i
+		case where >= 0 && end == len(tokens) && (t.isKeyword("GROUP") || t.isKeyword("ORDER") ||
+			t.isKeyword("LIMIT") || t.isKeyword("HAVING") || t.isKeyword("WINDOW")):
+			end = i
+		}
+	}
+	if from < 0 || where < from {
+		return nil
+	}
+
+	// The table must be the only one queried: table [[AS] alias]
+	names := map[string]bool{strings.ToLower(table): true}
+	source := tokens[from+1 : where]
+	switch {
+	case len(source) == 1:
+	case len(source) == 2 && source[1].isName():
+		names[strings.ToLower(source[1].text)] = true
+	case len(source) == 3 && source[1].isKeyword("AS") && source[2].isName():
+		names[strings.ToLower(source[2].text)] = true
+	default:
+		return nil
+	}
+	if !source[0].isName() || !strings.EqualFold(source[0].text, table) {
+		return nil
+	}
+
+	// A subquery reading the table anywhere else would see only the partitions left
+	for i, t := range tokens {
+		if i != from+1 && t.isName() && strings.EqualFold(t.text, table) {
+			return nil
+		}
+	}
+
+	keyIndex := make(map[string]int)
+	for i, key := range keys {
+		keyIndex[strings.ToLower(sanitizeHeader(key))] = i
+	}
+
+	filter := &PartitionFilter{}
+	for _, conjunct := range splitConjuncts(tokens[where+1 : end]) {
+		if conjunct == nil {
+			return nil // An OR at the top level
+		}
+		if c, ok := parsePartitionCondition(conjunct, keyIndex, names); ok {
+			filter.conditions = append(filter.conditions, c)
+		}
+	}
+	if len(filter.conditions) == 0 {
+		return nil
+	}
+	return filter
+}
+
+// splitConjuncts splits a condition at its top-level ANDs, keeping the AND of BETWEEN.
+// A top-level OR makes the result contain a nil conjunct.
+func splitConjuncts(tokens []sqlToken) [][]sqlToken {
+	var conjuncts [][]sqlToken
+	start, depth := 0, 0
+	between := false
+	for i, t := range tokens {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case depth > 0:
+		case t.isKeyword("OR"):
+			return [][]sqlToken{nil}
+		case t.isKeyword("BETWEEN"):
+			between = true
+		case t.isKeyword("AND") && between:
+			between = false
+		case t.isKeyword("AND"):
+			conjuncts = append(conjuncts, tokens[start:i])
+			start = i + 1
+		}
+	}
+	return append(conjuncts, tokens[start:])
+}
+
+// parsePartitionCondition recognizes a condition on a single partition key
+func parsePartitionCondition(tokens []sqlToken, keyIndex map[string]int, tables map[string]bool) (partitionCondition, bool) {
+	// column reference: key or table.key
+	column := func(ts []sqlToken) (int, int, bool) {
+		if len(ts) >= 3 && ts[0].isName() && ts[1].is(".") && ts[2].isName() {
+			if !tables[strings.ToLower(ts[0].text)] {
+				return 0, 0, false
+			}
+			key, ok := keyIndex[strings.ToLower(ts[2].text)]
+			return key, 3, ok
+		}
+		if len(ts) >= 1 && ts[0].isName() {
+			key, ok := keyIndex[strings.ToLower(ts[0].text)]
+			return key, 1, ok
+		}
+		return 0, 0, false
+	}
+
+	// literal: a string or a number, which may be negative
+	literal := func(ts []sqlToken) (sqlToken, int, bool) {
+		if len(ts) >= 2 && ts[0].is("-") && ts[1].kind == tokenNumber {
+			return sqlToken{kind: tokenNumber, text: "-" + ts[1].text}, 2, true
+		}
+		if len(ts) >= 1 && (ts[0].kind == tokenNumber || ts[0].kind == tokenString) {
+			return ts[0], 1, true
+		}
+		return sqlToken{}, 0, false
+	}
+
+	comparisons := map[string]string{"=": "=", "==": "=", "!=": "!=", "<>": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">="}
+	flipped := map[string]string{"=": "=", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+	// key op literal
+	if key, n, ok := column(tokens); ok && len(tokens) > n {
+		rest := tokens[n:]
+		if op, isOp := comparisons[rest[0].text]; isOp && rest[0].kind == tokenSymbol {
+			if lit, m, ok := literal(rest[1:]); ok && 1+m == len(rest) {
+				return partitionCondition{key: key, op: op, values: []sqlToken{lit}}, true
+			}
+		}
+
+		// key IN (literal, ...)
+		if rest[0].isKeyword("IN") && len(rest) >= 4 && rest[1].is("(") && rest[len(rest)-1].is(")") {
+			var values []sqlToken
+			list := rest[2 : len(rest)-1]
+			for len(list) > 0 {
+				lit, m, ok := literal(list)
+				if !ok {
+					return partitionCondition{}, false
+				}
+				values = append(values, lit)
+				list = list[m:]
+				if len(list) > 0 {
+					if !list[0].is(",") {
+						return partitionCondition{}, false
+					}
+					list = list[1:]
+				}
+			}
+			return partitionCondition{key: key, op: "IN", values: values}, true
+		}
+
+		// key BETWEEN literal AND literal
+		if rest[0].isKeyword("BETWEEN") {
+			low, m, ok := literal(rest[1:])
+			if !ok || len(rest) <= 1+m || !rest[1+m].isKeyword("AND") {
+				return partitionCondition{}, false
+			}
+			high, k, ok := literal(rest[2+m:])
+			if !ok || 2+m+k != len(rest) {
+				return partitionCondition{}, false
+			}
+			return partitionCondition{key: key, op: "BETWEEN", values: []sqlToken{low, high}}, true
+		}
+		return partitionCondition{}, false
+	}
+
+	// literal op key
+	if lit, n, ok := literal(tokens); ok && len(tokens) > n+1 {
+		if op, isOp := comparisons[tokens[n].text]; isOp && tokens[n].kind == tokenSymbol {
+			if key, m, ok := column(tokens[n+1:]); ok && n+1+m == len(tokens) {
+				return partitionCondition{key: key, op: flipped[op], values: []sqlToken{lit}}, true
+			}
+		}
+	}
+	return partitionCondition{}, false
+}
+
+// Match reports whether a partition, given the column values of its keys as returned
+// by PartitionColumns, may hold rows matching the query
+func (f *PartitionFilter) Match(values []interface{}) bool {
+	for _, c := range f.conditions {
+		v := values[c.key]
+		if v == nil {
+			return false // A comparison with NULL is never true
+		}
+
+		// may reports whether the comparison with a literal may be true; comparisons
+		// that can't be decided are assumed to be
+		may := func(lit sqlToken, test func(int) bool) bool {
+			cmp, ok := comparePartition(v, lit)
+			return !ok || test(cmp)
+		}
+
+		var match bool
+		switch c.op {
+		case "=":
+			match = may(c.values[0], func(cmp int) bool { return cmp == 0 })
+		case "!=":
+			match = may(c.values[0], func(cmp int) bool { return cmp != 0 })
+		case "<":
+			match = may(c.values[0], func(cmp int) bool { return cmp < 0 })
+		case "<=":
+			match = may(c.values[0], func(cmp int) bool { return cmp <= 0 })
+		case ">":
+			match = may(c.values[0], func(cmp int) bool { return cmp > 0 })
+		case ">=":
+			match = may(c.values[0], func(cmp int) bool { return cmp >= 0 })
+		case "IN":
+			for _, lit := range c.values {
+				if may(lit, func(cmp int) bool { return cmp == 0 }) {
+					match = true
+					break
+				}
+			}
+		case "BETWEEN":
+			match = may(c.values[0], func(cmp int) bool { return cmp >= 0 }) &&
+				may(c.values[1], func(cmp int) bool { return cmp <= 0 })
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
+
+// comparePartition compares a partition value with a literal the way SQLite compares
+// a column of the value's type with it. It reports false if it can't tell.
+func comparePartition(v interface{}, lit sqlToken) (int, bool) {
+	switch v := v.(type) {
+	case int64, float64:
+		// A numeric column converts a literal that looks like a number
+		n, err := strconv.ParseFloat(lit.text, 64)
+		if err != nil {
+			return -1, true // Numbers sort before text
+		}
+		f, _ := v.(float64)
+		if i, ok := v.(int64); ok {
+			f = float64(i)
+		}
+		return cmpOrdered(f, n), true
+	case string:
+		// A text column compares with the text of a numeric literal, which is only
+		// written the same way for integers
+		if lit.kind == tokenNumber && !intRegex.MatchString(lit.text) {
+			return 0, false
+		}
+		return strings.Compare(v, lit.text), true
+	}
+	return 0, false
+}
+
+// tokenKind is the kind of a token of a SQL statement
+type tokenKind int
+
+const (
+	tokenWord   tokenKind = iota // Keyword or unquoted identifier
+	tokenQuoted                  // Quoted identifier, without its quotes
+	tokenString                  // String literal, without its quotes
+	tokenNumber
+	tokenParam  // Placeholder: ?, ?1, :name, @name or $name
+	tokenSymbol // Operator or punctuation
+)
+
+// sqlToken is a token of a SQL statement
+type sqlToken struct {
+	kind tokenKind
+	text string
+}
+
+func (t sqlToken) is(symbol string) bool {
+	return t.kind == tokenSymbol && t.text == symbol
+}
+
+func (t sqlToken) isKeyword(word string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, word)
+}
+
+// isName reports whether the token can name a table or column
+func (t sqlToken) isName() bool {
+	return t.kind == tokenWord || t.kind == tokenQuoted
+}
+
+// tokenizeSQL splits SQL into tokens, dropping whitespace and comments
+func tokenizeSQL(sql string) []sqlToken {
+	var tokens []sqlToken
+	runes := []rune(sql)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				i++
+			}
+			i++
+
+		case r == '\'' || r == '"' || r == '`' || r == '[':
+			// Quotes are escaped by doubling them
+			closing := r
+			if r == '[' {
+				closing = ']'
+			}
+			var sb strings.Builder
+			for i++; i < len(runes); i++ {
+				if runes[i] == closing {
+					if closing != ']' && i+1 < len(runes) && runes[i+1] == closing {
+						i++
+					} else {
+						break
+					}
+				}
+				sb.WriteRune(runes[i])
+			}
+			kind := tokenQuoted
+			if r == '\'' {
+				kind = tokenString
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: sb.String()})
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || unicode.IsLetter(runes[j]) || runes[j] == '.' ||
+				((runes[j] == '+' || runes[j] == '-') && (runes[j-1] == 'e' || runes[j-1] == 'E'))) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenNumber, text: string(runes[i:j])})
+			i = j - 1
+
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '$') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenWord, text: string(runes[i:j])})
+			i = j - 1
+
+		case r == '?' || r == ':' || r == '@' || r == '$':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenParam, text: string(runes[i:j])})
+			i = j - 1
+
+		default:
+			// Two-character operators first
+			if i+1 < len(runes) {
+				switch op := string(runes[i : i+2]); op {
+				case "==", "!=", "<>", "<=", ">=", "||", "<<", ">>":
+					tokens = append(tokens, sqlToken{kind: tokenSymbol, text: op})
+					i++
+					continue
+				}
+			}
+			tokens = append(tokens, sqlToken{kind: tokenSymbol, text: string(r)})
+		}
+	}
+	return tokens
+}
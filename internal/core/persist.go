@@ -0,0 +1,47 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SaveQuery stores the result of a query as a table, replacing any existing table
+// with the same name, so that it is kept by Export and by engines opened on a file.
+func (e *Engine) SaveQuery(tableName, query string, args ...interface{}) error {
+	tx, err := e.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DROP TABLE IF EXISTS " + quoteIdentifier(tableName)); err != nil {
+		return fmt.Errorf("failed to replace table %s: %w", tableName, err)
+	}
+	if _, err := tx.Exec(fmt.Sprintf("CREATE TABLE %s AS %s", quoteIdentifier(tableName), query), args...); err != nil {
+		return fmt.Errorf("failed to save query as %s: %w", tableName, err)
+	}
+	return tx.Commit()
+}
+
+// Export writes the tables of the engine to a standalone SQLite database file, replacing
+// the file if it exists. Temporary tables are not included.
+func (e *Engine) Export(path string) error {
+	// VACUUM INTO refuses to overwrite a file, so write next to the target and rename
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create database file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	os.Remove(tmpPath)
+	defer os.Remove(tmpPath)
+
+	if _, err := e.db.Exec("VACUUM INTO ?", tmpPath); err != nil {
+		return fmt.Errorf("failed to write database: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to write database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultTopValues is the number of most frequent values reported per column.
+	DefaultTopValues = 5
+
+	profilePatternCount = 3    // Patterns reported per column
+	maxTrackedPatterns  = 1000 // Distinct patterns tracked per column before the rest is ignored
+	maxPatternRunes     = 64   // Longer values are summarized by their first runes only
+)
+
+// Profile computes descriptive statistics for every column of a table:
+// null percentage, distinct count, min/max, mean and standard deviation for
+// numeric columns, the topN most frequent values, the distribution of value
+// lengths and a summary of the value shapes.
+func (e *Engine) Profile(tableName string, topN int) (TableProfile, error) {
+	table, err := e.DescribeTable(tableName)
+	if err != nil {
+		return TableProfile{}, err
+	}
+	if topN <= 0 {
+		topN = DefaultTopValues
+	}
+
+	profile := TableProfile{Table: table.Name, RowCount: table.RowCount}
+	quotedTable := quoteIdentifier(table.Name)
+
+	for i, col := range table.Columns {
+		stats := table.Stats[i]
+		quotedCol := quoteIdentifier(col)
+
+		cp := ColumnProfile{
+			Name:     col,
+			Type:     table.Types[i],
+			Distinct: stats.Distinct,
+			Min:      stats.Min,
+			Max:      stats.Max,
+		}
+
+		// Nulls and, for numeric values, mean and standard deviation
+		_, rows, err := e.Query(fmt.Sprintf(`SELECT
+			SUM(CASE WHEN NULLIF(%[1]s, '') IS NULL THEN 1 ELSE 0 END),
+			COUNT(num), AVG(num)
+			FROM (SELECT %[1]s, CASE WHEN typeof(%[1]s) IN ('integer', 'real') THEN %[1]s END AS num FROM %[2]s)`,
+			quotedCol, quotedTable))
+		if err != nil {
+			return profile, fmt.Errorf("failed to profile column %s: %w", col, err)
+		}
+		cp.Nulls = toInt64(rows[0][0])
+		if profile.RowCount > 0 {
+			cp.NullPercent = float64(cp.Nulls) * 100 / float64(profile.RowCount)
+		}
+		if numCount := toInt64(rows[0][1]); numCount > 0 && isNumericType(cp.Type) {
+			mean := toFloat64(rows[0][2])
+			cp.Mean = &mean
+			if numCount > 1 {
+				// Squared deviations from the mean, summed as floats in a second pass: the sum
+				// of squares minus the squared mean overflows integers and loses precision on
+				// large values with a small spread, such as timestamps
+				_, rows, err := e.Query(fmt.Sprintf(`SELECT TOTAL((num - ?) * (num - ?))
+					FROM (SELECT CASE WHEN typeof(%[1]s) IN ('integer', 'real') THEN %[1]s END AS num FROM %[2]s)`,
+					quotedCol, quotedTable), mean, mean)
+				if err != nil {
+					return profile, fmt.Errorf("failed to profile column %s: %w", col, err)
+				}
+				stddev := math.Sqrt(toFloat64(rows[0][0]) / float64(numCount-1))
+				cp.StdDev = &stddev
+			}
+		}
+
+		// Most frequent values
+		_, rows, err = e.Query(fmt.Sprintf(
+			`SELECT %[1]s, COUNT(*) AS n FROM %[2]s WHERE NULLIF(%[1]s, '') IS NOT NULL
+			GROUP BY %[1]s ORDER BY n DESC, %[1]s LIMIT %[3]d`,
+			quotedCol, quotedTable, topN))
+		if err != nil {
+			return profile, fmt.Errorf("failed to profile column %s: %w", col, err)
+		}
+		cp.TopValues = make([]ValueCount, len(rows))
+		for j, row := range rows {
+			cp.TopValues[j] = ValueCount{Value: row[0], Count: toInt64(row[1])}
+		}
+
+		profile.Columns = append(profile.Columns, cp)
+	}
+
+	// Lengths and patterns need every value, so they are collected in one pass over the table
+	if err := e.profileValues(quotedTable, profile.Columns); err != nil {
+		return profile, err
+	}
+
+	return profile, nil
+}
+
+// profileValues scans a table once and fills in the length distribution and
+// pattern summary of every column.
+func (e *Engine) profileValues(quotedTable string, columns []ColumnProfile) error {
+	rows, err := e.db.Query(fmt.Sprintf("SELECT * FROM %s", quotedTable))
+	if err != nil {
+		return fmt.Errorf("failed to scan table: %w", err)
+	}
+	defer rows.Close()
+
+	lengths := make([]map[int]int64, len(columns))
+	patterns := make([]map[string]int64, len(columns))
+	for i := range columns {
+		lengths[i] = make(map[int]int64)
+		patterns[i] = make(map[string]int64)
+	}
+
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+			var str string
+			if b, ok := v.([]byte); ok {
+				str = string(b)
+			} else {
+				str = fmt.Sprintf("%v", v)
+			}
+			if str == "" {
+				continue
+			}
+
+			lengths[i][utf8.RuneCountInString(str)]++
+
+			pattern := valuePattern(str)
+			if _, ok := patterns[i][pattern]; ok || len(patterns[i]) < maxTrackedPatterns {
+				patterns[i][pattern]++
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to scan table: %w", err)
+	}
+
+	for i := range columns {
+		columns[i].Lengths = lengthDistribution(lengths[i])
+		columns[i].Patterns = topPatterns(patterns[i], profilePatternCount)
+	}
+	return nil
+}
+
+// lengthDistribution computes the min, percentiles, max and mean of a histogram of lengths.
+func lengthDistribution(histogram map[int]int64) LengthDistribution {
+	var dist LengthDistribution
+	if len(histogram) == 0 {
+		return dist
+	}
+
+	keys := make([]int, 0, len(histogram))
+	var total, sum int64
+	for length, count := range histogram {
+		keys = append(keys, length)
+		total += count
+		sum += int64(length) * count
+	}
+	sort.Ints(keys)
+
+	dist.Min = keys[0]
+	dist.Max = keys[len(keys)-1]
+	dist.Mean = float64(sum) / float64(total)
+
+	// Walk the sorted histogram to find the percentiles
+	var seen int64
+	p50, p90 := (total+1)/2, (total*9+9)/10
+	dist.P50, dist.P90 = -1, -1
+	for _, length := range keys {
+		seen += histogram[length]
+		if dist.P50 < 0 && seen >= p50 {
+			dist.P50 = length
+		}
+		if dist.P90 < 0 && seen >= p90 {
+			dist.P90 = length
+		}
+	}
+	return dist
+}
+
+// topPatterns returns the n most common patterns with their share of all counted values.
+func topPatterns(counts map[string]int64, n int) []PatternCount {
+	var total int64
+	result := make([]PatternCount, 0, len(counts))
+	for pattern, count := range counts {
+		total += count
+		result = append(result, PatternCount{Pattern: pattern, Count: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Pattern < result[j].Pattern
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	for i := range result {
+		result[i].Percent = float64(result[i].Count) * 100 / float64(total)
+	}
+	return result
+}
+
+// valuePattern describes the shape of a value as a regular expression, collapsing
+// runs of digits, letters and repeated characters: "12345" becomes `\d{5}` and
+// "AB-12" becomes `[A-Z]{2}-\d{2}`.
+func valuePattern(s string) string {
+	var sb strings.Builder
+	prev, run := "", 0
+
+	flush := func() {
+		if run == 0 {
+			return
+		}
+		sb.WriteString(prev)
+		if run > 1 {
+			fmt.Fprintf(&sb, "{%d}", run)
+		}
+	}
+
+	runes := 0
+	for _, r := range s {
+		if runes == maxPatternRunes {
+			flush()
+			sb.WriteString(".*")
+			return sb.String()
+		}
+		runes++
+
+		var class string
+		switch {
+		case unicode.IsDigit(r):
+			class = `\d`
+		case unicode.IsUpper(r):
+			class = "[A-Z]"
+		case unicode.IsLower(r):
+			class = "[a-z]"
+		case unicode.IsSpace(r):
+			class = `\s`
+		default:
+			class = regexp.QuoteMeta(string(r))
+		}
+
+		if class == prev {
+			run++
+			continue
+		}
+		flush()
+		prev, run = class, 1
+	}
+	flush()
+	return sb.String()
+}
+
+// isNumericType reports whether a declared column type holds numbers.
+func isNumericType(t string) bool {
+	return t == "INTEGER" || t == "REAL"
+}
+
+// toFloat64 converts a numeric result of an aggregate query.
+func toFloat64(v interface{}) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,245 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Statement is a single SQL statement of a script.
+type Statement struct {
+	Index int    // 1-based position in the script
+	Line  int    // 1-based line on which the statement starts
+	SQL   string // Statement text, without the terminating semicolon
+}
+
+// StatementResult is the outcome of one statement of a script.
+type StatementResult struct {
+	Statement
+	Columns      []string        // Result columns; empty for statements that return no rows
+	Rows         [][]interface{} // Result rows
+	Truncated    bool            // Rows stopped at the limit given to RunScriptLimit
+	RowsAffected int64           // Rows inserted, updated or deleted
+	Duration     time.Duration
+}
+
+// ScriptError reports the statement at which a script stopped.
+type ScriptError struct {
+	Statement
+	Err error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("statement %d (line %d): %v", e.Index, e.Line, e.Err)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// RunScript splits a script into statements and executes them in order on a single
+// connection, so temporary tables and other per-connection state carry over from one
+// statement to the next. It stops at the first failing statement and returns a
+// *ScriptError along with the results of the statements that succeeded.
+// The arguments are bound to the placeholders of every statement that uses them.
+func (e *Engine) RunScript(script string, args ...interface{}) ([]StatementResult, error) {
+	return e.RunScriptLimit(script, 0, args...)
+}
+
+// RunScriptLimit is RunScript keeping at most maxRows rows of the result of each
+// statement, or every row if maxRows is 0.
+func (e *Engine) RunScriptLimit(script string, maxRows int, args ...interface{}) ([]StatementResult, error) {
+	ctx := context.Background()
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	var results []StatementResult
+	for _, stmt := range SplitStatements(script) {
+		start := time.Now()
+
+		// total_changes() counts every row changed on the connection, so the difference
+		// is what this statement changed, whatever kind of statement it is
+		var before int64
+		if err := conn.QueryRowContext(ctx, "SELECT total_changes()").Scan(&before); err != nil {
+			return results, &ScriptError{Statement: stmt, Err: err}
+		}
+
+		var columns []string
+		var rows [][]interface{}
+		var truncated bool
+		err := e.lazily(func() error {
+			var err error
+			columns, rows, truncated, err = queryRows(ctx, conn, stmt.SQL, maxRows, args...)
+			return err
+		})
+		if err != nil {
+			return results, &ScriptError{Statement: stmt, Err: err}
+		}
+
+		var after int64
+		if err := conn.QueryRowContext(ctx, "SELECT total_changes()").Scan(&after); err != nil {
+			return results, &ScriptError{Statement: stmt, Err: err}
+		}
+
+		results = append(results, StatementResult{
+			Statement:    stmt,
+			Columns:      columns,
+			Rows:         rows,
+			Truncated:    truncated,
+			RowsAffected: after - before,
+			Duration:     time.Since(start),
+		})
+	}
+	return results, nil
+}
+
+// SplitStatements splits a script into statements at semicolons, ignoring semicolons
+// inside string literals, quoted identifiers, comments and the BEGIN ... END body of
+// CREATE TRIGGER. Statements that are empty or only contain comments are dropped.
+func SplitStatements(script string) []Statement {
+	var statements []Statement
+
+	runes := []rune(script)
+	line := 1
+	start := -1        // offset of the first token of the current statement
+	startLine := 0     // line of that token
+	var words []string // leading keywords of the current statement, upper-cased
+	depth := 0         // BEGIN/CASE nesting inside a trigger body
+
+	isTrigger := func() bool {
+		// CREATE [TEMP|TEMPORARY] TRIGGER
+		for i, w := range words {
+			if i > 2 {
+				break
+			}
+			if w == "TRIGGER" {
+				return words[0] == "CREATE"
+			}
+		}
+		return false
+	}
+
+	flush := func(end int) {
+		if start >= 0 {
+			sql := strings.TrimSpace(string(runes[start:end]))
+			if sql != "" {
+				statements = append(statements, Statement{Index: len(statements) + 1, Line: startLine, SQL: sql})
+			}
+		}
+		start, words, depth = -1, nil, 0
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '\n':
+			line++
+			continue
+
+		case unicode.IsSpace(r):
+			continue
+
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			// Line comment
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			i-- // let the loop see the newline
+			continue
+
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			// Block comment
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				if runes[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			i++ // skip the closing '/'
+			continue
+		}
+
+		if start < 0 {
+			start, startLine = i, line
+		}
+
+		switch {
+		case r == ';':
+			if depth > 0 {
+				continue
+			}
+			flush(i)
+
+		case r == '\'' || r == '"' || r == '`' || r == '[':
+			// String literal or quoted identifier; quotes are escaped by doubling them
+			closing := r
+			if r == '[' {
+				closing = ']'
+			}
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\n' {
+					line++
+				}
+				if runes[i] == closing {
+					if closing != ']' && i+1 < len(runes) && runes[i+1] == closing {
+						i++
+						continue
+					}
+					break
+				}
+			}
+
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '$') {
+				j++
+			}
+			word := strings.ToUpper(string(runes[i:j]))
+			i = j - 1
+
+			if len(words) < 4 {
+				words = append(words, word)
+			}
+			if isTrigger() {
+				switch word {
+				case "BEGIN", "CASE":
+					depth++
+				case "END":
+					if depth > 0 {
+						depth--
+					}
+				}
+			}
+		}
+	}
+	flush(len(runes))
+
+	return statements
+}
+
+// SetsPragma reports whether any statement of the SQL sets the named pragma, as in
+// PRAGMA query_only = 0 or PRAGMA main.query_only(0). Reading it doesn't count.
+func SetsPragma(sql, name string) bool {
+	tokens := tokenizeSQL(sql)
+	for i, t := range tokens {
+		if !t.isKeyword("PRAGMA") {
+			continue
+		}
+		j := i + 1
+		if j+1 < len(tokens) && tokens[j+1].is(".") {
+			j += 2 // Schema name
+		}
+		if j+1 < len(tokens) && tokens[j].isName() && strings.EqualFold(tokens[j].text, name) &&
+			(tokens[j+1].is("=") || tokens[j+1].is("(")) {
+			return true
+		}
+	}
+	return false
+}
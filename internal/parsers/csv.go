@@ -2,6 +2,7 @@ package parsers
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 )
@@ -15,7 +16,14 @@ type CSVSource struct {
 // NewCSVSource creates a new CSVSource from an io.Reader.
 // It assumes the first row contains headers.
 func NewCSVSource(r io.Reader) (*CSVSource, error) {
+	return NewDelimitedSource(r, ',')
+}
+
+// NewDelimitedSource creates a CSVSource for a file whose fields are separated by
+// delimiter instead of a comma, e.g. '\t' or ';'.
+func NewDelimitedSource(r io.Reader, delimiter rune) (*CSVSource, error) {
 	csvReader := csv.NewReader(r)
+	csvReader.Comma = delimiter
 	// Allow variable field counts per record (some rows might have more/fewer fields)
 	csvReader.FieldsPerRecord = -1
 
@@ -38,7 +46,7 @@ func (s *CSVSource) GetHeaders() ([]string, error) {
 
 // Read streams rows from the CSV file.
 func (s *CSVSource) Read() (chan []interface{}, error) {
-	out := make(chan []interface{})
+	out := make(chan []interface{}, readAhead)
 
 	go func() {
 		defer close(out)
@@ -48,9 +56,14 @@ func (s *CSVSource) Read() (chan []interface{}, error) {
 				break
 			}
 			if err != nil {
-				// Log the error but continue reading for robustness
-				// Some CSV files may have formatting issues on certain lines
-				continue
+				// Skip malformed lines for robustness, some CSV files may have
+				// formatting issues on certain lines
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) {
+					continue
+				}
+				// Any other error comes from the underlying reader and won't go away
+				break
 			}
 
 			// Convert []string to []interface{}
@@ -0,0 +1,492 @@
+package parsers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// SniffSize is the number of leading bytes of a file its format is detected from
+const SniffSize = 8 << 10
+
+// sniffDelimiters are the field separators CSV files are checked for, in order of preference
+var sniffDelimiters = []byte{',', ';', '\t', '|'}
+
+// Options are settings of how files are read, by name, e.g. delimiter=; for CSV files.
+// A format only looks at the options it declares.
+type Options map[string]string
+
+// Format describes an input format. Every format is registered once, with the
+// extensions, MIME types and leading bytes it is recognized by, and is then read the
+// same way by the CLI, the web server and convert.
+type Format struct {
+	Name       string                 // e.g., "csv"
+	Extensions []string               // Lower-cased file extensions, e.g. ".csv"
+	MIMETypes  []string               // Content types a file of the format may be uploaded with
+	Options    map[string]string      // Options the format accepts, with a description of each
+	Magic      func(head []byte) bool // Reports whether a file starting with head is of the format; nil if it can't tell
+
+	// RandomAccess is set for formats that can't be parsed from a stream, like XLSX and
+	// Parquet, which are ZIP archives or keep their metadata at the end. New is then given
+	// a File; streams are read into memory first.
+	RandomAccess bool
+
+	// New creates a Source reading r. The io.Closer, if not nil, must be closed once the
+	// source has been read.
+	New func(r io.Reader, options Options) (Source, io.Closer, error)
+}
+
+// File is a file opened for random access, as given to New for RandomAccess formats
+type File interface {
+	io.Reader
+	io.ReaderAt
+	Size() int64
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = builtinFormats()
+)
+
+func builtinFormats() []Format {
+	return []Format{
+		{
+			Name:       "csv",
+			Extensions: []string{".csv"},
+			MIMETypes:  []string{"text/csv", "application/csv"},
+			Options:    map[string]string{"delimiter": "Field separator, a single character or \"tab\" (default: detected, or \",\")"},
+			Magic: func(head []byte) bool {
+				// Any text with a field separator found on every line, short of JSON
+				if bytes.IndexByte(head, 0) != -1 || firstByte(head) == '[' || firstByte(head) == '{' {
+					return false
+				}
+				_, ok := sniffDelimiter(head)
+				return ok
+			},
+			New: func(r io.Reader, options Options) (Source, io.Closer, error) {
+				value, ok := options["delimiter"]
+				if !ok {
+					br := bufio.NewReaderSize(r, SniffSize)
+					head, _ := br.Peek(SniffSize)
+					delimiter, found := sniffDelimiter(head)
+					if !found {
+						delimiter = ','
+					}
+					source, err := NewDelimitedSource(br, delimiter)
+					return source, nil, err
+				}
+				delimiter, err := parseDelimiter(value)
+				if err != nil {
+					return nil, nil, err
+				}
+				source, err := NewDelimitedSource(r, delimiter)
+				return source, nil, err
+			},
+		},
+		{
+			Name:       "json",
+			Extensions: []string{".json"},
+			MIMETypes:  []string{"application/json"},
+			Magic:      func(head []byte) bool { return firstByte(head) == '[' },
+			New: func(r io.Reader, options Options) (Source, io.Closer, error) {
+				source, err := NewJSONSource(r)
+				return source, nil, err
+			},
+		},
+		{
+			Name:       "ndjson",
+			Extensions: []string{".ndjson", ".jsonl"},
+			MIMETypes:  []string{"application/x-ndjson", "application/jsonl", "application/x-jsonlines"},
+			Magic:      func(head []byte) bool { return firstByte(head) == '{' },
+			New: func(r io.Reader, options Options) (Source, io.Closer, error) {
+				source, err := NewNDJSONSource(r)
+				return source, nil, err
+			},
+		},
+		{
+			Name:         "xlsx",
+			Extensions:   []string{".xlsx"},
+			MIMETypes:    []string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+			Options:      map[string]string{"sheet": "Name of the sheet to read (default: the active sheet)"},
+			Magic:        func(head []byte) bool { return bytes.HasPrefix(head, []byte("PK\x03\x04")) },
+			RandomAccess: true,
+			New: func(r io.Reader, options Options) (Source, io.Closer, error) {
+				xlsxFile, err := excelize.OpenReader(r)
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to open XLSX file: %w", err)
+				}
+				var source *XLSXSource
+				if sheet, ok := options["sheet"]; ok {
+					source, err = NewXLSXSheetSource(xlsxFile, sheet)
+				} else {
+					source, err = NewXLSXSource(xlsxFile)
+				}
+				if err != nil {
+					xlsxFile.Close()
+					return nil, nil, err
+				}
+				return source, xlsxFile, nil
+			},
+		},
+		{
+			Name:         "parquet",
+			Extensions:   []string{".parquet"},
+			MIMETypes:    []string{"application/vnd.apache.parquet", "application/x-parquet"},
+			Magic:        func(head []byte) bool { return bytes.HasPrefix(head, []byte("PAR1")) },
+			RandomAccess: true,
+			New: func(r io.Reader, options Options) (Source, io.Closer, error) {
+				file := r.(File)
+				source, err := NewParquetSource(file, file.Size())
+				return source, nil, err
+			},
+		},
+	}
+}
+
+// Register adds an input format, making it available wherever files are read. Its name
+// and extensions must not already be taken by another format.
+func Register(f Format) error {
+	if f.Name == "" || f.New == nil {
+		return fmt.Errorf("a format needs a name and a New function")
+	}
+
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	for _, existing := range formats {
+		if strings.EqualFold(existing.Name, f.Name) {
+			return fmt.Errorf("format %s is already registered", f.Name)
+		}
+		for _, ext := range f.Extensions {
+			if slices.Contains(existing.Extensions, strings.ToLower(ext)) {
+				return fmt.Errorf("extension %s is already registered by format %s", ext, existing.Name)
+			}
+		}
+	}
+
+	f.Extensions = slices.Clone(f.Extensions)
+	for i, ext := range f.Extensions {
+		f.Extensions[i] = strings.ToLower(ext)
+	}
+	formats = append(formats, f)
+	return nil
+}
+
+// Lookup returns the input format with the given name (case-insensitive).
+func Lookup(name string) (Format, error) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for _, f := range formats {
+		if strings.EqualFold(f.Name, name) {
+			return f, nil
+		}
+	}
+	return Format{}, fmt.Errorf("unsupported input format: %s", name)
+}
+
+// ForPath returns the input format matching the extension of a file path (case-insensitive).
+func ForPath(path string) (Format, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for _, f := range formats {
+		if slices.Contains(f.Extensions, ext) {
+			return f, nil
+		}
+	}
+	return Format{}, fmt.Errorf("unsupported file type: %s", ext)
+}
+
+// ForMIMEType returns the input format of a content type such as "text/csv; charset=utf-8"
+func ForMIMEType(contentType string) (Format, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return Format{}, false
+	}
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for _, f := range formats {
+		if slices.Contains(f.MIMETypes, mediaType) {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// ForContent returns the first format, in registration order, whose magic recognizes
+// the leading bytes of a file. Built-in formats come first.
+func ForContent(head []byte) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for _, f := range formats {
+		if f.Magic != nil && f.Magic(head) {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// Detect returns the format of a file from the extension of its name, or, if it has no
+// extension or one no format is registered for (e.g. export.txt), from head, the first
+// SniffSize bytes of the file.
+func Detect(name string, head []byte) (Format, error) {
+	if f, err := ForPath(name); err == nil {
+		return f, nil
+	}
+	if f, ok := ForContent(head); ok {
+		return f, nil
+	}
+	if ext := filepath.Ext(name); ext != "" {
+		return Format{}, fmt.Errorf("unsupported file type %s, and the content isn't of a known format", strings.ToLower(ext))
+	}
+	return Format{}, fmt.Errorf("no file extension, and the content isn't of a known format")
+}
+
+// DetectFile is Detect for a file on disk, which is only read if its extension isn't
+// enough
+func DetectFile(path string) (Format, error) {
+	if f, err := ForPath(path); err == nil {
+		return f, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return Format{}, err
+	}
+	defer file.Close()
+
+	head := make([]byte, SniffSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return Format{}, err
+	}
+	return Detect(path, head[:n])
+}
+
+// Formats returns every registered input format, in registration order.
+func Formats() []Format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	return slices.Clone(formats)
+}
+
+// Extensions returns the extensions of every registered input format, sorted.
+func Extensions() []string {
+	var extensions []string
+	for _, f := range Formats() {
+		extensions = append(extensions, f.Extensions...)
+	}
+	sort.Strings(extensions)
+	return extensions
+}
+
+// ParseOptions parses options written as name=value. Every option must be accepted by
+// at least one registered format.
+func ParseOptions(values []string) (Options, error) {
+	options := make(Options)
+	for _, value := range values {
+		name, v, ok := strings.Cut(value, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid option %q, expected name=value", value)
+		}
+		accepted := false
+		for _, f := range Formats() {
+			if _, ok := f.Options[name]; ok {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return nil, fmt.Errorf("unknown option %s", name)
+		}
+		options[name] = v
+	}
+	return options, nil
+}
+
+// For returns the options the format accepts
+func (o Options) For(f Format) Options {
+	accepted := make(Options)
+	for name, value := range o {
+		if _, ok := f.Options[name]; ok {
+			accepted[name] = value
+		}
+	}
+	return accepted
+}
+
+// String renders the options as name=value pairs sorted by name, e.g. for a cache key
+func (o Options) String() string {
+	pairs := make([]string, 0, len(o))
+	for name, value := range o {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Open opens a file with the format detected by DetectFile. The io.Closer must be
+// closed once the source has been read; if Open fails, everything is closed already.
+func Open(path string, options Options) (Source, io.Closer, error) {
+	f, err := DetectFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f.Open(path, options)
+}
+
+// Open opens a file of the format, see the Open function
+func (f Format) Open(path string, options Options) (Source, io.Closer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var r io.Reader = file
+	if f.RandomAccess {
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		r = io.NewSectionReader(file, 0, info.Size())
+	}
+
+	source, closer, err := f.New(r, options.For(f))
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return source, closers{closer, file}, nil
+}
+
+// Read reads a stream of the format, such as an upload; a RandomAccess format is read
+// into memory first. The io.Closer, if not nil, must be closed once the source has
+// been read.
+func (f Format) Read(r io.Reader, options Options) (Source, io.Closer, error) {
+	if f.RandomAccess {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s file: %w", f.Name, err)
+		}
+		r = bytes.NewReader(data)
+	}
+	return f.New(r, options.For(f))
+}
+
+// closers closes each of its non-nil closers in order, returning the first error
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var first error
+	for _, closer := range c {
+		if closer == nil {
+			continue
+		}
+		if err := closer.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Closers returns an io.Closer closing each of the non-nil closers in order
+func Closers(c ...io.Closer) io.Closer {
+	return closers(c)
+}
+
+// parseDelimiter reads the delimiter option of delimited formats
+func parseDelimiter(value string) (rune, error) {
+	switch strings.ToLower(value) {
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if size == 0 || size != len(value) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return 0, fmt.Errorf("invalid delimiter %q, expected a single character", value)
+	}
+	return r, nil
+}
+
+// sniffDelimiter finds the field separator of delimited text: the separator found the
+// same number of times, outside quotes, on each of the first lines, and the most times
+// if several are. Lines cut off at the end of head are left out.
+func sniffDelimiter(head []byte) (rune, bool) {
+	if len(head) == SniffSize {
+		if end := bytes.LastIndexByte(head, '\n'); end != -1 {
+			head = head[:end+1]
+		}
+	}
+
+	// Count each separator on each record of up to 20 lines, quoted fields spanning lines
+	const maxRecords = 20
+	var counts [][]int
+	record := make([]int, len(sniffDelimiters))
+	empty, inQuotes := true, false
+scan:
+	for _, b := range head {
+		switch {
+		case b == '"':
+			inQuotes = !inQuotes
+		case b == '\n' && !inQuotes:
+			if !empty {
+				counts = append(counts, record)
+			}
+			record, empty = make([]int, len(sniffDelimiters)), true
+			if len(counts) == maxRecords {
+				break scan // The next record would be cut off
+			}
+			continue
+		case !inQuotes:
+			if i := bytes.IndexByte(sniffDelimiters, b); i != -1 {
+				record[i]++
+			}
+		}
+		if b != '\r' {
+			empty = false
+		}
+	}
+	if !empty && !inQuotes {
+		counts = append(counts, record)
+	}
+	if len(counts) == 0 {
+		return 0, false
+	}
+
+	best, bestCount := -1, 0
+	for i := range sniffDelimiters {
+		count := counts[0][i]
+		for _, record := range counts[1:] {
+			if record[i] != count {
+				count = 0
+				break
+			}
+		}
+		if count > bestCount {
+			best, bestCount = i, count
+		}
+	}
+	if best == -1 {
+		return 0, false
+	}
+	return rune(sniffDelimiters[best]), true
+}
+
+// firstByte returns the first byte of head after whitespace and a UTF-8 byte order mark
+func firstByte(head []byte) byte {
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(head) == 0 {
+		return 0
+	}
+	return head[0]
+}
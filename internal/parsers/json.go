@@ -61,7 +61,7 @@ func (s *JSONSource) GetHeaders() ([]string, error) {
 
 // Read streams rows from the JSON array.
 func (s *JSONSource) Read() (chan []interface{}, error) {
-	out := make(chan []interface{})
+	out := make(chan []interface{}, readAhead)
 
 	go func() {
 		defer close(out)
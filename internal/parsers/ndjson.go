@@ -0,0 +1,82 @@
+package parsers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// NDJSONSource implements the Source interface for newline-delimited JSON files,
+// with one object per line.
+type NDJSONSource struct {
+	decoder  *json.Decoder
+	headers  []string
+	firstRow []interface{}
+}
+
+// NewNDJSONSource creates a new NDJSONSource from an io.Reader.
+// The columns are the keys of the first object, sorted for stability.
+func NewNDJSONSource(r io.Reader) (*NDJSONSource, error) {
+	dec := json.NewDecoder(r)
+
+	var firstObj map[string]interface{}
+	if err := dec.Decode(&firstObj); err != nil {
+		if err == io.EOF {
+			return &NDJSONSource{decoder: dec, headers: []string{}}, nil
+		}
+		return nil, fmt.Errorf("failed to decode first JSON object: %w", err)
+	}
+
+	var headers []string
+	for k := range firstObj {
+		headers = append(headers, k)
+	}
+	sort.Strings(headers)
+
+	row := make([]interface{}, len(headers))
+	for i, header := range headers {
+		row[i] = firstObj[header]
+	}
+
+	return &NDJSONSource{
+		decoder:  dec,
+		headers:  headers,
+		firstRow: row,
+	}, nil
+}
+
+// GetHeaders returns the inferred column names.
+func (s *NDJSONSource) GetHeaders() ([]string, error) {
+	return s.headers, nil
+}
+
+// Read streams one row per JSON object.
+func (s *NDJSONSource) Read() (chan []interface{}, error) {
+	out := make(chan []interface{}, readAhead)
+
+	go func() {
+		defer close(out)
+
+		if s.firstRow != nil {
+			out <- s.firstRow
+			s.firstRow = nil
+		}
+
+		for {
+			var obj map[string]interface{}
+			if err := s.decoder.Decode(&obj); err != nil {
+				// EOF, or a malformed line we can't resynchronize after
+				break
+			}
+
+			row := make([]interface{}, len(s.headers))
+			for i, header := range s.headers {
+				row[i] = obj[header]
+			}
+			out <- row
+		}
+	}()
+
+	return out, nil
+}
@@ -0,0 +1,113 @@
+package parsers
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// parquetBatchSize is the number of rows decoded from a Parquet file at a time
+const parquetBatchSize = 256
+
+// ParquetSource implements the Source interface for Parquet files.
+// Only flat schemas are supported: every top-level field must be a non-repeated column.
+type ParquetSource struct {
+	file    *parquet.File
+	headers []string
+	fields  []parquet.Field
+}
+
+// NewParquetSource creates a new ParquetSource from a random-access reader.
+// Parquet keeps its metadata at the end of the file, so it can't be read from a stream.
+func NewParquetSource(r io.ReaderAt, size int64) (*ParquetSource, error) {
+	file, err := parquet.OpenFile(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Parquet file: %w", err)
+	}
+
+	fields := file.Schema().Fields()
+	headers := make([]string, len(fields))
+	for i, field := range fields {
+		if !field.Leaf() || field.Repeated() {
+			return nil, fmt.Errorf("column %s is nested or repeated, only flat Parquet schemas are supported", field.Name())
+		}
+		headers[i] = field.Name()
+	}
+
+	return &ParquetSource{file: file, headers: headers, fields: fields}, nil
+}
+
+// GetHeaders returns the column names.
+func (s *ParquetSource) GetHeaders() ([]string, error) {
+	return s.headers, nil
+}
+
+// Read streams rows from every row group of the file.
+func (s *ParquetSource) Read() (chan []interface{}, error) {
+	out := make(chan []interface{}, readAhead)
+
+	go func() {
+		defer close(out)
+
+		reader := parquet.NewReader(s.file)
+		defer reader.Close()
+
+		buf := make([]parquet.Row, parquetBatchSize)
+		for {
+			n, err := reader.ReadRows(buf)
+			for _, values := range buf[:n] {
+				row := make([]interface{}, len(s.headers))
+				for _, v := range values {
+					if col := v.Column(); col >= 0 && col < len(row) {
+						row[col] = parquetValue(v, s.fields[col].Type())
+					}
+				}
+				out <- row
+			}
+			if err != nil {
+				// io.EOF at the end of the file; stop on any other error too
+				break
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// parquetValue converts a Parquet value to the Go type used by the other sources
+func parquetValue(v parquet.Value, typ parquet.Type) interface{} {
+	if v.IsNull() {
+		return nil
+	}
+
+	var logical format.LogicalTypeValue
+	if lt := typ.LogicalType(); lt != nil {
+		logical = lt.Value
+	}
+
+	switch v.Kind() {
+	case parquet.Boolean:
+		return v.Boolean()
+	case parquet.Int32:
+		if _, ok := logical.(*format.DateType); ok {
+			return time.Unix(int64(v.Int32())*86400, 0).UTC().Format(time.DateOnly)
+		}
+		return int64(v.Int32())
+	case parquet.Int64:
+		if ts, ok := logical.(*format.TimestampType); ok && ts.Unit.Value != nil {
+			return time.Unix(0, 0).Add(time.Duration(v.Int64()) * ts.Unit.Value.Duration()).UTC().Format(time.RFC3339Nano)
+		}
+		return v.Int64()
+	case parquet.Float:
+		return float64(v.Float())
+	case parquet.Double:
+		return v.Double()
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return string(v.ByteArray())
+	default:
+		return v.String()
+	}
+}
@@ -11,3 +11,18 @@ type Source interface {
 	// The channel is closed when reading is complete or an error occurs.
 	Read() (chan []interface{}, error)
 }
+
+// TypedSource is a Source that knows the types of some of its columns, which are then
+// not inferred from its first rows.
+type TypedSource interface {
+	Source
+
+	// ColumnTypes returns the SQLite type of each column, "INTEGER", "REAL" or "TEXT",
+	// or "" for a column whose type is inferred.
+	ColumnTypes() []string
+}
+
+// readAhead is the number of rows a source parses ahead of its consumer. Buffering lets
+// parsing continue while the consumer writes a batch, instead of handing over one row
+// at a time.
+const readAhead = 1024
@@ -1,9 +1,18 @@
 package parsers
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/parquet-go/parquet-go"
 	"github.com/xuri/excelize/v2"
 )
 
@@ -43,6 +52,49 @@ func TestCSVSource(t *testing.T) {
 	}
 }
 
+// failingReader returns an error instead of io.EOF, like a connection that drops
+type failingReader struct {
+	r io.Reader
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestCSVSourceStopsOnReadError(t *testing.T) {
+	src, err := NewCSVSource(&failingReader{r: strings.NewReader("id\n1\n2\n")})
+	if err != nil {
+		t.Fatalf("NewCSVSource failed: %v", err)
+	}
+
+	ch, err := src.Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	done := make(chan int)
+	go func() {
+		rowCount := 0
+		for range ch {
+			rowCount++
+		}
+		done <- rowCount
+	}()
+
+	select {
+	case rowCount := <-done:
+		if rowCount != 2 {
+			t.Errorf("Expected 2 rows, got %d", rowCount)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CSV source kept reading after the reader failed")
+	}
+}
+
 func TestJSONSource(t *testing.T) {
 	data := `[
 		{"id": 1, "name": "Apple"},
@@ -81,6 +133,78 @@ func TestJSONSource(t *testing.T) {
 	}
 }
 
+func TestNDJSONSource(t *testing.T) {
+	data := `{"name": "Apple", "id": 1}
+
+{"id": 2, "name": "Banana", "extra": true}
+`
+	src, err := NewNDJSONSource(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewNDJSONSource failed: %v", err)
+	}
+
+	headers, _ := src.GetHeaders()
+	if len(headers) != 2 || headers[0] != "id" || headers[1] != "name" {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+
+	ch, err := src.Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	var rows [][]interface{}
+	for row := range ch {
+		rows = append(rows, row)
+	}
+	if len(rows) != 2 || rows[1][1] != "Banana" {
+		t.Errorf("Unexpected rows: %v", rows)
+	}
+}
+
+func TestParquetSource(t *testing.T) {
+	type record struct {
+		ID    int64    `parquet:"id"`
+		Name  string   `parquet:"name"`
+		Score *float64 `parquet:"score,optional"`
+	}
+	score := 1.5
+
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, []record{{1, "Apple", &score}, {2, "Banana", nil}}); err != nil {
+		t.Fatalf("Failed to write Parquet file: %v", err)
+	}
+
+	src, err := NewParquetSource(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("NewParquetSource failed: %v", err)
+	}
+
+	headers, _ := src.GetHeaders()
+	if len(headers) != 3 || headers[0] != "id" || headers[1] != "name" || headers[2] != "score" {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+
+	ch, err := src.Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	var rows [][]interface{}
+	for row := range ch {
+		rows = append(rows, row)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+	if rows[0][0] != int64(1) || rows[0][1] != "Apple" || rows[0][2] != 1.5 {
+		t.Errorf("Unexpected first row: %v", rows[0])
+	}
+	if rows[1][2] != nil {
+		t.Errorf("Expected NULL score, got %v", rows[1][2])
+	}
+}
+
 func TestXLSXSource(t *testing.T) {
 	f := excelize.NewFile()
 	// Sheet1 is created by default. Get its index.
@@ -127,3 +251,254 @@ func TestXLSXSource(t *testing.T) {
 		t.Errorf("Expected 2 rows, got %d", rowCount)
 	}
 }
+
+func TestUnionSource(t *testing.T) {
+	jan, _ := NewCSVSource(strings.NewReader("id,name\n1,Apple\n2,Banana"))
+	feb, _ := NewCSVSource(strings.NewReader("name,id,color,color\nCherry,3,red,dark red"))
+	src, err := NewUnionSource([]string{"jan.csv", "feb.csv"}, []Source{jan, feb})
+	if err != nil {
+		t.Fatalf("NewUnionSource failed: %v", err)
+	}
+
+	headers, _ := src.GetHeaders()
+	if strings.Join(headers, ",") != "id,name,color,color,_source_file" {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+
+	ch, err := src.Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	var rows []string
+	for row := range ch {
+		rows = append(rows, fmt.Sprint(row))
+	}
+	want := []string{
+		"[1 Apple <nil> <nil> jan.csv]",
+		"[2 Banana <nil> <nil> jan.csv]",
+		"[3 Cherry red dark red feb.csv]",
+	}
+	if strings.Join(rows, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected rows:\n%s", strings.Join(rows, "\n"))
+	}
+}
+
+func TestPartitionedSource(t *testing.T) {
+	a, _ := NewCSVSource(strings.NewReader("id,year\n1,1999"))
+	b, _ := NewCSVSource(strings.NewReader("id\n2"))
+	values := [][]interface{}{{int64(2024), "eu"}, {int64(2025), nil}}
+	src, err := NewPartitionedSource([]string{"a.csv", "b.csv"}, []Source{a, b}, []string{"year", "region"}, values)
+	if err != nil {
+		t.Fatalf("NewPartitionedSource failed: %v", err)
+	}
+
+	// The year of the path takes the place of the year column of the file
+	headers, _ := src.GetHeaders()
+	if strings.Join(headers, ",") != "id,year,region,_source_file" {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+	ch, _ := src.Read()
+	var rows []string
+	for row := range ch {
+		rows = append(rows, fmt.Sprint(row))
+	}
+	if got := strings.Join(rows, " "); got != "[1 2024 eu a.csv] [2 2025 <nil> b.csv]" {
+		t.Errorf("Unexpected rows: %s", got)
+	}
+	if got := strings.Join(src.ColumnTypes(), ","); got != ",INTEGER,TEXT,TEXT" {
+		t.Errorf("Unexpected column types: %s", got)
+	}
+}
+
+func TestFormatRegistry(t *testing.T) {
+	for path, want := range map[string]string{"a.CSV": "csv", "b.jsonl": "ndjson", "dir/c.parquet": "parquet"} {
+		if f, err := ForPath(path); err != nil || f.Name != want {
+			t.Errorf("ForPath(%s) = %s, %v; want %s", path, f.Name, err, want)
+		}
+	}
+	if _, err := ForPath("notes.txt"); err == nil {
+		t.Error("Expected an error for an unsupported extension")
+	}
+	if f, ok := ForMIMEType("text/csv; charset=utf-8"); !ok || f.Name != "csv" {
+		t.Errorf("ForMIMEType(text/csv) = %s, %v", f.Name, ok)
+	}
+	for head, want := range map[string]string{"\xef\xbb\xbf [{\"a\": 1}]": "json", "{\"a\": 1}\n": "ndjson", "PK\x03\x04": "xlsx", "PAR1": "parquet"} {
+		if f, ok := ForContent([]byte(head)); !ok || f.Name != want {
+			t.Errorf("ForContent(%q) = %s, %v; want %s", head, f.Name, ok, want)
+		}
+	}
+
+	// A registered format is found like the built-in ones. It is unregistered afterwards,
+	// so that other tests see the built-in formats only.
+	builtin := Formats()
+	t.Cleanup(func() {
+		formatsMu.Lock()
+		formats = builtin
+		formatsMu.Unlock()
+	})
+	err := Register(Format{
+		Name:       "psv",
+		Extensions: []string{".PSV"},
+		New: func(r io.Reader, options Options) (Source, io.Closer, error) {
+			source, err := NewDelimitedSource(r, '|')
+			return source, nil, err
+		},
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := Register(Format{Name: "pipes", Extensions: []string{".psv"}, New: Formats()[0].New}); err == nil {
+		t.Error("Expected an error registering a taken extension")
+	}
+	path := filepath.Join(t.TempDir(), "data.psv")
+	if err := os.WriteFile(path, []byte("id|name\n1|Apple\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	source, closer, err := Open(path, nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer closer.Close()
+	if headers, _ := source.GetHeaders(); len(headers) != 2 || headers[1] != "name" {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+	if !slices.Contains(Extensions(), ".psv") {
+		t.Errorf("Expected .psv in %v", Extensions())
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	if _, err := ParseOptions([]string{"delimitr=;"}); err == nil {
+		t.Error("Expected an error for an unknown option")
+	}
+	options, err := ParseOptions([]string{"delimiter=;", "sheet=Data"})
+	if err != nil {
+		t.Fatalf("ParseOptions failed: %v", err)
+	}
+
+	csvFormat, _ := Lookup("csv")
+	if got := options.For(csvFormat).String(); got != "delimiter=;" {
+		t.Errorf("Expected only the CSV options, got %s", got)
+	}
+	source, _, err := csvFormat.Read(strings.NewReader("id;name\n1;Apple\n"), options)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if headers, _ := source.GetHeaders(); len(headers) != 2 {
+		t.Errorf("Expected the delimiter option to split the headers, got %v", headers)
+	}
+	if _, _, err := csvFormat.Read(strings.NewReader("a\n"), Options{"delimiter": ";;"}); err == nil {
+		t.Error("Expected an error for a delimiter of two characters")
+	}
+
+	// The sheet option picks a sheet other than the active one
+	f := excelize.NewFile()
+	f.NewSheet("Data")
+	f.SetCellValue("Data", "A1", "sku")
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	xlsxFormat, _ := Lookup("XLSX")
+	source, closer, err := xlsxFormat.Read(bytes.NewReader(buf.Bytes()), options)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	defer closer.Close()
+	if headers, _ := source.GetHeaders(); len(headers) != 1 || headers[0] != "sku" {
+		t.Errorf("Expected the headers of sheet Data, got %v", headers)
+	}
+	if _, _, err := xlsxFormat.Read(bytes.NewReader(buf.Bytes()), Options{"sheet": "Missing"}); err == nil {
+		t.Error("Expected an error for a missing sheet")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name, head string
+		want       string // Format name, or "" for an error
+	}{
+		{"sales.csv", `[{"a": 1}]`, "csv"}, // A known extension wins
+		{"export.txt", "id,name\n1,Apple\n2,\"Banana, ripe\"\n", "csv"},
+		{"export", "id;name;price\n1;Apple;0,5\n", "csv"},
+		{"report.dat", "\n  [{\"id\": 1}]", "json"},
+		{"events.log", "{\"id\": 1}\n{\"id\": 2}\n", "ndjson"},
+		{"book.bin", "PK\x03\x04\x14\x00", "xlsx"},
+		{"data", "PAR1\x15\x00", "parquet"},
+		{"notes.txt", "just some words\n", ""},
+		{"ragged.txt", "a,b\n1\n", ""},
+	}
+	for _, tt := range tests {
+		f, err := Detect(tt.name, []byte(tt.head))
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("Detect(%s) = %s, expected an error", tt.name, f.Name)
+		case tt.want != "" && (err != nil || f.Name != tt.want):
+			t.Errorf("Detect(%s) = %s, %v; want %s", tt.name, f.Name, err, tt.want)
+		}
+	}
+
+	delimiters := map[string]rune{
+		"a,b,c\n1,2,3\n":            ',',
+		"a;b\n\"x;y\";2\n":          ';',
+		"a\tb\tc\r\n1\t2\t3\r\n":    '\t',
+		"a|b\n1|2\n":                '|',
+		"a,b;c\n1,2;3\n4,5;6\n":     ',', // Tied, the comma is preferred
+		"a;b;c,d\n1;2;3,4\n5;6;7\n": ';',
+	}
+	for head, want := range delimiters {
+		if got, ok := sniffDelimiter([]byte(head)); !ok || got != want {
+			t.Errorf("sniffDelimiter(%q) = %q, %v; want %q", head, got, ok, want)
+		}
+	}
+
+	// Longer inputs are judged on their first records
+	long := func(lines int) string {
+		var sb strings.Builder
+		sb.WriteString("id;name\n")
+		for i := 1; i < lines; i++ {
+			fmt.Fprintf(&sb, "%d;item %d\n", i, i)
+		}
+		return sb.String()
+	}
+	for _, lines := range []int{20, 21, 22, 51, 5000} {
+		if got, ok := sniffDelimiter([]byte(long(lines))); !ok || got != ';' {
+			t.Errorf("sniffDelimiter of %d lines = %q, %v; want ';'", lines, got, ok)
+		}
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"export", "export.csv"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(long(51)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if f, err := DetectFile(path); err != nil || f.Name != "csv" {
+			t.Errorf("DetectFile(%s) = %s, %v; want csv", name, f.Name, err)
+			continue
+		}
+		source, closer, err := Open(path, nil)
+		if err != nil {
+			t.Fatalf("Open(%s) failed: %v", name, err)
+		}
+		headers, _ := source.GetHeaders()
+		closer.Close()
+		if len(headers) != 2 || headers[1] != "name" {
+			t.Errorf("%s: unexpected headers %v", name, headers)
+		}
+	}
+
+	// A CSV file read without a delimiter option uses the one it was detected with
+	path := filepath.Join(t.TempDir(), "export.txt")
+	if err := os.WriteFile(path, []byte("id;name\n1;Apple\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	source, closer, err := Open(path, nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer closer.Close()
+	if headers, _ := source.GetHeaders(); len(headers) != 2 || headers[1] != "name" {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+}
@@ -0,0 +1,149 @@
+package parsers
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// SourceFileColumn is the column UnionSource adds with the name of the file of each row
+const SourceFileColumn = "_source_file"
+
+// UnionSource reads several sources one after the other as a single source. Columns are
+// matched by name, in the order they first appear; a column missing from a source is NULL
+// in its rows. Partition columns, if any, come next, and a last column, SourceFileColumn,
+// holds the name of the source of each row.
+type UnionSource struct {
+	names      []string
+	sources    []Source
+	headers    []string
+	columns    [][]int         // For each source, the union column of each of its columns
+	partitions []int           // Union column of each partition key
+	values     [][]interface{} // For each source, the values of its partition keys
+}
+
+// NewUnionSource creates a UnionSource reading the given sources, named by names
+func NewUnionSource(names []string, sources []Source) (*UnionSource, error) {
+	return NewPartitionedSource(names, sources, nil, nil)
+}
+
+// NewPartitionedSource creates a UnionSource whose sources are the partitions of a
+// dataset, with a column for each partition key holding the values of the partition
+// of each row, one value per key for each source. A partition key that is also a column
+// of the files takes the place of that column.
+func NewPartitionedSource(names []string, sources []Source, keys []string, values [][]interface{}) (*UnionSource, error) {
+	if len(names) != len(sources) {
+		return nil, fmt.Errorf("got %d names for %d sources", len(names), len(sources))
+	}
+	if keys != nil && len(values) != len(sources) {
+		return nil, fmt.Errorf("got partition values for %d of %d sources", len(values), len(sources))
+	}
+
+	u := &UnionSource{names: names, sources: sources, columns: make([][]int, len(sources)), values: values}
+	index := make(map[string]int)
+	for i, source := range sources {
+		headers, err := source.GetHeaders()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", names[i], err)
+		}
+
+		// A name repeated within a source matches its repetitions in the other sources
+		seen := make(map[string]int)
+		u.columns[i] = make([]int, len(headers))
+		for j, h := range headers {
+			key := h + "\x00" + strconv.Itoa(seen[h])
+			seen[h]++
+			column, ok := index[key]
+			if !ok {
+				column = len(u.headers)
+				index[key] = column
+				u.headers = append(u.headers, h)
+			}
+			u.columns[i][j] = column
+		}
+	}
+	for _, key := range keys {
+		column, ok := index[key+"\x000"]
+		if !ok {
+			column = len(u.headers)
+			u.headers = append(u.headers, key)
+		}
+		u.partitions = append(u.partitions, column)
+	}
+	u.headers = append(u.headers, SourceFileColumn)
+
+	return u, nil
+}
+
+// GetHeaders returns the columns of all sources followed by the partition keys and
+// SourceFileColumn.
+func (u *UnionSource) GetHeaders() ([]string, error) {
+	return u.headers, nil
+}
+
+// ColumnTypes returns the types of the partition columns, chosen from the values of the
+// partitions rather than the rows of the first ones, and TEXT for SourceFileColumn. The
+// types of the columns of the sources are inferred.
+func (u *UnionSource) ColumnTypes() []string {
+	types := make([]string, len(u.headers))
+	for k, column := range u.partitions {
+		for _, values := range u.values {
+			switch values[k].(type) {
+			case string:
+				types[column] = "TEXT"
+			case float64:
+				if types[column] != "TEXT" {
+					types[column] = "REAL"
+				}
+			case int64:
+				if types[column] == "" {
+					types[column] = "INTEGER"
+				}
+			}
+		}
+	}
+	types[len(types)-1] = "TEXT"
+	return types
+}
+
+// Read streams the rows of every source in turn. All sources start reading at once, so
+// that an error starting any of them is reported before the first row.
+func (u *UnionSource) Read() (chan []interface{}, error) {
+	channels := make([]chan []interface{}, len(u.sources))
+	for i, source := range u.sources {
+		ch, err := source.Read()
+		if err != nil {
+			// Let the sources already started finish
+			for _, started := range channels[:i] {
+				go func() {
+					for range started {
+					}
+				}()
+			}
+			return nil, fmt.Errorf("%s: %w", u.names[i], err)
+		}
+		channels[i] = ch
+	}
+
+	out := make(chan []interface{}, readAhead)
+	go func() {
+		defer close(out)
+		width := len(u.headers)
+		for i, ch := range channels {
+			for row := range ch {
+				union := make([]interface{}, width)
+				for j, v := range row {
+					if j < len(u.columns[i]) {
+						union[u.columns[i][j]] = v
+					}
+				}
+				for k, column := range u.partitions {
+					union[column] = u.values[i][k]
+				}
+				union[width-1] = u.names[i]
+				out <- union
+			}
+		}
+	}()
+
+	return out, nil
+}
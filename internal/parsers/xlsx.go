@@ -2,6 +2,7 @@ package parsers
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/xuri/excelize/v2"
 )
@@ -15,9 +16,14 @@ type XLSXSource struct {
 // NewXLSXSource creates a new XLSXSource from an excelize.File.
 // It uses the active sheet.
 func NewXLSXSource(f *excelize.File) (*XLSXSource, error) {
-	// Get active sheet name
-	sheetIndex := f.GetActiveSheetIndex()
-	sheetName := f.GetSheetName(sheetIndex)
+	return NewXLSXSheetSource(f, f.GetSheetName(f.GetActiveSheetIndex()))
+}
+
+// NewXLSXSheetSource creates a new XLSXSource reading the named sheet of an excelize.File.
+func NewXLSXSheetSource(f *excelize.File, sheetName string) (*XLSXSource, error) {
+	if index, err := f.GetSheetIndex(sheetName); err != nil || index == -1 {
+		return nil, fmt.Errorf("no sheet named %s, the sheets are %s", sheetName, strings.Join(f.GetSheetList(), ", "))
+	}
 
 	// Get rows iterator
 	rows, err := f.Rows(sheetName)
@@ -47,7 +53,7 @@ func (s *XLSXSource) GetHeaders() ([]string, error) {
 
 // Read streams rows from the Excel sheet.
 func (s *XLSXSource) Read() (chan []interface{}, error) {
-	out := make(chan []interface{})
+	out := make(chan []interface{}, readAhead)
 
 	go func() {
 		defer close(out)
@@ -0,0 +1,36 @@
+package writers
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// CSVWriter implements the Writer interface for CSV output.
+type CSVWriter struct {
+	writer *csv.Writer
+}
+
+// NewCSVWriter creates a new CSVWriter on top of an io.Writer.
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{writer: csv.NewWriter(w)}
+}
+
+// WriteHeader writes the header record.
+func (w *CSVWriter) WriteHeader(columns []string) error {
+	return w.writer.Write(columns)
+}
+
+// WriteRow writes a record, rendering NULL as an empty field.
+func (w *CSVWriter) WriteRow(row []interface{}) error {
+	record := make([]string, len(row))
+	for i, v := range row {
+		record[i] = formatValue(v)
+	}
+	return w.writer.Write(record)
+}
+
+// Close flushes the buffered records.
+func (w *CSVWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
@@ -0,0 +1,128 @@
+package writers
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// JSONWriter implements the Writer interface for JSON output.
+// Rows are written as an indented array of objects, keeping the column order.
+type JSONWriter struct {
+	writer  *bufio.Writer
+	columns []string
+	rows    int
+}
+
+// NewJSONWriter creates a new JSONWriter on top of an io.Writer.
+func NewJSONWriter(w io.Writer) *JSONWriter {
+	return &JSONWriter{writer: bufio.NewWriter(w)}
+}
+
+// WriteHeader records the column names used as object keys.
+func (w *JSONWriter) WriteHeader(columns []string) error {
+	w.columns = columns
+	return nil
+}
+
+// WriteRow writes a row as a JSON object.
+func (w *JSONWriter) WriteRow(row []interface{}) error {
+	if w.rows == 0 {
+		w.writer.WriteString("[\n")
+	} else {
+		w.writer.WriteString(",\n")
+	}
+	w.rows++
+
+	w.writer.WriteString("  {")
+	for i, col := range w.columns {
+		if i > 0 {
+			w.writer.WriteString(",")
+		}
+		w.writer.WriteString("\n    ")
+		if err := writeMember(w.writer, col, valueAt(row, i), ": "); err != nil {
+			return err
+		}
+	}
+	if len(w.columns) > 0 {
+		w.writer.WriteString("\n  ")
+	}
+	_, err := w.writer.WriteString("}")
+	return err
+}
+
+// Close terminates the array and flushes the output.
+func (w *JSONWriter) Close() error {
+	if w.rows == 0 {
+		w.writer.WriteString("[]\n")
+	} else {
+		w.writer.WriteString("\n]\n")
+	}
+	return w.writer.Flush()
+}
+
+// NDJSONWriter implements the Writer interface for newline-delimited JSON output.
+// Each row is written as a compact JSON object on its own line.
+type NDJSONWriter struct {
+	writer  *bufio.Writer
+	columns []string
+}
+
+// NewNDJSONWriter creates a new NDJSONWriter on top of an io.Writer.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{writer: bufio.NewWriter(w)}
+}
+
+// WriteHeader records the column names used as object keys.
+func (w *NDJSONWriter) WriteHeader(columns []string) error {
+	w.columns = columns
+	return nil
+}
+
+// WriteRow writes a row as a single-line JSON object.
+func (w *NDJSONWriter) WriteRow(row []interface{}) error {
+	w.writer.WriteString("{")
+	for i, col := range w.columns {
+		if i > 0 {
+			w.writer.WriteString(",")
+		}
+		if err := writeMember(w.writer, col, valueAt(row, i), ":"); err != nil {
+			return err
+		}
+	}
+	_, err := w.writer.WriteString("}\n")
+	return err
+}
+
+// Close flushes the output.
+func (w *NDJSONWriter) Close() error {
+	return w.writer.Flush()
+}
+
+// writeMember writes a single "key": value pair of a JSON object.
+func writeMember(w *bufio.Writer, key string, value interface{}, sep string) error {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+
+	k, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	w.Write(k)
+	w.WriteString(sep)
+	_, err = w.Write(v)
+	return err
+}
+
+func valueAt(row []interface{}, i int) interface{} {
+	if i < len(row) {
+		return row[i]
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package writers
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetSampleSize is the number of rows buffered to choose the column types
+// before the Parquet schema is fixed.
+const parquetSampleSize = 1000
+
+// ParquetWriter implements the Writer interface for Parquet output.
+// Column types are inferred from the first rows: integer, floating-point and boolean
+// columns keep their type, anything else is written as a string. Every column is optional.
+type ParquetWriter struct {
+	out     io.Writer
+	columns []string
+	sample  [][]interface{}
+
+	kinds   []reflect.Kind // Go kind of each column once the schema is fixed
+	rowType reflect.Type   // struct type with one pointer field per column
+	writer  *parquet.Writer
+}
+
+// NewParquetWriter creates a new ParquetWriter on top of an io.Writer.
+func NewParquetWriter(w io.Writer) *ParquetWriter {
+	return &ParquetWriter{out: w}
+}
+
+// WriteHeader records the column names.
+func (w *ParquetWriter) WriteHeader(columns []string) error {
+	w.columns = columns
+	return nil
+}
+
+// WriteRow buffers the row until the schema is known, then writes it.
+func (w *ParquetWriter) WriteRow(row []interface{}) error {
+	if w.writer != nil {
+		return w.write(row)
+	}
+
+	w.sample = append(w.sample, row)
+	if len(w.sample) < parquetSampleSize {
+		return nil
+	}
+	return w.flushSample()
+}
+
+// Close writes any buffered rows and the file footer.
+func (w *ParquetWriter) Close() error {
+	if w.writer == nil {
+		if err := w.flushSample(); err != nil {
+			return err
+		}
+	}
+	if err := w.writer.Close(); err != nil {
+		return fmt.Errorf("failed to write Parquet file: %w", err)
+	}
+	return nil
+}
+
+// flushSample fixes the schema from the buffered rows and writes them
+func (w *ParquetWriter) flushSample() error {
+	w.kinds = make([]reflect.Kind, len(w.columns))
+	for i := range w.columns {
+		w.kinds[i] = parquetKind(w.sample, i)
+	}
+
+	// A struct keeps the column order, unlike parquet.Group which sorts fields by name
+	fields := make([]reflect.StructField, len(w.columns))
+	for i, col := range w.columns {
+		name := strings.ReplaceAll(col, ",", "_") // a comma would end the name in the tag
+		fields[i] = reflect.StructField{
+			Name: "F" + strconv.Itoa(i),
+			Type: reflect.PointerTo(kindType(w.kinds[i])),
+			Tag:  reflect.StructTag(`parquet:` + strconv.Quote(name+",optional")),
+		}
+	}
+	w.rowType = reflect.StructOf(fields)
+	w.writer = parquet.NewWriter(w.out, parquet.SchemaOf(reflect.New(w.rowType).Interface()))
+
+	for _, row := range w.sample {
+		if err := w.write(row); err != nil {
+			return err
+		}
+	}
+	w.sample = nil
+	return nil
+}
+
+func (w *ParquetWriter) write(row []interface{}) error {
+	record := reflect.New(w.rowType)
+	for i, kind := range w.kinds {
+		value, err := parquetCell(valueAt(row, i), kind)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", w.columns[i], err)
+		}
+		if value.IsValid() {
+			ptr := reflect.New(value.Type())
+			ptr.Elem().Set(value)
+			record.Elem().Field(i).Set(ptr)
+		}
+	}
+	return w.writer.Write(record.Interface())
+}
+
+// parquetKind picks the Go kind of a column from the non-empty values of the sample.
+// Integers mixed with floats become floats; any other mix becomes a string.
+func parquetKind(rows [][]interface{}, col int) reflect.Kind {
+	kind := reflect.Invalid
+	for _, row := range rows {
+		var k reflect.Kind
+		switch v := valueAt(row, col).(type) {
+		case nil:
+			continue
+		case string:
+			if v == "" {
+				continue
+			}
+			return reflect.String
+		case int, int32, int64:
+			k = reflect.Int64
+		case float32, float64:
+			k = reflect.Float64
+		case bool:
+			k = reflect.Bool
+		default:
+			return reflect.String
+		}
+
+		switch {
+		case kind == reflect.Invalid || kind == k:
+			kind = k
+		case (kind == reflect.Int64 && k == reflect.Float64) || (kind == reflect.Float64 && k == reflect.Int64):
+			kind = reflect.Float64
+		default:
+			return reflect.String
+		}
+	}
+	if kind == reflect.Invalid {
+		return reflect.String
+	}
+	return kind
+}
+
+func kindType(kind reflect.Kind) reflect.Type {
+	switch kind {
+	case reflect.Int64:
+		return reflect.TypeFor[int64]()
+	case reflect.Float64:
+		return reflect.TypeFor[float64]()
+	case reflect.Bool:
+		return reflect.TypeFor[bool]()
+	default:
+		return reflect.TypeFor[string]()
+	}
+}
+
+// parquetCell converts a value to the type of its column. It returns the zero
+// reflect.Value for NULL; empty strings in non-string columns are NULL too.
+func parquetCell(v interface{}, kind reflect.Kind) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Value{}, nil
+	}
+	if kind == reflect.String {
+		return reflect.ValueOf(formatValue(v)), nil
+	}
+
+	switch val := v.(type) {
+	case string:
+		if val == "" {
+			return reflect.Value{}, nil
+		}
+	case []byte:
+		if len(val) == 0 {
+			return reflect.Value{}, nil
+		}
+	case int:
+		v = int64(val)
+	case int32:
+		v = int64(val)
+	case float32:
+		v = float64(val)
+	}
+
+	switch kind {
+	case reflect.Int64:
+		switch val := v.(type) {
+		case int64:
+			return reflect.ValueOf(val), nil
+		case float64:
+			if val == math.Trunc(val) && math.Abs(val) < 1<<63 {
+				return reflect.ValueOf(int64(val)), nil
+			}
+		}
+	case reflect.Float64:
+		switch val := v.(type) {
+		case int64:
+			return reflect.ValueOf(float64(val)), nil
+		case float64:
+			return reflect.ValueOf(val), nil
+		}
+	case reflect.Bool:
+		if val, ok := v.(bool); ok {
+			return reflect.ValueOf(val), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("value %q does not match the column type %s, inferred from the first %d rows", formatValue(v), kind, parquetSampleSize)
+}
@@ -0,0 +1,130 @@
+package writers
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Writer is the interface that all output formats must implement.
+// It defines how query results leave the system.
+type Writer interface {
+	// WriteHeader writes the column names. It must be called once, before any row.
+	WriteHeader(columns []string) error
+
+	// WriteRow writes a single row of values, in the same order as the columns.
+	WriteRow(row []interface{}) error
+
+	// Close flushes any buffered output. It does not close the underlying io.Writer.
+	Close() error
+}
+
+// Format describes an output format.
+type Format struct {
+	Name        string // e.g., "csv"
+	Extension   string // e.g., ".csv"
+	ContentType string // MIME type used when serving the output over HTTP
+	New         func(w io.Writer) (Writer, error)
+}
+
+var formats = map[string]Format{
+	"csv": {
+		Name:        "csv",
+		Extension:   ".csv",
+		ContentType: "text/csv; charset=utf-8",
+		New:         func(w io.Writer) (Writer, error) { return NewCSVWriter(w), nil },
+	},
+	"json": {
+		Name:        "json",
+		Extension:   ".json",
+		ContentType: "application/json; charset=utf-8",
+		New:         func(w io.Writer) (Writer, error) { return NewJSONWriter(w), nil },
+	},
+	"ndjson": {
+		Name:        "ndjson",
+		Extension:   ".ndjson",
+		ContentType: "application/x-ndjson",
+		New:         func(w io.Writer) (Writer, error) { return NewNDJSONWriter(w), nil },
+	},
+	"parquet": {
+		Name:        "parquet",
+		Extension:   ".parquet",
+		ContentType: "application/vnd.apache.parquet",
+		New:         func(w io.Writer) (Writer, error) { return NewParquetWriter(w), nil },
+	},
+	"xlsx": {
+		Name:        "xlsx",
+		Extension:   ".xlsx",
+		ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		New:         func(w io.Writer) (Writer, error) { return NewXLSXWriter(w) },
+	},
+}
+
+// Lookup returns the output format with the given name (case-insensitive).
+func Lookup(name string) (Format, error) {
+	f, ok := formats[strings.ToLower(name)]
+	if !ok {
+		return Format{}, fmt.Errorf("unsupported output format: %s", name)
+	}
+	return f, nil
+}
+
+// ForPath returns the output format matching the extension of a file path (case-insensitive).
+func ForPath(path string) (Format, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range formats {
+		if f.Extension == ext {
+			return f, nil
+		}
+	}
+	if ext == "" {
+		return Format{}, fmt.Errorf("cannot detect output format of %s: no file extension", path)
+	}
+	return Format{}, fmt.Errorf("unsupported output file type: %s", ext)
+}
+
+// New creates a Writer for the named format.
+func New(format string, w io.Writer) (Writer, error) {
+	f, err := Lookup(format)
+	if err != nil {
+		return nil, err
+	}
+	return f.New(w)
+}
+
+// Names returns the names of all supported output formats, sorted.
+func Names() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WriteAll writes the columns and every row, then closes the Writer.
+func WriteAll(wr Writer, columns []string, rows [][]interface{}) error {
+	if err := wr.WriteHeader(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := wr.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return wr.Close()
+}
+
+// formatValue renders a value as text, using an empty string for NULL.
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
@@ -0,0 +1,183 @@
+package writers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/xuri/excelize/v2"
+)
+
+var (
+	testColumns = []string{"id", "name", "score"}
+	testRows    = [][]interface{}{
+		{int64(1), "Apple", 1.5},
+		{int64(2), []byte("Banana"), nil},
+	}
+)
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteAll(NewCSVWriter(&buf), testColumns, testRows); err != nil {
+		t.Fatalf("WriteAll failed: %v", err)
+	}
+
+	expected := "id,name,score\n1,Apple,1.5\n2,Banana,\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected CSV output:\n%s", buf.String())
+	}
+}
+
+func TestJSONWriter(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteAll(NewJSONWriter(&buf), testColumns, testRows); err != nil {
+		t.Fatalf("WriteAll failed: %v", err)
+	}
+
+	var result []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if len(result) != 2 {
+		t.Fatalf("Expected 2 objects, got %d", len(result))
+	}
+	if result[1]["name"] != "Banana" || result[1]["score"] != nil {
+		t.Errorf("Unexpected second object: %v", result[1])
+	}
+
+	// Keys must keep the column order
+	if strings.Index(buf.String(), `"name"`) > strings.Index(buf.String(), `"score"`) {
+		t.Errorf("Column order not preserved:\n%s", buf.String())
+	}
+}
+
+func TestJSONWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteAll(NewJSONWriter(&buf), testColumns, nil); err != nil {
+		t.Fatalf("WriteAll failed: %v", err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("Expected empty array, got %q", buf.String())
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteAll(NewNDJSONWriter(&buf), testColumns, testRows); err != nil {
+		t.Fatalf("WriteAll failed: %v", err)
+	}
+
+	expected := `{"id":1,"name":"Apple","score":1.5}` + "\n" + `{"id":2,"name":"Banana","score":null}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected NDJSON output:\n%s", buf.String())
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	wr, err := NewXLSXWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewXLSXWriter failed: %v", err)
+	}
+	if err := WriteAll(wr, testColumns, testRows); err != nil {
+		t.Fatalf("WriteAll failed: %v", err)
+	}
+
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatalf("Output is not a valid workbook: %v", err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows(xlsxSheetName)
+	if err != nil {
+		t.Fatalf("GetRows failed: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %d", len(rows))
+	}
+	if rows[0][1] != "name" || rows[2][1] != "Banana" {
+		t.Errorf("Unexpected rows: %v", rows)
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteAll(NewParquetWriter(&buf), testColumns, testRows); err != nil {
+		t.Fatalf("WriteAll failed: %v", err)
+	}
+
+	file, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Output is not a valid Parquet file: %v", err)
+	}
+
+	fields := file.Schema().Fields()
+	if len(fields) != 3 || fields[0].Name() != "id" || fields[1].Name() != "name" || fields[2].Name() != "score" {
+		t.Fatalf("Unexpected schema: %v", file.Schema())
+	}
+	if fields[0].Type().Kind() != parquet.Int64 || fields[2].Type().Kind() != parquet.Double {
+		t.Errorf("Unexpected column types: %v", file.Schema())
+	}
+
+	rows := make([]parquet.Row, 2)
+	n, _ := parquet.NewReader(file).ReadRows(rows)
+	if n != 2 {
+		t.Fatalf("Expected 2 rows, got %d", n)
+	}
+	if string(rows[1][1].ByteArray()) != "Banana" || !rows[1][2].IsNull() {
+		t.Errorf("Unexpected second row: %v", rows[1])
+	}
+}
+
+func TestParquetWriterTypeMismatch(t *testing.T) {
+	wr := NewParquetWriter(&bytes.Buffer{})
+	wr.WriteHeader([]string{"id"})
+	wr.WriteRow([]interface{}{int64(1)})
+	wr.WriteRow([]interface{}{"not a number"})
+	if err := wr.Close(); err != nil {
+		t.Fatalf("Mixed sample should fall back to strings: %v", err)
+	}
+
+	wr = NewParquetWriter(&bytes.Buffer{})
+	wr.WriteHeader([]string{"id"})
+	for i := 0; i < parquetSampleSize; i++ {
+		wr.WriteRow([]interface{}{int64(i)})
+	}
+	if err := wr.WriteRow([]interface{}{"not a number"}); err == nil {
+		t.Error("Expected error for a value that doesn't match the inferred type")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	f, err := Lookup("XLSX")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if f.Extension != ".xlsx" {
+		t.Errorf("Expected .xlsx, got %s", f.Extension)
+	}
+
+	if _, err := Lookup("yaml"); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
+
+func TestForPath(t *testing.T) {
+	f, err := ForPath("out/Report.NDJSON")
+	if err != nil {
+		t.Fatalf("ForPath failed: %v", err)
+	}
+	if f.Name != "ndjson" {
+		t.Errorf("Expected ndjson, got %s", f.Name)
+	}
+
+	if _, err := ForPath("report.yaml"); err == nil {
+		t.Error("Expected error for unsupported extension")
+	}
+	if _, err := ForPath("report"); err == nil {
+		t.Error("Expected error for missing extension")
+	}
+}
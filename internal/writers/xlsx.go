@@ -0,0 +1,74 @@
+package writers
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const xlsxSheetName = "Sheet1"
+
+// XLSXWriter implements the Writer interface for Excel output.
+// The workbook is streamed into a single sheet and written out on Close.
+type XLSXWriter struct {
+	out    io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+}
+
+// NewXLSXWriter creates a new XLSXWriter on top of an io.Writer.
+func NewXLSXWriter(w io.Writer) (*XLSXWriter, error) {
+	f := excelize.NewFile()
+	sw, err := f.NewStreamWriter(xlsxSheetName)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to create sheet writer: %w", err)
+	}
+	return &XLSXWriter{out: w, file: f, stream: sw}, nil
+}
+
+// WriteHeader writes the column names as the first row.
+func (w *XLSXWriter) WriteHeader(columns []string) error {
+	cells := make([]interface{}, len(columns))
+	for i, col := range columns {
+		cells[i] = col
+	}
+	return w.writeCells(cells)
+}
+
+// WriteRow writes a row of values, leaving NULL cells empty.
+func (w *XLSXWriter) WriteRow(row []interface{}) error {
+	cells := make([]interface{}, len(row))
+	for i, v := range row {
+		if b, ok := v.([]byte); ok {
+			cells[i] = string(b)
+		} else {
+			cells[i] = v
+		}
+	}
+	return w.writeCells(cells)
+}
+
+// Close finishes the workbook and writes it to the underlying io.Writer.
+func (w *XLSXWriter) Close() error {
+	defer w.file.Close()
+
+	if err := w.stream.Flush(); err != nil {
+		return fmt.Errorf("failed to flush sheet: %w", err)
+	}
+	if _, err := w.file.WriteTo(w.out); err != nil {
+		return fmt.Errorf("failed to write workbook: %w", err)
+	}
+	return nil
+}
+
+func (w *XLSXWriter) writeCells(cells []interface{}) error {
+	w.row++
+	cell, err := excelize.CoordinatesToCellName(1, w.row)
+	if err != nil {
+		return err
+	}
+	return w.stream.SetRow(cell, cells)
+}
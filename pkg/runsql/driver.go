@@ -0,0 +1,529 @@
+package runsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/zulfikawr/runsql/internal/core"
+	"github.com/zulfikawr/runsql/internal/parsers"
+)
+
+// DriverName is the name of the database/sql driver registered by this package. Opening
+// a database with it queries files as tables:
+//
+//	db, err := sql.Open("runsql", "file=users.csv&file=orders.json")
+//
+// The DSN is a URL query string with these settings:
+//
+//	file=path        A file to query, repeatable; the table is named after the file
+//	file=name=path   A file to query as the given table; a path such as
+//	                 data/year=2025/part.csv is taken as a path, like with -f
+//	format=name      Input format of every file, instead of detecting it
+//	db=path          SQLite database file to load the files into; in memory if not given
+//	readonly=false   Allow statements that change the database (read-only by default,
+//	                 enforced with PRAGMA query_only, which statements can't turn off)
+//	lazy=false       Load every file when the database is opened, instead of on first
+//	                 reference by a query
+//
+// Any other setting is a parser option, such as delimiter=; or sheet=Sales. Values are
+// URL-encoded, e.g. delimiter=%3B for a semicolon.
+//
+// With lazy loading, a file is parsed the first time a query references its table, so
+// queries only pay for the files they use. Tables that haven't been referenced yet are
+// not listed in sqlite_master. Tables can't be loaded while the rows of a query are
+// open, so a query needing one then fails instead of waiting for them; a transaction
+// loads every file when it begins.
+const DriverName = "runsql"
+
+func init() {
+	sql.Register(DriverName, &sqlDriver{})
+}
+
+// sqlDriver is the database/sql driver of runsql, see DriverName
+type sqlDriver struct{}
+
+// Open opens a connection to a database of its own, closed with the connection. Use
+// sql.Open, which opens every connection of a DSN to the same database through
+// OpenConnector.
+func (d *sqlDriver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := c.Connect(context.Background())
+	if err != nil {
+		c.(*connector).Close()
+		return nil, err
+	}
+	// The database is only this connection's, so it is closed with it
+	dc.(*conn).owner = c.(*connector)
+	return dc, nil
+}
+
+// OpenConnector parses the DSN, returning a connector whose connections share one
+// database.
+func (d *sqlDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	config, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &connector{driver: d, config: config}, nil
+}
+
+// dsnConfig holds the settings of a DSN
+type dsnConfig struct {
+	files    []dsnFile
+	format   string
+	db       string
+	readOnly bool
+	lazy     bool
+	options  parsers.Options
+}
+
+// dsnFile is a file of a DSN with the table it is loaded into
+type dsnFile struct {
+	table string
+	path  string
+}
+
+// parseDSN parses a DSN, see DriverName
+func parseDSN(dsn string) (dsnConfig, error) {
+	config := dsnConfig{readOnly: true, lazy: true}
+	values, err := url.ParseQuery(dsn)
+	if err != nil {
+		return config, fmt.Errorf("invalid DSN: %w", err)
+	}
+
+	var options []string
+	for key, vs := range values {
+		last := vs[len(vs)-1]
+		switch key {
+		case "file":
+			// Added below, in order
+		case "format":
+			if _, err := parsers.Lookup(last); err != nil {
+				return config, err
+			}
+			config.format = last
+		case "db":
+			config.db = last
+		case "readonly", "lazy":
+			b, err := strconv.ParseBool(last)
+			if err != nil {
+				return config, fmt.Errorf("invalid %s setting %q, expected true or false", key, last)
+			}
+			if key == "readonly" {
+				config.readOnly = b
+			} else {
+				config.lazy = b
+			}
+		default:
+			options = append(options, key+"="+last)
+		}
+	}
+	if config.options, err = parsers.ParseOptions(options); err != nil {
+		return config, fmt.Errorf("invalid DSN: %w", err)
+	}
+
+	// Aliases are claimed first, so that other files are renamed around them
+	namer := core.NewTableNamer()
+	for _, value := range values["file"] {
+		table, path, err := core.SplitAlias(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid DSN: %w", err)
+		}
+		if table != "" && !namer.Claim(table) {
+			return config, fmt.Errorf("table %s is given to more than one file", table)
+		}
+		if path == "" {
+			return config, fmt.Errorf("no path given in file=%s", value)
+		}
+		config.files = append(config.files, dsnFile{table: table, path: path})
+	}
+	for i, f := range config.files {
+		if f.table == "" {
+			config.files[i].table = namer.Unique(core.FileTableName(f.path))
+		}
+	}
+	return config, nil
+}
+
+// connector opens the database of a DSN on first use, and hands out connections to it
+type connector struct {
+	driver *sqlDriver
+	config dsnConfig
+
+	mu     sync.Mutex
+	engine *core.Engine
+	loader *core.LazyLoader
+}
+
+// Connect opens a connection, opening the database and, unless loading is lazy,
+// loading the files first.
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	engine, loader, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+	sc, err := engine.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.readOnly {
+		if _, err := sc.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+			sc.Close()
+			return nil, err
+		}
+	}
+	return &conn{conn: sc, loader: loader, readOnly: c.config.readOnly}, nil
+}
+
+// open opens the database and registers the files with the loader, once
+func (c *connector) open() (*core.Engine, *core.LazyLoader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.engine != nil {
+		return c.engine, c.loader, nil
+	}
+
+	engine, err := openEngine(c.config.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	loader := core.NewLazyLoader(engine)
+	for _, f := range c.config.files {
+		loader.Add(f.table, c.opener(f.path))
+	}
+	if !c.config.lazy {
+		if err := loader.LoadAll(); err != nil {
+			engine.Close()
+			return nil, nil, err
+		}
+	}
+	c.engine, c.loader = engine, loader
+	return engine, loader, nil
+}
+
+// opener returns the function that opens a file of the DSN when its table is loaded
+func (c *connector) opener(path string) core.OpenFunc {
+	return func() (parsers.Source, io.Closer, error) {
+		format, err := readFormat(c.config.format, func() (parsers.Format, error) { return parsers.DetectFile(path) })
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		source, closer, err := format.Open(path, c.config.options)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return source, closer, nil
+	}
+}
+
+// Driver returns the driver of the connector.
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Close closes the database, once sql.DB.Close has closed every connection.
+func (c *connector) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.engine == nil {
+		return nil
+	}
+	err := c.engine.Close()
+	c.engine, c.loader = nil, nil
+	return err
+}
+
+// errReadOnly is returned for a statement that would make a read-only connection writable
+var errReadOnly = errors.New("runsql: the database is read-only, open it with readonly=false to change query_only")
+
+// checkReadOnly rejects the SQL if the connection is read-only and the SQL would turn
+// that off. PRAGMA query_only then rejects every other change to the database.
+func (c *conn) checkReadOnly(query string) error {
+	if c.readOnly && core.SetsPragma(query, "query_only") {
+		return errReadOnly
+	}
+	return nil
+}
+
+// conn is a connection of the driver, running statements on one connection of the
+// engine and loading the tables they reference first
+type conn struct {
+	conn     *sql.Conn
+	loader   *core.LazyLoader
+	readOnly bool
+	owner    *connector // Closed with the connection, if opened by Driver.Open
+}
+
+// QueryContext runs a query, loading the tables it references.
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.checkReadOnly(query); err != nil {
+		return nil, err
+	}
+	var rows *sql.Rows
+	err := c.loader.Do(func() (err error) {
+		c.loader.Acquire()
+		if rows, err = c.conn.QueryContext(ctx, query, namedArgs(args)...); err != nil {
+			c.loader.Release()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newRows(rows, c.loader)
+}
+
+// ExecContext runs a statement, loading the tables it references.
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.checkReadOnly(query); err != nil {
+		return nil, err
+	}
+	var result sql.Result
+	err := c.loader.Do(func() (err error) {
+		c.loader.Acquire()
+		defer c.loader.Release()
+		result, err = c.conn.ExecContext(ctx, query, namedArgs(args)...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Prepare prepares a statement, loading the tables it references.
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext prepares a statement, loading the tables it references.
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := c.checkReadOnly(query); err != nil {
+		return nil, err
+	}
+	var s *sql.Stmt
+	err := c.loader.Do(func() (err error) {
+		s, err = c.conn.PrepareContext(ctx, query)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{stmt: s, loader: c.loader}, nil
+}
+
+// Begin starts a transaction.
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx starts a transaction. Read-only connections only allow read-only transactions
+// in effect, whatever the options. Tables can't be loaded while the transaction is
+// open, so every file not loaded yet is loaded first.
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, errors.New("runsql: isolation levels are not supported")
+	}
+	if err := c.loader.LoadAll(); err != nil {
+		return nil, err
+	}
+	c.loader.Acquire()
+	if _, err := c.conn.ExecContext(ctx, "BEGIN"); err != nil {
+		c.loader.Release()
+		return nil, err
+	}
+	return &tx{conn: c.conn, loader: c.loader}, nil
+}
+
+// Close returns the connection to the engine, made writable again so that the engine
+// can load tables with it.
+func (c *conn) Close() error {
+	if c.readOnly {
+		if _, err := c.conn.ExecContext(context.Background(), "PRAGMA query_only = OFF"); err != nil {
+			// Keep a connection that is still read-only out of the engine's pool
+			c.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}
+	err := c.conn.Close()
+	if c.owner != nil {
+		if closeErr := c.owner.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// namedArgs turns driver arguments back into database/sql arguments
+func namedArgs(args []driver.NamedValue) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			values[i] = sql.Named(arg.Name, arg.Value)
+		} else {
+			values[i] = arg.Value
+		}
+	}
+	return values
+}
+
+// stmt is a prepared statement of the driver. SQLite may only report a missing table
+// when the statement first runs, so running it loads tables as well.
+type stmt struct {
+	stmt   *sql.Stmt
+	loader *core.LazyLoader
+}
+
+// NumInput returns -1, letting SQLite check the number of arguments.
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+// Exec runs the statement.
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valueArgs(args))
+}
+
+// ExecContext runs the statement.
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	var result sql.Result
+	err := s.loader.Do(func() (err error) {
+		s.loader.Acquire()
+		defer s.loader.Release()
+		result, err = s.stmt.ExecContext(ctx, namedArgs(args)...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Query runs the statement as a query.
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valueArgs(args))
+}
+
+// QueryContext runs the statement as a query.
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	var rows *sql.Rows
+	err := s.loader.Do(func() (err error) {
+		s.loader.Acquire()
+		if rows, err = s.stmt.QueryContext(ctx, namedArgs(args)...); err != nil {
+			s.loader.Release()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newRows(rows, s.loader)
+}
+
+// Close closes the statement.
+func (s *stmt) Close() error {
+	return s.stmt.Close()
+}
+
+// valueArgs turns positional driver arguments into named ones
+func valueArgs(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+// driverRows is the result of a query of the driver. It is a reader of the loader
+// until closed.
+type driverRows struct {
+	rows    *sql.Rows
+	loader  *core.LazyLoader
+	closed  bool
+	columns []string
+	values  []interface{}
+	ptrs    []interface{}
+}
+
+func newRows(rows *sql.Rows, loader *core.LazyLoader) (*driverRows, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		loader.Release()
+		return nil, err
+	}
+	r := &driverRows{
+		rows:    rows,
+		loader:  loader,
+		columns: columns,
+		values:  make([]interface{}, len(columns)),
+		ptrs:    make([]interface{}, len(columns)),
+	}
+	for i := range r.values {
+		r.ptrs[i] = &r.values[i]
+	}
+	return r, nil
+}
+
+// Columns returns the column names of the result.
+func (r *driverRows) Columns() []string {
+	return r.columns
+}
+
+// Next reads the next row into dest, returning io.EOF at the end of the result.
+func (r *driverRows) Next(dest []driver.Value) error {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	if err := r.rows.Scan(r.ptrs...); err != nil {
+		return err
+	}
+	for i, v := range r.values {
+		dest[i] = v
+	}
+	return nil
+}
+
+// Close closes the result.
+func (r *driverRows) Close() error {
+	err := r.rows.Close()
+	if !r.closed {
+		r.closed = true
+		r.loader.Release()
+	}
+	return err
+}
+
+// tx is a transaction of the driver. It is a reader of the loader until it ends.
+type tx struct {
+	conn   *sql.Conn
+	loader *core.LazyLoader
+}
+
+// Commit commits the transaction.
+func (t *tx) Commit() error {
+	return t.end("COMMIT")
+}
+
+// Rollback rolls the transaction back.
+func (t *tx) Rollback() error {
+	return t.end("ROLLBACK")
+}
+
+func (t *tx) end(statement string) error {
+	_, err := t.conn.ExecContext(context.Background(), statement)
+	t.loader.Release()
+	return err
+}
@@ -0,0 +1,248 @@
+package runsql
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/runsql/internal/core"
+)
+
+func TestDriver(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"users.csv":   "id;name;city\n1;ada;London\n2;grace;New York\n",
+		"orders.json": `[{"user_id": 1, "total": 19.5}, {"user_id": 1, "total": 7.25}, {"user_id": 2, "total": 5}]`,
+		"broken.json": `[{"a": `,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	users := filepath.Join(dir, "users.csv")
+	orders := filepath.Join(dir, "orders.json")
+	broken := filepath.Join(dir, "broken.json")
+
+	db, err := sql.Open(DriverName, "file="+users+"&file=o="+orders+"&file="+broken+"&delimiter=%3B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// The broken file is never referenced, so it is never parsed
+	var name string
+	var spent float64
+	err = db.QueryRow(`SELECT u.name, SUM(o.total) FROM users u JOIN o ON o.user_id = u.id
+		WHERE u.city = :city GROUP BY u.name`, sql.Named("city", "London")).Scan(&name, &spent)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if name != "ada" || spent != 26.75 {
+		t.Errorf("got %s %v, want ada 26.75", name, spent)
+	}
+
+	var tables []string
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if want := []string{"o", "users"}; !reflect.DeepEqual(tables, want) {
+		t.Errorf("loaded tables = %v, want %v", tables, want)
+	}
+
+	// Prepared statements load their tables too, and are reused
+	db.Close()
+	db, err = sql.Open(DriverName, "file="+users+"&delimiter=%3B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := db.Prepare("SELECT name FROM users WHERE id = ?")
+	if err != nil {
+		t.Fatalf("prepare failed: %v", err)
+	}
+	for id, want := range map[int]string{1: "ada", 2: "grace"} {
+		if err := stmt.QueryRow(id).Scan(&name); err != nil || name != want {
+			t.Errorf("id %d: got %q, %v, want %q", id, name, err, want)
+		}
+	}
+	stmt.Close()
+
+	if _, err := db.Exec("DELETE FROM users"); err == nil {
+		t.Error("expected a read-only database to reject DELETE")
+	}
+	// Read-only can't be turned off by the statements themselves
+	for _, query := range []string{
+		"PRAGMA query_only = 0",
+		"SELECT 1; /* off */ pragma MAIN.Query_Only(false)",
+	} {
+		if _, err := db.Exec(query); err != errReadOnly {
+			t.Errorf("%s: expected errReadOnly, got %v", query, err)
+		}
+	}
+	if _, err := db.Exec("DELETE FROM users"); err == nil {
+		t.Error("expected the database to stay read-only")
+	}
+	var queryOnly int
+	if err := db.QueryRow("PRAGMA query_only").Scan(&queryOnly); err != nil || queryOnly != 1 {
+		t.Errorf("expected query_only to be readable and on, got %d, %v", queryOnly, err)
+	}
+	if _, err := db.Query("SELECT * FROM missing"); err == nil || !strings.Contains(err.Error(), "no such table: missing") {
+		t.Errorf("expected no such table error, got %v", err)
+	}
+	db.Close()
+
+	// A broken file fails the query that references it
+	db, err = sql.Open(DriverName, "file="+broken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Query("SELECT * FROM broken"); err == nil || !strings.Contains(err.Error(), "failed to load table broken") {
+		t.Errorf("expected a load error, got %v", err)
+	}
+	db.Close()
+
+	// A partition path is a path, not an alias
+	partition := filepath.Join(dir, "sales", "year=2025")
+	if err := os.MkdirAll(partition, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(partition, "part.csv"), []byte("id,total\n1,5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err = sql.Open(DriverName, "file="+filepath.Join(partition, "part.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int
+	if err := db.QueryRow("SELECT total FROM part").Scan(&total); err != nil || total != 5 {
+		t.Errorf("got %d, %v, want 5 from the partition file", total, err)
+	}
+	db.Close()
+
+	// Writable and eager
+	db, err = sql.Open(DriverName, "file="+users+"&delimiter=%3B&readonly=false&lazy=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("PRAGMA query_only = 0"); err != nil {
+		t.Fatalf("expected a writable database to accept setting query_only, got %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM users WHERE id = 2"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil || count != 1 {
+		t.Errorf("got %d rows, %v, want 1", count, err)
+	}
+}
+
+func TestDriverOpenReaders(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.csv": "id\n1\n2\n", "b.csv": "id\n3\n", "c.csv": "id\n4\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dsn := "file=" + filepath.Join(dir, "a.csv") + "&file=" + filepath.Join(dir, "b.csv") + "&file=" + filepath.Join(dir, "c.csv")
+	db, err := sql.Open(DriverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// A table can't be loaded while the rows of another query are open: that fails
+	// rather than waiting for rows that are never closed
+	rows, err := db.Query("SELECT id FROM a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rows.Next() {
+		t.Fatal("expected a row")
+	}
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM b").Scan(&n); !errors.Is(err, core.ErrTablesInUse) {
+		t.Errorf("expected ErrTablesInUse, got %v", err)
+	}
+	// Loaded tables can still be read
+	if err := db.QueryRow("SELECT count(*) FROM a").Scan(&n); err != nil || n != 2 {
+		t.Errorf("got %d, %v, want 2", n, err)
+	}
+	rows.Close()
+	if err := db.QueryRow("SELECT count(*) FROM b").Scan(&n); err != nil || n != 1 {
+		t.Errorf("got %d, %v, want 1 once the rows are closed", n, err)
+	}
+
+	// A transaction loads every table when it begins
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for table, want := range map[string]int{"a": 2, "c": 1} {
+		if err := tx.QueryRow("SELECT count(*) FROM " + table).Scan(&n); err != nil || n != want {
+			t.Errorf("%s: got %d, %v, want %d", table, n, err, want)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseDSN(t *testing.T) {
+	// A relative partition path that exists is a path too
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("year=2025", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("year=2025/part.csv", []byte("id\n1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := parseDSN("file=data/users.csv&file=people=other/users.csv&file=users.json" +
+		"&file=data/year=2025/part.csv&file=year=2025/part.csv&format=csv&sheet=Q1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []dsnFile{{"users", "data/users.csv"}, {"people", "other/users.csv"}, {"users_2", "users.json"},
+		{"part", "data/year=2025/part.csv"}, {"part_2", "year=2025/part.csv"}}
+	if !reflect.DeepEqual(config.files, want) {
+		t.Errorf("files = %v, want %v", config.files, want)
+	}
+	if config.format != "csv" || config.options["sheet"] != "Q1" || !config.readOnly || !config.lazy {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	for _, dsn := range []string{
+		"file=a.csv&colour=red",
+		"file=a.csv&format=yaml",
+		"file=a.csv&readonly=maybe",
+		"file=select=a.csv",
+		"file=t=a.csv&file=t=b.csv",
+		"file=t=",
+	} {
+		if _, err := parseDSN(dsn); err == nil {
+			t.Errorf("%s: expected an error", dsn)
+		}
+	}
+}
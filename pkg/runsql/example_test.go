@@ -0,0 +1,238 @@
+package runsql_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zulfikawr/runsql/pkg/runsql"
+)
+
+const orders = `id,customer,total
+1,ada,19.5
+2,grace,5
+3,ada,7.25
+`
+
+func Example() {
+	db, err := runsql.Open(runsql.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.LoadReader("orders.csv", strings.NewReader(orders), runsql.ReadOptions{}); err != nil {
+		log.Fatal(err)
+	}
+
+	rows, err := db.Query(context.Background(),
+		"SELECT customer, SUM(total) AS spent FROM orders GROUP BY customer ORDER BY customer")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := runsql.WriteRows(os.Stdout, "csv", rows); err != nil {
+		log.Fatal(err)
+	}
+	// Output:
+	// customer,spent
+	// ada,26.75
+	// grace,5
+}
+
+func ExampleDB_LoadFile() {
+	dir, err := os.MkdirTemp("", "runsql")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The extension doesn't tell the format, so it is detected from the content
+	path := filepath.Join(dir, "export.dat")
+	if err := os.WriteFile(path, []byte("name;city\nada;London\ngrace;New York\n"), 0o644); err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := runsql.Open(runsql.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	table, err := db.LoadFile(path, runsql.ReadOptions{Table: "people"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	info, err := db.Describe(table)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(info.Name, info.RowCount)
+	for _, col := range info.Columns {
+		fmt.Println(col.Name, col.Type)
+	}
+	// Output:
+	// people 2
+	// name TEXT
+	// city TEXT
+}
+
+func ExampleDB_Query() {
+	db, err := runsql.Open(runsql.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.LoadReader("orders.csv", strings.NewReader(orders), runsql.ReadOptions{}); err != nil {
+		log.Fatal(err)
+	}
+
+	rows, err := db.Query(context.Background(),
+		"SELECT id, total FROM orders WHERE customer = :customer ORDER BY id", sql.Named("customer", "ada"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		values := rows.Values()
+		fmt.Println(values[0], values[1])
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatal(err)
+	}
+	// Output:
+	// 1 19.5
+	// 3 7.25
+}
+
+// countdown is a runsql.Source generating its rows instead of reading them from a file
+type countdown int
+
+func (c countdown) GetHeaders() ([]string, error) {
+	return []string{"n"}, nil
+}
+
+func (c countdown) Read() (chan []interface{}, error) {
+	ch := make(chan []interface{})
+	go func() {
+		defer close(ch)
+		for n := int(c); n > 0; n-- {
+			ch <- []interface{}{n}
+		}
+	}()
+	return ch, nil
+}
+
+func ExampleDB_LoadSource() {
+	db, err := runsql.Open(runsql.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.LoadSource("countdown", countdown(3)); err != nil {
+		log.Fatal(err)
+	}
+
+	rows, err := db.Query(context.Background(), "SELECT n FROM countdown ORDER BY n")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := runsql.WriteRows(os.Stdout, "ndjson", rows); err != nil {
+		log.Fatal(err)
+	}
+	// Output:
+	// {"n":1}
+	// {"n":2}
+	// {"n":3}
+}
+
+func Example_databaseSQL() {
+	dir, err := os.MkdirTemp("", "runsql")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "orders.csv")
+	if err := os.WriteFile(path, []byte(orders), 0o644); err != nil {
+		log.Fatal(err)
+	}
+
+	// Registered by importing the package; the file is loaded when a query first uses it
+	db, err := sql.Open(runsql.DriverName, "file="+url.QueryEscape(path))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	var count int
+	var total float64
+	if err := db.QueryRow("SELECT COUNT(*), SUM(total) FROM orders").Scan(&count, &total); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(count, total)
+	// Output:
+	// 3 31.75
+}
+
+// lines is a Source of one row per line of text
+type lines []string
+
+func (l lines) GetHeaders() ([]string, error) {
+	return []string{"line"}, nil
+}
+
+func (l lines) Read() (chan []interface{}, error) {
+	ch := make(chan []interface{}, len(l))
+	for _, line := range l {
+		ch <- []interface{}{line}
+	}
+	close(ch)
+	return ch, nil
+}
+
+func ExampleRegisterFormat() {
+	err := runsql.RegisterFormat(runsql.Format{
+		Name:       "lines",
+		Extensions: []string{".lines"},
+		New: func(r io.Reader, options map[string]string) (runsql.Source, error) {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			return lines(strings.Fields(string(data))), nil
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := runsql.Open(runsql.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	table, err := db.LoadReader("words.lines", strings.NewReader("apple\nbanana\ncherry\n"), runsql.ReadOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	rows, err := db.Query(context.Background(), "SELECT COUNT(*) FROM "+table)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := runsql.WriteRows(os.Stdout, "csv", rows); err != nil {
+		log.Fatal(err)
+	}
+	// Output:
+	// COUNT(*)
+	// 3
+}
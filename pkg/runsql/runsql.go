@@ -0,0 +1,335 @@
+// Package runsql runs SQL queries on CSV, JSON, NDJSON, XLSX and Parquet files from Go,
+// the way the runsql command does, without shelling out to it.
+//
+// A DB is a SQLite database, in memory or in a file, that files are loaded into as
+// tables. Files are loaded from paths or from any io.Reader, in a format detected from
+// their name or content or named with ReadOptions. Queries return their rows as they are
+// read, and WriteRows writes them in any of the output formats of the command.
+//
+//	db, err := runsql.Open(runsql.Config{})
+//	if err != nil {
+//		return err
+//	}
+//	defer db.Close()
+//
+//	if _, err := db.LoadFile("sales.csv", runsql.ReadOptions{}); err != nil {
+//		return err
+//	}
+//	rows, err := db.Query(ctx, "SELECT region, SUM(total) FROM sales GROUP BY region")
+//	if err != nil {
+//		return err
+//	}
+//	_, err = runsql.WriteRows(os.Stdout, "csv", rows)
+//
+// # Compatibility
+//
+// This package is the public API of runsql and follows semantic versioning: within a
+// major version, exported identifiers are neither removed nor changed in incompatible
+// ways. The packages under internal/ carry no such promise and can't be imported.
+package runsql
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/zulfikawr/runsql/internal/core"
+	"github.com/zulfikawr/runsql/internal/parsers"
+	"github.com/zulfikawr/runsql/internal/writers"
+)
+
+// Source is a table's worth of rows, read by LoadSource. Implement it to load data that
+// doesn't come from a file.
+type Source interface {
+	// GetHeaders returns the column names.
+	GetHeaders() ([]string, error)
+
+	// Read returns a channel of rows, each with a value per column, closed after the
+	// last row. Values may be nil, strings, or any integer, float or bool.
+	Read() (chan []interface{}, error)
+}
+
+// Format describes an input format, see RegisterFormat.
+type Format struct {
+	Name       string            // Name given as ReadOptions.Format, e.g. "psv"
+	Extensions []string          // Lowercase file extensions with their dot, e.g. ".psv"
+	MIMETypes  []string          // Content types of the format, if any
+	Options    map[string]string // Parser options the format takes, with a description of each
+
+	// Detect reports whether the first bytes of a file, up to 8KB, are of the format, for
+	// files without a known extension. It may be nil.
+	Detect func(head []byte) bool
+
+	// New returns the source of rows of a file of the format, read from r with the
+	// parser options given in ReadOptions that the format takes.
+	New func(r io.Reader, options map[string]string) (Source, error)
+}
+
+// Table describes a loaded table.
+type Table struct {
+	Name     string
+	Columns  []Column
+	RowCount int64
+}
+
+// Column describes a column of a table.
+type Column struct {
+	Name string
+	Type string // SQLite type: "INTEGER", "REAL" or "TEXT"
+}
+
+// Config holds the settings of a DB.
+type Config struct {
+	// Path is the SQLite database file backing the DB. Its tables are kept after Close,
+	// and can be queried again by opening the same file. If empty, the DB is in memory.
+	Path string
+}
+
+// ReadOptions tell how a file is read.
+type ReadOptions struct {
+	Table   string            // Table to load the file into, made of letters, digits and underscores; named after the file if empty
+	Format  string            // Input format, e.g. "csv"; detected from the file's name or content if empty
+	Options map[string]string // Parser options, e.g. {"delimiter": ";"}; a format ignores those it doesn't take
+}
+
+// DB is a database that files are loaded into and queried. It is safe for concurrent use.
+type DB struct {
+	engine *core.Engine
+}
+
+// Open opens a DB, in memory or backed by the file given in the config.
+func Open(config Config) (*DB, error) {
+	engine, err := openEngine(config.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{engine: engine}, nil
+}
+
+// openEngine opens an engine backed by a database file, or in memory if path is empty
+func openEngine(path string) (*core.Engine, error) {
+	if path == "" {
+		return core.NewEngine()
+	}
+	return core.OpenEngine(path)
+}
+
+// Close closes the DB. An in-memory DB loses its tables.
+func (db *DB) Close() error {
+	return db.engine.Close()
+}
+
+// LoadFile loads a file into a table, replacing any table of the same name, and returns
+// the name of the table.
+func (db *DB) LoadFile(path string, opts ReadOptions) (string, error) {
+	table, err := tableName(opts.Table, path)
+	if err != nil {
+		return "", err
+	}
+	format, err := readFormat(opts.Format, func() (parsers.Format, error) { return parsers.DetectFile(path) })
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	source, closer, err := format.Open(path, opts.Options)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	if err := db.engine.Load(table, source); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return table, nil
+}
+
+// LoadReader loads a stream into a table, replacing any table of the same name, and
+// returns the name of the table. The name, e.g. the name of an uploaded file, is used to
+// detect the format and name the table, unless opts gives them. XLSX and Parquet streams
+// are read into memory first, since they can't be parsed from a stream.
+func (db *DB) LoadReader(name string, r io.Reader, opts ReadOptions) (string, error) {
+	table, err := tableName(opts.Table, name)
+	if err != nil {
+		return "", err
+	}
+	br := bufio.NewReaderSize(r, parsers.SniffSize)
+	format, err := readFormat(opts.Format, func() (parsers.Format, error) {
+		head, _ := br.Peek(parsers.SniffSize) // Shorter at the end of the stream
+		return parsers.Detect(name, head)
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	source, closer, err := format.Read(br, opts.Options)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	if err := db.engine.Load(table, source); err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return table, nil
+}
+
+// LoadSource loads the rows of a source into a table, replacing any table of the same name.
+// The name is made of letters, digits and underscores, and is not an SQL keyword.
+func (db *DB) LoadSource(table string, source Source) error {
+	if err := core.ValidTableName(table); err != nil {
+		return err
+	}
+	return db.engine.Load(table, source)
+}
+
+// tableName returns the table a file is loaded into: the given table, which must be a
+// valid name, or else a table named after the file
+func tableName(table, file string) (string, error) {
+	if table == "" {
+		return core.FileTableName(file), nil
+	}
+	if err := core.ValidTableName(table); err != nil {
+		return "", err
+	}
+	return table, nil
+}
+
+// Tables returns the names of the tables of the DB, sorted.
+func (db *DB) Tables() ([]string, error) {
+	return db.engine.Tables()
+}
+
+// Describe returns the columns of a table with their types, and its row count.
+func (db *DB) Describe(table string) (Table, error) {
+	t, err := db.engine.DescribeTable(table)
+	if err != nil {
+		return Table{}, err
+	}
+	described := Table{Name: t.Name, RowCount: t.RowCount}
+	for i, name := range t.Columns {
+		described.Columns = append(described.Columns, Column{Name: name, Type: t.Types[i]})
+	}
+	return described, nil
+}
+
+// Query runs a SQL query and returns its rows as they are read. The arguments are bound
+// to the query's placeholders: ? by position, and :name, @name or $name given as
+// sql.Named("name", value). The Rows must be closed.
+func (db *DB) Query(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	rows, err := db.engine.Stream(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &Rows{rows: rows}, nil
+}
+
+// Rows is the result of a query, read one row at a time:
+//
+//	for rows.Next() {
+//		values := rows.Values()
+//		...
+//	}
+//	if err := rows.Err(); err != nil {
+//		...
+//	}
+type Rows struct {
+	rows *core.Rows
+}
+
+// Columns returns the column names of the result.
+func (r *Rows) Columns() []string {
+	return r.rows.Columns()
+}
+
+// Next reads the next row, and reports false at the end of the result or on error.
+func (r *Rows) Next() bool {
+	return r.rows.Next()
+}
+
+// Values returns the row read by Next: nil for NULL, int64, float64 or string. Each row
+// gets a new slice, which the caller may keep.
+func (r *Rows) Values() []interface{} {
+	return r.rows.Values()
+}
+
+// Err returns the error that ended the result early, if any.
+func (r *Rows) Err() error {
+	return r.rows.Err()
+}
+
+// Close releases the result. It may be called before every row has been read.
+func (r *Rows) Close() error {
+	return r.rows.Close()
+}
+
+// WriteRows writes the columns and every remaining row of rows to w in an output format
+// such as "csv" or "json" (see OutputFormats), closes rows, and returns the number of
+// rows written.
+func WriteRows(w io.Writer, format string, rows *Rows) (int64, error) {
+	defer rows.Close()
+
+	writer, err := writers.New(format, w)
+	if err != nil {
+		return 0, err
+	}
+	if err := writer.WriteHeader(rows.Columns()); err != nil {
+		return 0, err
+	}
+	var n int64
+	for rows.Next() {
+		if err := writer.WriteRow(rows.Values()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	return n, writer.Close()
+}
+
+// OutputFormats returns the names of the formats WriteRows writes, sorted.
+func OutputFormats() []string {
+	return writers.Names()
+}
+
+// InputFormats returns the names of the formats files can be read in, in registration
+// order.
+func InputFormats() []string {
+	var names []string
+	for _, f := range parsers.Formats() {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// RegisterFormat adds an input format, which every DB then reads files of, and which
+// the runsql command reads too when built with it. Its name and extensions must not be
+// taken by another format.
+func RegisterFormat(f Format) error {
+	if f.New == nil {
+		return fmt.Errorf("format %s has no New function", f.Name)
+	}
+	return parsers.Register(parsers.Format{
+		Name:       f.Name,
+		Extensions: f.Extensions,
+		MIMETypes:  f.MIMETypes,
+		Options:    f.Options,
+		Magic:      f.Detect,
+		New: func(r io.Reader, options parsers.Options) (parsers.Source, io.Closer, error) {
+			source, err := f.New(r, options)
+			return source, nil, err
+		},
+	})
+}
+
+// readFormat returns the named format, or the detected one if name is empty
+func readFormat(name string, detect func() (parsers.Format, error)) (parsers.Format, error) {
+	if name != "" {
+		return parsers.Lookup(name)
+	}
+	return detect()
+}
@@ -0,0 +1,42 @@
+package runsql
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTableNames(t *testing.T) {
+	db, err := Open(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	path := filepath.Join(t.TempDir(), "my data.csv")
+	if err := os.WriteFile(path, []byte("id\n1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{`x" (a); DROP TABLE t; --`, "1st", "select", "__loading_1 x"} {
+		if _, err := db.LoadFile(path, ReadOptions{Table: table}); err == nil {
+			t.Errorf("LoadFile with table %q: expected an error", table)
+		}
+		if _, err := db.LoadReader("a.csv", strings.NewReader("id\n1\n"), ReadOptions{Table: table}); err == nil {
+			t.Errorf("LoadReader with table %q: expected an error", table)
+		}
+		if err := db.LoadSource(table, nil); err == nil {
+			t.Errorf("LoadSource with table %q: expected an error", table)
+		}
+	}
+
+	// Without a table the name comes from the file
+	table, err := db.LoadFile(path, ReadOptions{})
+	if err != nil || table != "my_data" {
+		t.Errorf("LoadFile = %q, %v", table, err)
+	}
+	tables, _ := db.Tables()
+	if strings.Join(tables, ",") != "my_data" {
+		t.Errorf("Unexpected tables: %v", tables)
+	}
+}
@@ -0,0 +1,9 @@
+// Package web embeds the static frontend assets served by the web adapter.
+package web
+
+import "embed"
+
+// FS holds the frontend files (index.html, style.css, script.js).
+//
+//go:embed index.html style.css script.js
+var FS embed.FS
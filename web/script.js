@@ -1,6 +1,12 @@
 let currentData = null;
 let currentFormat = "table";
 let currentFile = null;
+let currentProfile = null;
+let scriptMode = false;
+let functionList = null;
+
+// Rows requested per page (the server caps this at 10000)
+const PAGE_SIZE = 1000;
 
 // DOM Elements
 const fileInput = document.getElementById("fileInput");
@@ -13,6 +19,13 @@ const formatBtns = document.querySelectorAll(".format-btn");
 const themeToggle = document.getElementById("themeToggle");
 const clearBtn = document.getElementById("clearBtn");
 const formatBtn = document.getElementById("formatBtn");
+const pager = document.getElementById("pager");
+const prevPageBtn = document.getElementById("prevPageBtn");
+const nextPageBtn = document.getElementById("nextPageBtn");
+const pageLabel = document.getElementById("pageLabel");
+const scriptModeBtn = document.getElementById("scriptModeBtn");
+const statementLog = document.getElementById("statementLog");
+const functionsBtn = document.getElementById("functionsBtn");
 
 // Theme Toggle (Header)
 themeToggle.addEventListener("click", () => {
@@ -37,48 +50,75 @@ if (document.documentElement.classList.contains("dark")) {
 const revertSchemaBtn = document.getElementById("revertSchemaBtn");
 let originalSchemaData = null; // Store original schema for revert
 
-// File upload
+// Table name chosen for each uploaded file, by position; unset files are named by the server
+let tableNames = [];
+
+// Add the uploaded files to a request, each preceded by the table name chosen for it
+function appendFiles(formData) {
+  currentFile.forEach((file, i) => {
+    if (tableNames[i]) {
+      formData.append("table", tableNames[i]);
+    }
+    formData.append("file", file);
+  });
+}
+
 // File upload
 fileInput.addEventListener("change", async (e) => {
   if (e.target.files.length > 0) {
-    const files = Array.from(e.target.files);
-    currentFile = files; // Store as array
+    currentFile = Array.from(e.target.files); // Store as array
+    tableNames = [];
+    await loadSchema();
+  }
+});
 
-    // Reset original schema data
-    originalSchemaData = null;
+// Upload the files to /schema and show the tables they load into
+async function loadSchema() {
+  currentProfile = null;
 
-    // Show skeleton loading
-    renderSkeletonSchema();
-    document.getElementById("colCount").textContent = "...";
+  // Reset original schema data
+  originalSchemaData = null;
 
-    // Fetch schema
-    try {
-      const formData = new FormData();
-      files.forEach((file) => {
-        formData.append("file", file);
-      });
+  // Show skeleton loading
+  renderSkeletonSchema();
+  document.getElementById("colCount").textContent = "...";
 
-      const response = await fetch("/schema", {
-        method: "POST",
-        body: formData,
-      });
+  // Fetch schema
+  try {
+    const formData = new FormData();
+    appendFiles(formData);
 
-      const data = await response.json();
+    const response = await fetch("/schema", {
+      method: "POST",
+      body: formData,
+    });
 
-      if (response.ok && data.status === "success") {
-        originalSchemaData = data; // Cache original schema
-        renderSchemas(data);
-      } else {
-        schemaList.innerHTML =
-          '<div class="schema-empty">Error loading schema</div>';
-      }
-    } catch (err) {
-      console.error(err);
-      schemaList.innerHTML =
-        '<div class="schema-empty">Error loading schema</div>';
+    const data = await response.json();
+
+    if (response.ok && data.status === "success") {
+      originalSchemaData = data; // Cache original schema
+      renderSchemas(data);
+    } else {
+      schemaList.innerHTML = `<div class="schema-empty">${escapeHtml(data.error || "Error loading schema")}</div>`;
     }
+  } catch (err) {
+    console.error(err);
+    schemaList.innerHTML =
+      '<div class="schema-empty">Error loading schema</div>';
   }
-});
+}
+
+// Rename the table of an uploaded file and reload the schema (attached to window for onclick access)
+window.renameTable = async function (event, index) {
+  event.stopPropagation();
+  const upload = originalSchemaData.uploads[index];
+  const name = prompt(`Table name for ${upload.file}`, upload.table);
+  if (name === null || name.trim() === "" || name.trim() === upload.table) {
+    return;
+  }
+  tableNames[index] = name.trim();
+  await loadSchema();
+};
 
 function renderSkeletonSchema() {
   let html = "";
@@ -94,88 +134,52 @@ function renderSkeletonSchema() {
   schemaList.innerHTML = html;
 }
 
-function sanitizeTableName(name) {
-  let res = "";
-  for (let i = 0; i < name.length; i++) {
-    const r = name[i];
-    if (
-      (r >= "a" && r <= "z") ||
-      (r >= "A" && r <= "Z") ||
-      (r >= "0" && r <= "9") ||
-      r === "_"
-    ) {
-      res += r;
-    } else {
-      res += "_";
-    }
-  }
-  return res;
+// Index of the upload a table was loaded from, in the last /schema response
+function uploadIndex(tableName) {
+  if (!originalSchemaData || !originalSchemaData.uploads) return -1;
+  return originalSchemaData.uploads.findIndex((u) => u.table === tableName);
 }
 
+// File format badge of a table, from the format its file was read in
 function getFileFormat(tableName) {
-  if (!currentFile) return "";
-  for (const file of currentFile) {
-    // Replicate logic: base -> ext -> trim -> sanitize
-    const base = file.name;
-    const lastDot = base.lastIndexOf(".");
-    let nameWithoutExt = base;
-    let ext = "";
-
-    if (lastDot !== -1) {
-      nameWithoutExt = base.substring(0, lastDot);
-      ext = base.substring(lastDot + 1).toUpperCase();
-    }
-
-    const sanitized = sanitizeTableName(nameWithoutExt);
-    if (sanitized === tableName) {
-      return ext;
-    }
-  }
-  return "";
+  const index = uploadIndex(tableName);
+  if (index === -1) return "";
+  return originalSchemaData.uploads[index].format.toUpperCase();
 }
 
-function sanitizeTableName(name) {
-  let res = "";
-  for (let i = 0; i < name.length; i++) {
-    const r = name[i];
-    if (
-      (r >= "a" && r <= "z") ||
-      (r >= "A" && r <= "Z") ||
-      (r >= "0" && r <= "9") ||
-      r === "_"
-    ) {
-      res += r;
-    } else {
-      res += "_";
-    }
-  }
-  return res;
+// Format a value from the schema statistics for display
+function formatStat(value) {
+  if (value === null || value === undefined) return "";
+  const str = String(value);
+  return str.length > 24 ? str.substring(0, 21) + "..." : str;
 }
 
-function getFileFormat(tableName) {
-  if (!currentFile) return "";
-  for (const file of currentFile) {
-    // Replicate logic: base -> ext -> trim -> sanitize
-    const base = file.name;
-    const lastDot = base.lastIndexOf(".");
-    let nameWithoutExt = base;
-    let ext = "";
-
-    if (lastDot !== -1) {
-      nameWithoutExt = base.substring(0, lastDot);
-      ext = base.substring(lastDot + 1).toUpperCase();
-    }
-
-    const sanitized = sanitizeTableName(nameWithoutExt);
-    if (sanitized === tableName) {
-      return ext;
-    }
+// Render a column of the /schema response with its type and statistics
+function renderSchemaColumn(col) {
+  const meta = [`${col.distinct_approx ? "~" : ""}${col.distinct} distinct`];
+  if (col.min !== null && col.max !== null) {
+    meta.push(
+      col.min === col.max
+        ? formatStat(col.min)
+        : `${formatStat(col.min)} – ${formatStat(col.max)}`,
+    );
   }
-  return "";
+  if (col.nullable) meta.push("nullable");
+
+  const samples = (col.samples || []).map((v) => String(v)).join(", ");
+
+  return `
+    <div class="schema-item schema-item-rich" title="${escapeHtml(samples ? `e.g. ${samples}` : "")}">
+        <div class="schema-item-row">
+            <span class="schema-col-name">${escapeHtml(col.name)}</span>
+            <span class="schema-col-type">${escapeHtml(col.type)}</span>
+        </div>
+        <div class="schema-col-meta">${escapeHtml(meta.join(" · "))}</div>
+    </div>`;
 }
 
 function renderSchemas(data) {
-  if (!data.schemas && !data.columns) return;
+  if (!data.tables && !data.schemas && !data.columns) return;
 
   // Handle query result schema (single list of columns, no table names usually provided in current backend response for query)
   // If it's the specific format from /schema endpoint: data.schemas map
@@ -184,7 +188,36 @@ function renderSchemas(data) {
   let html = "";
   let totalCols = 0;
 
-  if (data.schemas) {
+  for (const warning of data.warnings || []) {
+    html += `<div class="schema-warning">${escapeHtml(warning)}</div>`;
+  }
+
+  if (data.tables) {
+    // Multi-table schema with types and statistics
+    for (const table of data.tables) {
+      totalCols += table.columns.length;
+      const fmt = getFileFormat(table.name);
+      const index = uploadIndex(table.name);
+
+      html += `
+            <div class="schema-group">
+                <div class="schema-table-header" onclick="toggleSchema(this)">
+                    <div class="schema-header-left">
+                        <span class="material-symbols-outlined schema-arrow">keyboard_arrow_down</span>
+                        <span>${escapeHtml(table.name)}</span>
+                    </div>
+                    <div class="schema-header-right">
+                        <span class="schema-row-count">${table.row_count.toLocaleString()} rows</span>
+                        ${fmt ? `<span class="schema-file-badge">${fmt}</span>` : ""}
+                        ${index !== -1 ? `<span class="material-symbols-outlined schema-rename" title="Rename table" onclick="renameTable(event, ${index})">edit</span>` : ""}
+                    </div>
+                </div>
+                <div class="schema-items-container">
+                    ${table.columns.map(renderSchemaColumn).join("")}
+                </div>
+            </div>`;
+    }
+  } else if (data.schemas) {
     // Multi-table schema
     for (const [tableName, columns] of Object.entries(data.schemas)) {
       totalCols += columns.length;
@@ -262,6 +295,8 @@ revertSchemaBtn.addEventListener("click", () => {
 if (clearFileBtn) {
   clearFileBtn.addEventListener("click", () => {
     currentFile = null;
+    currentProfile = null;
+    tableNames = [];
     fileInput.value = "";
     schemaList.innerHTML =
       '<div class="schema-empty">Upload a file to see schema</div>';
@@ -339,6 +374,9 @@ queryInput.addEventListener("input", () => {
     // Reset results stats
     document.getElementById("resultCount").textContent = "0";
     document.getElementById("resultTime").textContent = "0ms";
+    currentData = null;
+    updatePager(null);
+    renderStatementLog(null);
     // Reset results container to empty state if truly cleared? User didn't explicitly ask for this but "it should be back to original when the input is cleared"
     // "also this too: 2 results in 185ms. it should be back to original when the input is cleared/or when no text in the query."
     resultsContainer.innerHTML =
@@ -356,12 +394,111 @@ formatBtns.forEach((btn) => {
     formatBtns.forEach((b) => b.classList.remove("active"));
     btn.classList.add("active");
     currentFormat = btn.dataset.format;
-    if (currentData) {
+    if (currentFormat === "profile") {
+      showProfile();
+    } else if (currentData) {
       displayResults(currentData);
     }
   });
 });
 
+// Script mode runs every statement of the editor instead of a single query
+scriptModeBtn.addEventListener("click", () => {
+  scriptMode = !scriptMode;
+  scriptModeBtn.classList.toggle("active", scriptMode);
+  if (!scriptMode) renderStatementLog(null);
+});
+
+// Show the SQL functions runsql adds to SQLite; clicking one inserts it into the editor
+functionsBtn.addEventListener("click", async () => {
+  if (!functionList) {
+    try {
+      const response = await fetch("/functions");
+      const data = await response.json();
+      if (!response.ok || data.status !== "success") {
+        alert(data.error || "Failed to load functions");
+        return;
+      }
+      functionList = data.functions;
+    } catch (err) {
+      alert(`Error: ${err.message}`);
+      return;
+    }
+  }
+  renderFunctions(functionList);
+});
+
+function renderFunctions(functions) {
+  updatePager(null);
+  document.getElementById("resultCount").textContent = functions.length;
+  document.getElementById("resultTime").textContent = "0ms";
+
+  let html =
+    '<div class="profile-title">SQL functions <span class="profile-rows">click to insert</span></div>';
+  html +=
+    "<table><thead><tr><th>Function</th><th>Kind</th><th>Description</th></tr></thead><tbody>";
+  functions.forEach((f, i) => {
+    html += `<tr class="function-item" data-index="${i}">`;
+    html += `<td><code>${escapeHtml(f.signature)}</code></td>`;
+    html += `<td>${f.aggregate ? "aggregate" : "scalar"}</td>`;
+    html += `<td>${escapeHtml(f.description)}</td>`;
+    html += "</tr>";
+  });
+  html += "</tbody></table>";
+  resultsContainer.innerHTML = html;
+
+  resultsContainer.querySelectorAll(".function-item").forEach((row) => {
+    row.addEventListener("click", () => {
+      insertAtCursor(`${functions[row.dataset.index].name}(`);
+    });
+  });
+}
+
+function insertAtCursor(text) {
+  const start = queryInput.selectionStart;
+  const end = queryInput.selectionEnd;
+  queryInput.setRangeText(text, start, end, "end");
+  queryInput.focus();
+  updateSQLHighlight();
+}
+
+// List the statements of a script run; statements that returned rows can be opened
+function renderStatementLog(statements) {
+  if (!statements || statements.length === 0) {
+    statementLog.classList.remove("visible");
+    statementLog.innerHTML = "";
+    return;
+  }
+
+  let html = "";
+  statements.forEach((stmt) => {
+    const outcome = stmt.result_id
+      ? `${stmt.row_count} row${stmt.row_count === 1 ? "" : "s"}`
+      : `${stmt.rows_affected} row${stmt.rows_affected === 1 ? "" : "s"} affected`;
+    const active =
+      currentData && stmt.result_id && stmt.result_id === currentData.result_id
+        ? " active"
+        : "";
+    html += `<div class="statement-item${stmt.result_id ? " has-result" : ""}${active}" data-result-id="${stmt.result_id || ""}">`;
+    html += `<span class="statement-index">#${stmt.index}</span>`;
+    html += `<span class="statement-line">line ${stmt.line}</span>`;
+    html += `<span class="statement-sql">${escapeHtml(stmt.sql.split("\n")[0])}</span>`;
+    html += `<span class="statement-outcome">${outcome} · ${stmt.time_ms}ms</span>`;
+    html += "</div>";
+  });
+
+  statementLog.innerHTML = html;
+  statementLog.classList.add("visible");
+  statementLog.querySelectorAll(".has-result").forEach((item) => {
+    item.addEventListener("click", async () => {
+      if (!currentData) return;
+      currentData.result_id = item.dataset.resultId;
+      await fetchPage(0);
+      renderStatementLog(statements);
+    });
+  });
+}
+
 // Keyboard shortcut: Ctrl+Enter to run query
 queryInput.addEventListener("keydown", (e) => {
   if (e.ctrlKey && e.key === "Enter") {
@@ -389,14 +526,15 @@ runQueryBtn.addEventListener("click", async () => {
     '<span class="material-symbols-outlined" style="animation: spin 1s linear infinite;">autorenew</span>Running...';
 
   try {
+    // The query goes first, so that the server can skip the files it doesn't use
     const formData = new FormData();
-    // Append all files
-    currentFile.forEach((file) => {
-      formData.append("file", file);
-    });
-
     formData.append("query", query);
     formData.append("format", currentFormat);
+    formData.append("limit", PAGE_SIZE);
+    if (scriptMode) {
+      formData.append("mode", "script");
+    }
+    appendFiles(formData);
 
     const response = await fetch("/query", {
       method: "POST",
@@ -406,15 +544,23 @@ runQueryBtn.addEventListener("click", async () => {
     const data = await response.json();
 
     if (!response.ok || data.status !== "success") {
+      // A failed script still reports the statements that ran before the error
+      renderStatementLog(data.statements);
       alert(data.error || "Query execution failed");
       return;
     }
 
     currentData = data;
+    renderStatementLog(data.statements);
 
     // Update schema view to show result columns
     renderSchemas(data);
 
+    // Leave the profile view so the new result is visible
+    if (currentFormat === "profile") {
+      setFormat("table");
+    }
+
     displayResults(data);
   } catch (err) {
     alert(`Error: ${err.message}`);
@@ -425,13 +571,176 @@ runQueryBtn.addEventListener("click", async () => {
   }
 });
 
+// Fetch another page of the current result from the server
+async function fetchPage(offset) {
+  if (!currentData || !currentData.result_id) return;
+
+  prevPageBtn.disabled = true;
+  nextPageBtn.disabled = true;
+
+  try {
+    const params = new URLSearchParams({
+      id: currentData.result_id,
+      offset: Math.max(0, offset),
+      limit: PAGE_SIZE,
+    });
+    const response = await fetch(`/results?${params}`);
+    const data = await response.json();
+
+    if (!response.ok || data.status !== "success") {
+      alert(data.error || "Failed to load page");
+      updatePager(currentData);
+      return;
+    }
+
+    // Keep the original execution time, paging is served from the cache
+    data.time_ms = currentData.time_ms;
+    currentData = data;
+    displayResults(data);
+    resultsContainer.scrollTop = 0;
+  } catch (err) {
+    alert(`Error: ${err.message}`);
+    updatePager(currentData);
+  }
+}
+
+prevPageBtn.addEventListener("click", () => {
+  if (currentData) fetchPage(currentData.offset - currentData.limit);
+});
+
+nextPageBtn.addEventListener("click", () => {
+  if (currentData) fetchPage(currentData.offset + currentData.limit);
+});
+
+// Show the pager only when the result spans more than one page
+function updatePager(data) {
+  if (!data || data.total_rows <= data.rows.length) {
+    pager.classList.remove("visible");
+    return;
+  }
+
+  const start = data.rows.length > 0 ? data.offset + 1 : data.offset;
+  const end = data.offset + data.rows.length;
+  pageLabel.textContent = `${start}-${end} of ${data.total_rows}${data.capped ? "+" : ""}`;
+  prevPageBtn.disabled = data.offset === 0;
+  nextPageBtn.disabled = !data.truncated;
+  pager.classList.add("visible");
+}
+
+// Mark a format button as active without re-rendering
+function setFormat(format) {
+  currentFormat = format;
+  formatBtns.forEach((b) =>
+    b.classList.toggle("active", b.dataset.format === format),
+  );
+}
+
+// Profile the uploaded files, reusing the last profile until the files change
+async function showProfile() {
+  updatePager(null);
+
+  if (!currentFile || currentFile.length === 0) {
+    resultsContainer.innerHTML =
+      '<div class="results-empty"><div class="empty-state"><div class="empty-icon"><span class="material-symbols-outlined">monitoring</span></div><p class="empty-text">Upload a file to see its profile</p></div></div>';
+    return;
+  }
+
+  if (currentProfile) {
+    renderProfile(currentProfile);
+    return;
+  }
+
+  resultsContainer.innerHTML =
+    '<div class="results-empty"><div class="empty-state"><div class="empty-icon"><span class="material-symbols-outlined" style="animation: spin 1s linear infinite;">autorenew</span></div><p class="empty-text">Profiling...</p></div></div>';
+
+  try {
+    const formData = new FormData();
+    appendFiles(formData);
+
+    const response = await fetch("/profile", {
+      method: "POST",
+      body: formData,
+    });
+
+    const data = await response.json();
+
+    if (!response.ok || data.status !== "success") {
+      alert(data.error || "Profiling failed");
+      return;
+    }
+
+    currentProfile = data;
+    if (currentFormat === "profile") {
+      renderProfile(data);
+    }
+  } catch (err) {
+    alert(`Error: ${err.message}`);
+  }
+}
+
+function formatProfileNumber(value) {
+  if (value === null || value === undefined) return "";
+  return Number.isInteger(value) ? String(value) : value.toFixed(2);
+}
+
+// Render one summary table per profiled table
+function renderProfile(data) {
+  document.getElementById("resultCount").textContent = data.profiles.reduce(
+    (sum, p) => sum + p.row_count,
+    0,
+  );
+  document.getElementById("resultTime").textContent = `${data.time_ms}ms`;
+
+  let html = "";
+  data.profiles.forEach((profile) => {
+    html += `<div class="profile-title">${escapeHtml(profile.table)} <span class="profile-rows">${profile.row_count} rows</span></div>`;
+    html +=
+      "<table><thead><tr><th>Column</th><th>Type</th><th>Null %</th><th>Distinct</th><th>Min</th><th>Max</th><th>Mean</th><th>Std Dev</th><th>Top values</th><th>Length</th><th>Patterns</th></tr></thead><tbody>";
+
+    profile.columns.forEach((col) => {
+      const top = (col.top_values || [])
+        .map((v) => `${escapeHtml(formatStat(v.value))} (${v.count})`)
+        .join("<br>");
+      const patterns = (col.patterns || [])
+        .map(
+          (p) =>
+            `${escapeHtml(p.pattern)} (${formatProfileNumber(p.percent)}%)`,
+        )
+        .join("<br>");
+      const lengths = col.lengths
+        ? `${col.lengths.min}–${col.lengths.max} (p50 ${col.lengths.p50})`
+        : "";
+
+      html += "<tr>";
+      html += `<td>${escapeHtml(col.name)}</td>`;
+      html += `<td>${escapeHtml(col.type)}</td>`;
+      html += `<td>${formatProfileNumber(col.null_percent)}</td>`;
+      html += `<td>${col.distinct}</td>`;
+      html += `<td>${escapeHtml(formatStat(col.min))}</td>`;
+      html += `<td>${escapeHtml(formatStat(col.max))}</td>`;
+      html += `<td>${formatProfileNumber(col.mean)}</td>`;
+      html += `<td>${formatProfileNumber(col.stddev)}</td>`;
+      html += `<td>${top}</td>`;
+      html += `<td>${lengths}</td>`;
+      html += `<td>${patterns}</td>`;
+      html += "</tr>";
+    });
+
+    html += "</tbody></table>";
+  });
+
+  resultsContainer.innerHTML = html;
+}
+
 // Display results
 function displayResults(data) {
   const resultCountElem = document.getElementById("resultCount");
   const resultTimeElem = document.getElementById("resultTime");
 
-  resultCountElem.textContent = data.rows.length;
+  const total = data.total_rows ?? data.rows.length;
+  resultCountElem.textContent = data.capped ? `${total}+` : total;
   resultTimeElem.textContent = `${data.time_ms}ms`;
+  updatePager(data);
 
   if (currentFormat === "json") {
     const jsonData = data.rows.map((row) => {
@@ -526,41 +835,34 @@ function escapeHtml(text) {
   return div.innerHTML;
 }
 
-// Export functionality
-document.getElementById("exportBtn").addEventListener("click", () => {
-  if (!currentData || currentData.rows.length === 0) {
-    alert("No data to export");
-    return;
-  }
+// Download functionality: the server streams the full cached result in the chosen format
+document.querySelectorAll("[data-download]").forEach((btn) => {
+  btn.addEventListener("click", async () => {
+    if (!currentData || !currentData.result_id || currentData.total_rows === 0) {
+      alert("No data to export");
+      return;
+    }
 
-  let content, filename, type;
+    const format = btn.dataset.download;
+    const params = new URLSearchParams({ id: currentData.result_id, format });
 
-  if (currentFormat === "json") {
-    const jsonData = currentData.rows.map((row) => {
-      const obj = {};
-      currentData.columns.forEach((col, i) => {
-        obj[col] = row[i];
-      });
-      return obj;
-    });
-    content = JSON.stringify(jsonData, null, 2);
-    filename = "export.json";
-    type = "application/json";
-  } else {
-    let csv = currentData.columns.join(",") + "\n";
-    currentData.rows.forEach((row) => {
-      csv += row.map((cell) => JSON.stringify(cell)).join(",") + "\n";
-    });
-    content = csv;
-    filename = "export.csv";
-    type = "text/csv";
-  }
+    try {
+      const response = await fetch(`/download?${params}`);
+      if (!response.ok) {
+        const data = await response.json();
+        alert(data.error || "Download failed");
+        return;
+      }
 
-  const blob = new Blob([content], { type });
-  const url = URL.createObjectURL(blob);
-  const link = document.createElement("a");
-  link.href = url;
-  link.download = filename;
-  link.click();
-  URL.revokeObjectURL(url);
+      const blob = await response.blob();
+      const url = URL.createObjectURL(blob);
+      const link = document.createElement("a");
+      link.href = url;
+      link.download = `export.${format}`;
+      link.click();
+      URL.revokeObjectURL(url);
+    } catch (err) {
+      alert(`Error: ${err.message}`);
+    }
+  });
 });